@@ -2,13 +2,13 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -20,6 +20,7 @@ import (
 	"go.mcpwrapper/internal/discovery"
 	"go.mcpwrapper/internal/logging"
 	"go.mcpwrapper/internal/mcp"
+	"go.mcpwrapper/internal/mcp/server"
 	"go.mcpwrapper/internal/types"
 )
 
@@ -47,16 +48,40 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	mcpClient := mcp.NewClient(mcp.Options{})
+	var auth *mcp.Auth
+	if cfg.MCPAuthFile != "" {
+		var err error
+		if auth, err = mcp.LoadAuth(cfg.MCPAuthFile); err != nil {
+			logger.Error("mcp auth configuration error", "error", err)
+			os.Exit(1)
+		}
+	}
+	mcpClient := mcp.NewClient(mcp.Options{Auth: auth})
 
-	disc := discovery.New(discovery.Options{})
+	selector, err := discovery.ParseSelector(cfg.Selector)
+	if err != nil {
+		logger.Error("configuration error", "error", err)
+		os.Exit(1)
+	}
+	signer, verifier, err := announcementSigning(cfg, logger)
+	if err != nil {
+		logger.Error("signature configuration error", "error", err)
+		os.Exit(1)
+	}
+	disc := discovery.New(discovery.Options{
+		Providers:    discoveryProviders(cfg, logger),
+		Selector:     selector,
+		Verifier:     verifier,
+		SnapshotFile: cfg.SnapshotFile,
+		Logger:       logger,
+	})
 	if err := disc.Start(ctx); err != nil {
 		logger.Error("failed to start discovery", "error", err)
 		os.Exit(1)
 	}
 	defer disc.Stop()
 
-	var announcer *discovery.Announcer
+	var announce *discovery.AnnounceOptions
 	if cfg.Advertise {
 		text := map[string]string{
 			"role":      cfg.Role,
@@ -66,16 +91,16 @@ func main() {
 		if cfg.Description != "" {
 			text["description"] = cfg.Description
 		}
-		announcer, err = discovery.NewAnnouncer(discovery.AnnounceOptions{
-			Instance: cfg.Instance,
-			Port:     cfg.Port,
-			Text:     text,
-		})
-		if err != nil {
-			logger.Error("failed to announce agent wrapper", "error", err)
-			os.Exit(1)
+		announce = &discovery.AnnounceOptions{
+			Instance:      cfg.Instance,
+			Text:          text,
+			Labels:        cfg.Labels,
+			Signer:        signer,
+			Registries:    cfg.RegistryURLs,
+			RegistryToken: cfg.RegistryToken,
+			Address:       cfg.AdvertiseAddress,
+			Logger:        logger,
 		}
-		defer announcer.Stop()
 	}
 
 	openaiClient := openai.NewClient(
@@ -84,7 +109,11 @@ func main() {
 	)
 
 	agentServer := newAgentToolServer(logger, &openaiClient, cfg)
-	go agentServer.Run(ctx)
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		agentServer.Run(ctx, announce)
+	}()
 
 	wrapper := NewAgentWrapper(&openaiClient, cfg, disc, logger, mcpClient)
 	go wrapper.Run(ctx)
@@ -95,6 +124,7 @@ func main() {
 	)
 
 	<-ctx.Done()
+	<-serverDone
 	logger.Info("agent wrapper stopped")
 }
 
@@ -130,6 +160,12 @@ func (a *AgentWrapper) Run(ctx context.Context) {
 			if !ok {
 				return
 			}
+			if evt.Type == discovery.EventResync {
+				for _, e := range discovery.ResyncEvents(state, evt) {
+					a.handleEvent(ctx, e, state)
+				}
+				continue
+			}
 			a.handleEvent(ctx, evt, state)
 		case <-ticker.C:
 			a.logSummary(state)
@@ -156,10 +192,23 @@ func (a *AgentWrapper) handleEvent(ctx context.Context, evt discovery.Event, sta
 	if api := info.Text["api_model"]; api != "" {
 		fields = append(fields, "api_model", api)
 	}
+	if info.Signature != "" {
+		fields = append(fields, "signature", info.Signature)
+	}
+	if len(evt.Changes) > 0 {
+		fields = append(fields, "changed", discovery.ChangedKeys(evt.Changes))
+	}
 	if len(info.Text) > 0 {
 		fields = append(fields, "meta", info.Text)
 	}
 
+	if evt.Type == discovery.EventConflict {
+		a.logger.Warn("instance name conflict; keeping the current server",
+			append(fields, "rival_address", evt.Rival.Address, "rival_source", evt.Rival.Source)...)
+		state[info.Instance] = info
+		return
+	}
+
 	switch info.Kind {
 	case discovery.ServerKindOrchestrator:
 		a.logOrchestratorEvent(evt.Type, fields, state, info)
@@ -251,6 +300,17 @@ func hasHTTPGet(tools []mcp.ToolDefinition) bool {
 	return false
 }
 
+const (
+	// TXT keys carrying the wrapper's status.
+	inFlightKey = "inflight"
+	readyKey    = "ready"
+
+	// statusInterval spaces status re-announcements; unchanged status is not re-sent.
+	statusInterval = time.Second
+	// readinessInterval is how often the backend is probed for readiness.
+	readinessInterval = 30 * time.Second
+)
+
 type agentToolServer struct {
 	logger      *log.Logger
 	client      *openai.Client
@@ -258,6 +318,10 @@ type agentToolServer struct {
 	toolName    string
 	description string
 	parameters  map[string]any
+
+	// inFlight counts calls being served; ready is whether the backend last answered.
+	inFlight atomic.Int64
+	ready    atomic.Bool
 }
 
 func newAgentToolServer(logger *log.Logger, client *openai.Client, cfg config.Config) *agentToolServer {
@@ -303,109 +367,169 @@ func newAgentToolServer(logger *log.Logger, client *openai.Client, cfg config.Co
 	}
 }
 
-func (s *agentToolServer) Run(ctx context.Context) {
+// Run serves the agent tool, announcing the wrapper when advertising is enabled.
+func (s *agentToolServer) Run(ctx context.Context, announce *discovery.AnnounceOptions) {
 	if s.cfg.Port <= 0 {
 		s.logger.Warn("agent tool server disabled: no port configured")
 		return
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("GET /healthz", s.handleHealthz)
-	mux.HandleFunc("GET /tools/list", s.handleListTools)
-	mux.HandleFunc("POST /tools/call", s.handleCallTool)
-
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.cfg.Port),
-		Handler: toolLoggingMiddleware(s.logger, mux),
+	srv := server.New(server.Options{
+		Name:         s.cfg.Instance,
+		Instructions: s.description,
+		Port:         s.cfg.Port,
+		Logger:       s.logger,
+		Announce:     announce,
+	})
+	server.AddTool(srv, server.Tool{
+		Name:        s.toolName,
+		Description: s.description,
+		Parameters:  s.parameters,
+		// A backend completion has no side effects outside the call.
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint:  mcp.Hint(true),
+			OpenWorldHint: mcp.Hint(false),
+		},
+	}, s.handleCall)
+	if announce != nil {
+		srv.UpdateAnnouncement(s.status())
+		go s.publishStatus(ctx, srv)
 	}
 
-	go func() {
-		<-ctx.Done()
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := server.Shutdown(shutdownCtx); err != nil {
-			s.logger.Warn("agent tool server shutdown error", "error", err)
-		}
-	}()
-
-	s.logger.Info("agent tool server listening",
-		"addr", server.Addr,
+	s.logger.Info("agent tool server starting",
+		"port", s.cfg.Port,
 		"tool", s.toolName,
 		"description", s.description,
 	)
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := srv.Run(ctx); err != nil {
 		s.logger.Error("agent tool server error", "error", err)
 	}
 }
 
-func (s *agentToolServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, map[string]string{"status": "ok"}, http.StatusOK)
+// status is the TXT record fragment advertising load and readiness.
+func (s *agentToolServer) status() map[string]string {
+	return map[string]string{
+		inFlightKey: strconv.FormatInt(s.inFlight.Load(), 10),
+		readyKey:    strconv.FormatBool(s.ready.Load()),
+	}
 }
 
-func (s *agentToolServer) handleListTools(w http.ResponseWriter, r *http.Request) {
-	payload := struct {
-		Tools []mcp.ToolDefinition `json:"tools"`
-	}{
-		Tools: []mcp.ToolDefinition{
-			{
-				Name:        s.toolName,
-				Description: s.description,
-				Parameters:  s.parameters,
-			},
-		},
+// publishStatus probes the backend and keeps the announced status current until ctx ends.
+func (s *agentToolServer) publishStatus(ctx context.Context, srv *server.Server) {
+	s.probeBackend(ctx)
+	srv.UpdateAnnouncement(s.status())
+
+	publish := time.NewTicker(statusInterval)
+	defer publish.Stop()
+	probe := time.NewTicker(readinessInterval)
+	defer probe.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-probe.C:
+			s.probeBackend(ctx)
+		case <-publish.C:
+		}
+		srv.UpdateAnnouncement(s.status())
 	}
-	writeJSON(w, payload, http.StatusOK)
 }
 
-func (s *agentToolServer) handleCallTool(w http.ResponseWriter, r *http.Request) {
-	var req agentToolCallRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, err)
+// probeBackend lists the backend's models to learn whether it is reachable, logging
+// changes in readiness.
+func (s *agentToolServer) probeBackend(ctx context.Context) {
+	probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.client.Models.List(probeCtx)
+	if ctx.Err() != nil {
+		// Shutting down; the failure says nothing about the backend.
 		return
 	}
-	if strings.TrimSpace(req.Prompt) == "" && len(req.Messages) == 0 {
-		writeError(w, http.StatusBadRequest, errors.New("prompt or messages are required"))
+	ready := err == nil
+	if s.ready.Swap(ready) == ready {
 		return
 	}
+	if ready {
+		s.logger.Info("backend ready", "base_url", s.cfg.BaseURL)
+	} else {
+		s.logger.Warn("backend not ready", "base_url", s.cfg.BaseURL, "error", err)
+	}
+}
+
+func (s *agentToolServer) handleCall(ctx context.Context, call *server.Call, in agentToolInput) (any, error) {
+	s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+
+	if strings.TrimSpace(in.Prompt) == "" && len(in.Messages) == 0 {
+		return nil, server.InvalidArguments(errors.New("prompt or messages are required"))
+	}
 
 	params := openai.ChatCompletionNewParams{
 		Model:    s.cfg.BackendModel,
-		Messages: buildAgentToolMessages(s.description, req.Messages, req.Prompt),
+		Messages: buildAgentToolMessages(s.description, in.Messages, in.Prompt),
 	}
 
-	resp, err := s.client.Chat.Completions.New(r.Context(), params)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		return
+	var (
+		resp *openai.ChatCompletion
+		err  error
+	)
+	if call.Streaming() {
+		resp, err = s.completeStreaming(ctx, params, call)
+	} else {
+		resp, err = s.client.Chat.Completions.New(ctx, params)
 	}
-	if resp == nil || len(resp.Choices) == 0 {
-		writeError(w, http.StatusInternalServerError, errors.New("empty response from provider"))
-		return
+	if err == nil && (resp == nil || len(resp.Choices) == 0) {
+		err = errors.New("empty response from provider")
+	}
+	if err != nil {
+		return nil, err
 	}
 	choice := resp.Choices[0]
 
-	result := map[string]any{
+	s.logger.Info("agent tool invocation complete",
+		"tool", s.toolName,
+		"streamed", call.Streaming(),
+		"prompt_tokens", resp.Usage.PromptTokens,
+		"completion_tokens", resp.Usage.CompletionTokens,
+	)
+
+	return map[string]any{
 		"content":            choice.Message.Content,
 		"model":              s.cfg.BackendModel,
 		"prompt_tokens":      resp.Usage.PromptTokens,
 		"completion_tokens":  resp.Usage.CompletionTokens,
 		"total_tokens":       resp.Usage.TotalTokens,
-		"messages_submitted": len(req.Messages) + 1,
-	}
-
-	writeJSON(w, map[string]any{
-		"tool":   s.toolName,
-		"result": result,
-	}, http.StatusOK)
+		"messages_submitted": len(in.Messages) + 1,
+	}, nil
+}
 
-	s.logger.Info("agent tool invocation complete",
-		"tool", s.toolName,
-		"prompt_tokens", resp.Usage.PromptTokens,
-		"completion_tokens", resp.Usage.CompletionTokens,
-	)
+// completeStreaming runs the backend completion as a stream, relaying each content delta to
+// the caller as partial output so long generations stay visible and keep the call alive.
+func (s *agentToolServer) completeStreaming(ctx context.Context, params openai.ChatCompletionNewParams, call *server.Call) (*openai.ChatCompletion, error) {
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	completion := s.client.Chat.Completions.NewStreaming(ctx, params)
+	defer completion.Close()
+
+	acc := openai.ChatCompletionAccumulator{}
+	chunks := 0
+	for completion.Next() {
+		chunk := completion.Current()
+		acc.AddChunk(chunk)
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			chunks++
+			call.Partial(float64(chunks), choice.Delta.Content)
+		}
+	}
+	if err := completion.Err(); err != nil {
+		return nil, err
+	}
+	return &acc.ChatCompletion, nil
 }
 
-type agentToolCallRequest struct {
+type agentToolInput struct {
 	Prompt   string              `json:"prompt"`
 	Messages []types.ChatMessage `json:"messages"`
 }
@@ -420,20 +544,6 @@ func sanitizeToolName(instance string) string {
 	return fmt.Sprintf("agent_%s", s)
 }
 
-func toolLoggingMiddleware(logger *log.Logger, next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
-		next.ServeHTTP(rec, r)
-		logger.Debug("agent tool request",
-			"method", r.Method,
-			"path", r.URL.Path,
-			"status", rec.status,
-			"duration_ms", time.Since(start).Milliseconds(),
-		)
-	})
-}
-
 func buildAgentToolMessages(description string, history []types.ChatMessage, prompt string) []openai.ChatCompletionMessageParamUnion {
 	result := make([]openai.ChatCompletionMessageParamUnion, 0, len(history)+2)
 	if strings.TrimSpace(description) != "" {
@@ -476,31 +586,6 @@ func buildToolDescription(userDescription, modelName string) string {
 	return strings.Join(parts, " ")
 }
 
-type statusRecorder struct {
-	http.ResponseWriter
-	status int
-}
-
-func (r *statusRecorder) WriteHeader(code int) {
-	r.status = code
-	r.ResponseWriter.WriteHeader(code)
-}
-
-func writeJSON(w http.ResponseWriter, payload any, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(payload)
-}
-
-func writeError(w http.ResponseWriter, status int, err error) {
-	writeJSON(w, map[string]any{
-		"error": map[string]any{
-			"message": err.Error(),
-			"code":    status,
-		},
-	}, status)
-}
-
 func (a *AgentWrapper) logGenericEvent(eventType discovery.EventType, fields []any, state map[string]*discovery.ServerInfo, info *discovery.ServerInfo) {
 	switch eventType {
 	case discovery.EventAdded:
@@ -540,3 +625,58 @@ func (a *AgentWrapper) logSummary(state map[string]*discovery.ServerInfo) {
 		"tools", tools,
 	)
 }
+
+// discoveryProviders returns the configured discovery sources in precedence order: the
+// file, DNS-SD, then mDNS.
+func discoveryProviders(cfg config.Config, logger *log.Logger) []discovery.Provider {
+	providers := make([]discovery.Provider, 0, 3)
+	if cfg.DiscoveryFile != "" {
+		providers = append(providers, discovery.NewFileProvider(discovery.FileOptions{
+			Path:   cfg.DiscoveryFile,
+			Logger: logger,
+		}))
+	}
+	if cfg.DNSSDDomain != "" {
+		providers = append(providers, discovery.NewDNSSDProvider(discovery.DNSSDOptions{
+			Server: cfg.DNSSDServer,
+			Domain: cfg.DNSSDDomain,
+			Logger: logger,
+		}))
+	}
+	if cfg.MDNSBrowse {
+		providers = append(providers, discovery.NewMDNSProvider(discovery.MDNSOptions{Logger: logger}))
+	}
+	if len(providers) == 0 {
+		logger.Warn("no discovery providers configured; no servers will be found")
+	}
+	return providers
+}
+
+// announcementSigning returns the signer for this process's announcements and the
+// verifier for everyone else's; either may be nil when not configured.
+func announcementSigning(cfg config.Config, logger *log.Logger) (*discovery.Signer, *discovery.Verifier, error) {
+	signer, err := discovery.LoadSigner(cfg.SigningKeyFile, cfg.MeshSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy, err := discovery.ParseSignaturePolicy(cfg.SignaturePolicy)
+	if err != nil || policy == discovery.SignatureOff {
+		return signer, nil, err
+	}
+	opts := discovery.VerifierOptions{
+		Secret: []byte(cfg.MeshSecret),
+		MaxAge: cfg.SignatureMaxAge,
+		Policy: policy,
+		Logger: logger,
+	}
+	if cfg.TrustedKeysFile != "" {
+		if opts.PublicKeys, err = discovery.LoadEd25519PublicKeys(cfg.TrustedKeysFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	verifier, err := discovery.NewVerifier(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, verifier, nil
+}
@@ -14,12 +14,16 @@ import (
 	openai "github.com/openai/openai-go"
 	oaioption "github.com/openai/openai-go/option"
 
+	"go.mcpwrapper/internal/admin"
 	"go.mcpwrapper/internal/api"
+	"go.mcpwrapper/internal/apikey"
 	"go.mcpwrapper/internal/config"
 	"go.mcpwrapper/internal/discovery"
 	"go.mcpwrapper/internal/logging"
 	"go.mcpwrapper/internal/mcp"
 	"go.mcpwrapper/internal/mediator"
+	"go.mcpwrapper/internal/ratelimit"
+	"go.mcpwrapper/internal/sampling"
 )
 
 func main() {
@@ -41,42 +45,160 @@ func main() {
 		"instance", cfg.Instance,
 		"role", cfg.Role,
 		"description", cfg.Description,
+		"destructive_tools", cfg.DestructiveTools,
+		"tool_retries", cfg.ToolRetries,
+		"read_only_tools", cfg.ReadOnlyTools,
 	)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	mcpClient := mcp.NewClient(mcp.Options{})
-
 	openaiClient := openai.NewClient(
 		oaioption.WithBaseURL(cfg.BaseURL),
 		oaioption.WithAPIKey(cfg.APIKey),
 	)
 
-	disc := discovery.New(discovery.Options{})
+	var samplingHandler mcp.SamplingHandler
+	if cfg.SamplingEnabled {
+		handler, err := newSamplingHandler(cfg, &openaiClient, logger)
+		if err != nil {
+			logger.Error("sampling configuration error", "error", err)
+			os.Exit(1)
+		}
+		samplingHandler = handler
+		logger.Info("sampling enabled",
+			"max_tokens", cfg.SamplingMaxTokens,
+			"token_quota", cfg.SamplingTokenQuota,
+			"policy_file", cfg.SamplingPolicyFile,
+		)
+	}
+
+	auth, err := loadMCPAuth(cfg, logger)
+	if err != nil {
+		logger.Error("mcp auth configuration error", "error", err)
+		os.Exit(1)
+	}
+	mcpClient := mcp.NewClient(mcp.Options{Sampling: samplingHandler, Auth: auth})
+
+	var registry *discovery.Registry
+	if cfg.Registry {
+		registry = discovery.NewRegistry(discovery.RegistryOptions{Token: cfg.RegistryToken, Logger: logger})
+		if cfg.RegistryToken == "" {
+			logger.Warn("registry enabled without REGISTRY_TOKEN; any host can register servers")
+		}
+	}
+	selector, err := discovery.ParseSelector(cfg.Selector)
+	if err != nil {
+		logger.Error("configuration error", "error", err)
+		os.Exit(1)
+	}
+	if !selector.Empty() {
+		logger.Info("discovery limited by selector", "selector", selector)
+	}
+	signer, verifier, err := announcementSigning(cfg, logger)
+	if err != nil {
+		logger.Error("signature configuration error", "error", err)
+		os.Exit(1)
+	}
+	if verifier != nil {
+		logger.Info("verifying announcement signatures", "policy", verifier.Policy())
+	}
+	disc := discovery.New(discovery.Options{
+		Providers:    discoveryProviders(cfg, registry, logger),
+		Selector:     selector,
+		Verifier:     verifier,
+		SnapshotFile: cfg.SnapshotFile,
+		Logger:       logger,
+	})
 	if err := disc.Start(ctx); err != nil {
 		logger.Error("failed to start discovery", "error", err)
 		os.Exit(1)
 	}
 	defer disc.Stop()
 
+	if cfg.HealthInterval > 0 {
+		checker := discovery.NewHealthChecker(disc, discovery.HealthOptions{
+			Probe:              mcpClient.Ping,
+			Kinds:              []string{discovery.ServerKindTool, discovery.ServerKindAgentWrapper},
+			Interval:           cfg.HealthInterval,
+			HealthyThreshold:   cfg.HealthHealthyThreshold,
+			UnhealthyThreshold: cfg.HealthUnhealthyThreshold,
+			Logger:             logger,
+		})
+		go checker.Run(ctx)
+	}
+
 	eventsCh := disc.Subscribe(64)
 	defer disc.Unsubscribe(eventsCh)
 	go monitorDiscovery(ctx, logger, eventsCh, mcpClient)
 
+	destructive, err := mediator.ParseDestructivePolicy(cfg.DestructiveTools)
+	if err != nil {
+		logger.Error("configuration error", "error", err)
+		os.Exit(1)
+	}
+
+	var limits ratelimit.Policy
+	if cfg.LimitsFile != "" {
+		if limits, err = ratelimit.LoadPolicy(cfg.LimitsFile); err != nil {
+			logger.Error("limits configuration error", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("limits loaded", "file", cfg.LimitsFile)
+	}
+
 	med := mediator.New(disc, mediator.Options{
 		ModelName:     cfg.APIModel,
 		ProviderModel: cfg.BackendModel,
 		OpenAIClient:  &openaiClient,
-		AllowedKinds:  []string{discovery.ServerKindTool, discovery.ServerKindAgentWrapper},
+		Selector:      discovery.MustParseSelector("kind in (tool, agent-wrapper)"),
 		ToolClient:    mcpClient,
+		Destructive:   destructive,
+		ToolRetries:   cfg.ToolRetries,
+		ReadOnlyTools: cfg.ReadOnlyTools,
+		Limits:        limits,
+		Logger:        logger,
 	})
+	disc.Persist("tools", med)
+	go med.Watch(ctx)
+
+	keys, err := apikey.Load(cfg.APIKeysFile, cfg.APIKeys)
+	if err != nil {
+		logger.Error("api key configuration error", "error", err)
+		os.Exit(1)
+	}
+	if keys.Len() == 0 {
+		logger.Warn("no API keys configured; the API accepts unauthenticated requests")
+	} else {
+		logger.Info("api keys loaded", "keys", keys.Len())
+	}
+
+	handler := api.NewServer(med, api.Options{Keys: keys, Limits: limits, Logger: logger})
 
-	handler := api.NewServer(med)
+	mux := http.NewServeMux()
+	mux.Handle("/", handler.Handler())
+	if registry != nil {
+		mux.Handle(discovery.RegistryPath, registry)
+		mux.Handle(discovery.RegistryPath+"/", registry)
+	}
+	if cfg.AdminToken != "" {
+		adminHandler, err := admin.New(admin.Options{
+			Token:    cfg.AdminToken,
+			Mesh:     disc,
+			Mediator: med,
+			Logger:   logger,
+		})
+		if err != nil {
+			logger.Error("admin configuration error", "error", err)
+			os.Exit(1)
+		}
+		mux.Handle("/admin/", adminHandler)
+		logger.Info("admin API enabled")
+	}
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: handler.Handler(),
+		Handler: mux,
 	}
 
 	var announcer *discovery.Announcer
@@ -90,9 +212,15 @@ func main() {
 			text["description"] = cfg.Description
 		}
 		announcer, err = discovery.NewAnnouncer(discovery.AnnounceOptions{
-			Instance: cfg.Instance,
-			Port:     cfg.Port,
-			Text:     text,
+			Instance:      cfg.Instance,
+			Port:          cfg.Port,
+			Text:          text,
+			Labels:        cfg.Labels,
+			Signer:        signer,
+			Registries:    cfg.RegistryURLs,
+			RegistryToken: cfg.RegistryToken,
+			Address:       cfg.AdvertiseAddress,
+			Logger:        logger,
 		})
 		if err != nil {
 			logger.Error("failed to announce orchestrator", "error", err)
@@ -125,6 +253,42 @@ func main() {
 	logger.Info("API server stopped")
 }
 
+// loadMCPAuth reads outbound MCP credentials when an auth file is configured.
+func loadMCPAuth(cfg config.Config, logger *log.Logger) (*mcp.Auth, error) {
+	if cfg.MCPAuthFile == "" {
+		return nil, nil
+	}
+	auth, err := mcp.LoadAuth(cfg.MCPAuthFile)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("mcp credentials loaded", "file", cfg.MCPAuthFile)
+	return auth, nil
+}
+
+func newSamplingHandler(cfg config.Config, client *openai.Client, logger *log.Logger) (*sampling.Handler, error) {
+	base := sampling.Policy{
+		Enabled:    true,
+		MaxTokens:  cfg.SamplingMaxTokens,
+		TokenQuota: cfg.SamplingTokenQuota,
+	}
+	var servers map[string]sampling.Policy
+	if cfg.SamplingPolicyFile != "" {
+		def, policies, err := sampling.LoadPolicies(cfg.SamplingPolicyFile, base)
+		if err != nil {
+			return nil, err
+		}
+		base, servers = def, policies
+	}
+	return sampling.New(sampling.Options{
+		Client:  client,
+		Model:   cfg.BackendModel,
+		Default: base,
+		Servers: servers,
+		Logger:  logger,
+	}), nil
+}
+
 func monitorDiscovery(ctx context.Context, logger *log.Logger, ch <-chan discovery.Event, toolClient *mcp.Client) {
 	state := make(map[string]*discovery.ServerInfo)
 	ticker := time.NewTicker(30 * time.Second)
@@ -138,6 +302,12 @@ func monitorDiscovery(ctx context.Context, logger *log.Logger, ch <-chan discove
 			if !ok {
 				return
 			}
+			if evt.Type == discovery.EventResync {
+				for _, e := range discovery.ResyncEvents(state, evt) {
+					handleEvent(ctx, logger, state, e, toolClient)
+				}
+				continue
+			}
 			handleEvent(ctx, logger, state, evt, toolClient)
 		case <-ticker.C:
 			logSummary(logger, state)
@@ -164,10 +334,31 @@ func handleEvent(ctx context.Context, logger *log.Logger, state map[string]*disc
 	if api := info.Text["api_model"]; api != "" {
 		fields = append(fields, "api_model", api)
 	}
+	if info.Signature != "" {
+		fields = append(fields, "signature", info.Signature)
+	}
+	if len(evt.Changes) > 0 {
+		fields = append(fields, "changed", discovery.ChangedKeys(evt.Changes))
+	}
+	if info.Unverified() {
+		fields = append(fields, "unverified", true)
+	}
 	if len(info.Text) > 0 {
 		fields = append(fields, "meta", info.Text)
 	}
 
+	if evt.Type == discovery.EventConflict {
+		logger.Warn("instance name conflict; keeping the current server",
+			append(fields, "rival_address", evt.Rival.Address, "rival_source", evt.Rival.Source)...)
+		state[info.Instance] = info
+		return
+	}
+	if evt.Type == discovery.EventHealthChanged {
+		// The health checker logs transitions with the probe error.
+		state[info.Instance] = info
+		return
+	}
+
 	switch info.Kind {
 	case discovery.ServerKindAgentWrapper:
 		handleAgentWrapperEvent(logger, state, evt.Type, info, fields)
@@ -277,3 +468,61 @@ func logSummary(logger *log.Logger, state map[string]*discovery.ServerInfo) {
 		"other", other,
 	)
 }
+
+// discoveryProviders returns the configured discovery sources in precedence order: the
+// file, HTTP registrations, DNS-SD, then mDNS.
+func discoveryProviders(cfg config.Config, registry *discovery.Registry, logger *log.Logger) []discovery.Provider {
+	providers := make([]discovery.Provider, 0, 4)
+	if cfg.DiscoveryFile != "" {
+		providers = append(providers, discovery.NewFileProvider(discovery.FileOptions{
+			Path:   cfg.DiscoveryFile,
+			Logger: logger,
+		}))
+	}
+	if registry != nil {
+		providers = append(providers, registry)
+	}
+	if cfg.DNSSDDomain != "" {
+		providers = append(providers, discovery.NewDNSSDProvider(discovery.DNSSDOptions{
+			Server: cfg.DNSSDServer,
+			Domain: cfg.DNSSDDomain,
+			Logger: logger,
+		}))
+	}
+	if cfg.MDNSBrowse {
+		providers = append(providers, discovery.NewMDNSProvider(discovery.MDNSOptions{Logger: logger}))
+	}
+	if len(providers) == 0 {
+		logger.Warn("no discovery providers configured; only servers added through the admin API are used")
+	}
+	return providers
+}
+
+// announcementSigning returns the signer for this process's announcements and the
+// verifier for everyone else's; either may be nil when not configured.
+func announcementSigning(cfg config.Config, logger *log.Logger) (*discovery.Signer, *discovery.Verifier, error) {
+	signer, err := discovery.LoadSigner(cfg.SigningKeyFile, cfg.MeshSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy, err := discovery.ParseSignaturePolicy(cfg.SignaturePolicy)
+	if err != nil || policy == discovery.SignatureOff {
+		return signer, nil, err
+	}
+	opts := discovery.VerifierOptions{
+		Secret: []byte(cfg.MeshSecret),
+		MaxAge: cfg.SignatureMaxAge,
+		Policy: policy,
+		Logger: logger,
+	}
+	if cfg.TrustedKeysFile != "" {
+		if opts.PublicKeys, err = discovery.LoadEd25519PublicKeys(cfg.TrustedKeysFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	verifier, err := discovery.NewVerifier(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, verifier, nil
+}
@@ -1,11 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	log "github.com/charmbracelet/log"
 	"io"
 	"net/http"
 	"net/url"
@@ -15,9 +14,13 @@ import (
 	"syscall"
 	"time"
 
+	log "github.com/charmbracelet/log"
+
 	"go.mcpwrapper/internal/config"
 	"go.mcpwrapper/internal/discovery"
 	"go.mcpwrapper/internal/logging"
+	"go.mcpwrapper/internal/mcp"
+	"go.mcpwrapper/internal/mcp/server"
 )
 
 func main() {
@@ -39,83 +42,67 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	mux := http.NewServeMux()
-	server := newToolServer(logger)
-	server.register(mux)
-	logger.Info("tools registered", "tools", server.toolNames())
-
-	httpServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: loggingMiddleware(logger, mux),
+	opts := server.Options{
+		Name:   cfg.Instance,
+		Port:   cfg.Port,
+		Logger: logger,
 	}
-
-	var announcer *discovery.Announcer
 	if cfg.Advertise {
-		text := map[string]string{
-			"role": cfg.Role,
-		}
-		announcer, err = discovery.NewAnnouncer(discovery.AnnounceOptions{
-			Instance: cfg.Instance,
-			Port:     cfg.Port,
-			Text:     text,
-		})
+		signer, err := discovery.LoadSigner(cfg.SigningKeyFile, cfg.MeshSecret)
 		if err != nil {
-			logger.Error("failed to announce tool server", "error", err)
+			logger.Error("signature configuration error", "error", err)
 			os.Exit(1)
 		}
-		defer announcer.Stop()
-	}
-
-	go func() {
-		<-ctx.Done()
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			logger.Error("http shutdown error", "error", err)
+		opts.Announce = &discovery.AnnounceOptions{
+			Instance:      cfg.Instance,
+			Text:          map[string]string{"role": cfg.Role},
+			Labels:        cfg.Labels,
+			Signer:        signer,
+			Registries:    cfg.RegistryURLs,
+			RegistryToken: cfg.RegistryToken,
+			Address:       cfg.AdvertiseAddress,
+			Logger:        logger,
 		}
-	}()
+	}
+	srv := server.New(opts)
+	newHTTPTools(logger).register(srv)
+	logger.Info("tools registered", "tools", srv.ToolNames())
 
-	logger.Info("HTTP tools MCP server starting",
-		"addr", httpServer.Addr,
-		"advertise", cfg.Advertise,
-		"role", cfg.Role,
-	)
-	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := srv.Run(ctx); err != nil {
 		logger.Error("server error", "error", err)
 		os.Exit(1)
 	}
 	logger.Info("HTTP tools MCP server stopped")
 }
 
-type toolServer struct {
+type httpTools struct {
 	logger     *log.Logger
 	httpClient *http.Client
-	tools      []toolDefinition
 }
 
-func newToolServer(logger *log.Logger) *toolServer {
-	return &toolServer{
+func newHTTPTools(logger *log.Logger) *httpTools {
+	return &httpTools{
 		logger: logger,
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second,
 		},
-		tools: []toolDefinition{
-			makeToolDefinition(http.MethodGet),
-			makeToolDefinition(http.MethodPost),
-			makeToolDefinition(http.MethodPut),
-			makeToolDefinition(http.MethodPatch),
-			makeToolDefinition(http.MethodDelete),
-		},
 	}
 }
 
-func makeToolDefinition(method string) toolDefinition {
+func (t *httpTools) register(srv *server.Server) {
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		server.AddTool(srv, makeToolDefinition(method), t.handler(method))
+	}
+}
+
+func makeToolDefinition(method string) server.Tool {
 	description := fmt.Sprintf("Performs an HTTP %s request to a target URL.", strings.ToUpper(method))
-	return toolDefinition{
+	return server.Tool{
 		Name:        fmt.Sprintf("http_%s", strings.ToLower(method)),
+		Title:       fmt.Sprintf("HTTP %s", strings.ToUpper(method)),
 		Description: description,
-		Method:      method,
-		Parameters: toolParameters{
+		Annotations: methodAnnotations(method),
+		Parameters: map[string]any{
 			"type": "object",
 			"properties": map[string]any{
 				"url": map[string]any{
@@ -139,102 +126,92 @@ func makeToolDefinition(method string) toolDefinition {
 	}
 }
 
-func (s *toolServer) register(mux *http.ServeMux) {
-	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
-		writeJSON(w, map[string]string{"status": "ok"}, http.StatusOK)
-	})
-
-	mux.HandleFunc("GET /tools/list", s.handleListTools)
-	mux.HandleFunc("POST /tools/call", s.handleCallTool)
-}
-
-func (s *toolServer) handleListTools(w http.ResponseWriter, r *http.Request) {
-	response := struct {
-		Tools []toolDefinition `json:"tools"`
-	}{
-		Tools: s.tools,
+// methodAnnotations describes each HTTP verb's semantics as MCP tool hints: GET only reads,
+// PUT and DELETE are idempotent but overwrite or remove state, POST and PATCH are neither.
+func methodAnnotations(method string) *mcp.ToolAnnotations {
+	a := &mcp.ToolAnnotations{
+		Title:         fmt.Sprintf("HTTP %s", strings.ToUpper(method)),
+		OpenWorldHint: mcp.Hint(true),
 	}
-	writeJSON(w, response, http.StatusOK)
-}
-
-func (s *toolServer) handleCallTool(w http.ResponseWriter, r *http.Request) {
-	var req toolCallRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, err)
-		return
-	}
-
-	def, err := s.lookupTool(req.Name)
-	if err != nil {
-		writeError(w, http.StatusNotFound, err)
-		return
-	}
-
-	target, err := extractString(req.Arguments, "url")
-	if err != nil {
-		writeError(w, http.StatusBadRequest, err)
-		return
-	}
-
-	start := time.Now()
-	ctx := r.Context()
-	res, err := s.executeHTTPRequest(ctx, def.Method, target, req.Arguments)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, err)
-		return
+	switch method {
+	case http.MethodGet:
+		a.ReadOnlyHint = mcp.Hint(true)
+	case http.MethodPut, http.MethodDelete:
+		a.DestructiveHint = mcp.Hint(true)
+		a.IdempotentHint = mcp.Hint(true)
+	case http.MethodPost:
+		a.DestructiveHint = mcp.Hint(false)
+		a.IdempotentHint = mcp.Hint(false)
+	default:
+		a.DestructiveHint = mcp.Hint(true)
+		a.IdempotentHint = mcp.Hint(false)
 	}
+	return a
+}
 
-	s.logger.Info("tool invocation complete",
-		"tool", req.Name,
-		"method", def.Method,
-		"url", target,
-		"status", res.Status,
-		"duration_ms", time.Since(start).Milliseconds(),
-	)
+// httpToolArgs are the arguments shared by every http_* tool.
+type httpToolArgs struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
 
-	writeJSON(w, map[string]any{
-		"tool":   req.Name,
-		"result": res,
-	}, http.StatusOK)
+type httpToolResult struct {
+	Status     int                 `json:"status"`
+	StatusText string              `json:"status_text"`
+	Headers    map[string][]string `json:"headers"`
+	Body       string              `json:"body"`
 }
 
-func (s *toolServer) lookupTool(name string) (toolDefinition, error) {
-	for _, tool := range s.tools {
-		if tool.Name == name {
-			return tool, nil
+func (t *httpTools) handler(method string) func(context.Context, *server.Call, httpToolArgs) (any, error) {
+	return func(ctx context.Context, call *server.Call, args httpToolArgs) (any, error) {
+		if _, err := url.ParseRequestURI(args.URL); err != nil {
+			return nil, server.InvalidArguments(fmt.Errorf("invalid url: %w", err))
 		}
+		res, err := t.executeHTTPRequest(ctx, method, args, call.Progress)
+		if err != nil {
+			return nil, &server.Error{Status: http.StatusBadRequest, Err: err}
+		}
+		t.logger.Debug("http request complete",
+			"method", method,
+			"url", args.URL,
+			"status", res.Status,
+		)
+		return res, nil
 	}
-	return toolDefinition{}, fmt.Errorf("tool %q not found", name)
 }
 
-func (s *toolServer) executeHTTPRequest(ctx context.Context, method string, target string, args map[string]any) (httpToolResult, error) {
-	if _, err := url.ParseRequestURI(target); err != nil {
-		return httpToolResult{}, fmt.Errorf("invalid url: %w", err)
-	}
+// progressFunc reports execution progress back to the caller when it asked for it.
+type progressFunc func(progress, total float64, message string)
 
-	headers := extractStringMap(args, "headers")
-	body := extractOptionalString(args, "body")
+func (t *httpTools) executeHTTPRequest(ctx context.Context, method string, args httpToolArgs, report progressFunc) (httpToolResult, error) {
 	var bodyReader io.Reader
-	if body != "" && method != http.MethodGet && method != http.MethodDelete {
-		bodyReader = strings.NewReader(body)
+	if args.Body != "" && method != http.MethodGet && method != http.MethodDelete {
+		bodyReader = strings.NewReader(args.Body)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, target, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, args.URL, bodyReader)
 	if err != nil {
 		return httpToolResult{}, fmt.Errorf("build request: %w", err)
 	}
-	for key, value := range headers {
+	for key, value := range args.Headers {
 		req.Header.Set(key, value)
 	}
 
-	resp, err := s.httpClient.Do(req)
+	report(0, 0, fmt.Sprintf("sending %s %s", method, args.URL))
+	resp, err := t.httpClient.Do(req)
 	if err != nil {
 		return httpToolResult{}, fmt.Errorf("http %s request failed: %w", method, err)
 	}
 	defer resp.Body.Close()
 
 	const maxBytes = 1 << 20 // 1 MiB
-	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes))
+	total := float64(0)
+	if resp.ContentLength > 0 {
+		total = float64(min(resp.ContentLength, maxBytes))
+	}
+	report(0, total, fmt.Sprintf("received %s, reading body", resp.Status))
+	bodyBytes, err := readWithProgress(io.LimitReader(resp.Body, maxBytes), total, report)
 	if err != nil {
 		return httpToolResult{}, fmt.Errorf("read response body: %w", err)
 	}
@@ -247,118 +224,26 @@ func (s *toolServer) executeHTTPRequest(ctx context.Context, method string, targ
 	}, nil
 }
 
-type toolDefinition struct {
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	Method      string         `json:"-"`
-	Parameters  toolParameters `json:"parameters"`
-}
-
-type toolParameters map[string]any
-
-type toolCallRequest struct {
-	Name      string         `json:"name"`
-	Arguments map[string]any `json:"arguments"`
-}
-
-type httpToolResult struct {
-	Status     int                 `json:"status"`
-	StatusText string              `json:"status_text"`
-	Headers    map[string][]string `json:"headers"`
-	Body       string              `json:"body"`
-}
-
-func (s *toolServer) toolNames() []string {
-	names := make([]string, 0, len(s.tools))
-	for _, tool := range s.tools {
-		names = append(names, tool.Name)
-	}
-	return names
-}
-
-func extractString(args map[string]any, key string) (string, error) {
-	if args == nil {
-		return "", fmt.Errorf("missing %s", key)
-	}
-	value, ok := args[key]
-	if !ok {
-		return "", fmt.Errorf("missing %s", key)
-	}
-	str, ok := value.(string)
-	if !ok || strings.TrimSpace(str) == "" {
-		return "", fmt.Errorf("%s must be a non-empty string", key)
-	}
-	return str, nil
-}
-
-func extractOptionalString(args map[string]any, key string) string {
-	if args == nil {
-		return ""
-	}
-	if value, ok := args[key]; ok {
-		if str, ok := value.(string); ok {
-			return str
+// readWithProgress reads the body, reporting bytes read roughly every 64 KiB.
+func readWithProgress(r io.Reader, total float64, report progressFunc) ([]byte, error) {
+	const step = 64 << 10
+	var (
+		buf      bytes.Buffer
+		reported int
+	)
+	chunk := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(chunk)
+		buf.Write(chunk[:n])
+		if buf.Len()-reported >= step {
+			reported = buf.Len()
+			report(float64(reported), total, "reading body")
 		}
-	}
-	return ""
-}
-
-func extractStringMap(args map[string]any, key string) map[string]string {
-	result := make(map[string]string)
-	if args == nil {
-		return result
-	}
-	value, ok := args[key]
-	if !ok {
-		return result
-	}
-	rawMap, ok := value.(map[string]any)
-	if !ok {
-		return result
-	}
-	for k, v := range rawMap {
-		if str, ok := v.(string); ok {
-			result[k] = str
+		if errors.Is(err, io.EOF) {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return buf.Bytes(), err
 		}
 	}
-	return result
-}
-
-func writeJSON(w http.ResponseWriter, payload any, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(payload)
-}
-
-func writeError(w http.ResponseWriter, status int, err error) {
-	writeJSON(w, map[string]any{
-		"error": map[string]any{
-			"message": err.Error(),
-			"code":    status,
-		},
-	}, status)
-}
-
-func loggingMiddleware(logger *log.Logger, next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
-		next.ServeHTTP(rec, r)
-		logger.Info("request completed",
-			"method", r.Method,
-			"path", r.URL.Path,
-			"status", rec.status,
-			"duration_ms", time.Since(start).Milliseconds(),
-		)
-	})
-}
-
-type statusRecorder struct {
-	http.ResponseWriter
-	status int
-}
-
-func (r *statusRecorder) WriteHeader(status int) {
-	r.status = status
-	r.ResponseWriter.WriteHeader(status)
 }
@@ -0,0 +1,250 @@
+// Package admin serves the orchestrator's operator endpoints under /admin/: the
+// discovered mesh with health and quarantine state, per-server tool lists, forced
+// re-listing, quarantine, and static servers added at runtime. Every request must carry
+// the admin bearer token.
+package admin
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/charmbracelet/log"
+
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mediator"
+)
+
+// Mesh is the server set the admin API inspects and edits. *discovery.Discovery
+// satisfies it.
+type Mesh interface {
+	ServersSnapshot() map[string]*discovery.ServerInfo
+	AddStatic(info *discovery.ServerInfo) error
+	RemoveStatic(instance string) bool
+	IsStatic(instance string) bool
+}
+
+// Options configure the admin handler.
+type Options struct {
+	// Token is the bearer token required on every request. It must not be empty.
+	Token    string
+	Mesh     Mesh
+	Mediator *mediator.Mediator
+	Logger   *log.Logger
+}
+
+// Handler serves the admin API.
+type Handler struct {
+	token  [sha256.Size]byte
+	mesh   Mesh
+	med    *mediator.Mediator
+	logger *log.Logger
+	mux    *http.ServeMux
+}
+
+// New returns the admin handler. Mount it at /admin/.
+func New(opts Options) (*Handler, error) {
+	if strings.TrimSpace(opts.Token) == "" {
+		return nil, errors.New("admin token is required")
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
+	h := &Handler{
+		token:  sha256.Sum256([]byte(opts.Token)),
+		mesh:   opts.Mesh,
+		med:    opts.Mediator,
+		logger: logger,
+		mux:    http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /admin/servers", h.handleList)
+	h.mux.HandleFunc("POST /admin/servers", h.handleAddStatic)
+	h.mux.HandleFunc("GET /admin/servers/{instance}", h.handleGet)
+	h.mux.HandleFunc("DELETE /admin/servers/{instance}", h.handleRemoveStatic)
+	h.mux.HandleFunc("GET /admin/servers/{instance}/tools", h.handleTools)
+	h.mux.HandleFunc("POST /admin/servers/{instance}/refresh", h.handleRefresh)
+	h.mux.HandleFunc("POST /admin/servers/{instance}/quarantine", h.handleQuarantine)
+	h.mux.HandleFunc("DELETE /admin/servers/{instance}/quarantine", h.handleUnquarantine)
+	return h, nil
+}
+
+// ServeHTTP checks the admin token and dispatches.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	if subtle.ConstantTimeCompare(sum[:], h.token[:]) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-agent-admin"`)
+		writeError(w, http.StatusUnauthorized, errors.New("invalid or missing admin token"))
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// Server is one entry of the mesh as reported by the admin API.
+type Server struct {
+	*discovery.ServerInfo
+	Static bool `json:"static"`
+	mediator.ServerState
+}
+
+func (h *Handler) describe(info *discovery.ServerInfo) Server {
+	return Server{
+		ServerInfo:  info,
+		Static:      h.mesh.IsStatic(info.Instance),
+		ServerState: h.med.ServerState(info.Instance),
+	}
+}
+
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	snapshot := h.mesh.ServersSnapshot()
+	servers := make([]Server, 0, len(snapshot))
+	for _, info := range snapshot {
+		servers = append(servers, h.describe(info))
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Instance < servers[j].Instance
+	})
+	writeJSON(w, map[string]any{"object": "list", "data": servers}, http.StatusOK)
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	info, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, h.describe(info), http.StatusOK)
+}
+
+func (h *Handler) handleTools(w http.ResponseWriter, r *http.Request) {
+	h.writeTools(w, r, false)
+}
+
+func (h *Handler) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	h.logger.Info("admin: re-listing tools", "instance", r.PathValue("instance"))
+	h.writeTools(w, r, true)
+}
+
+func (h *Handler) writeTools(w http.ResponseWriter, r *http.Request, refresh bool) {
+	instance := r.PathValue("instance")
+	tools, err := h.med.ServerTools(r.Context(), instance, refresh)
+	switch {
+	case errors.Is(err, mediator.ErrUnknownServer):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err)
+	default:
+		writeJSON(w, map[string]any{"object": "list", "instance": instance, "data": tools}, http.StatusOK)
+	}
+}
+
+type quarantineRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *Handler) handleQuarantine(w http.ResponseWriter, r *http.Request) {
+	instance := r.PathValue("instance")
+	var req quarantineRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		req.Reason = "quarantined by operator"
+	}
+	h.med.Quarantine(instance, req.Reason)
+	writeJSON(w, h.med.ServerState(instance), http.StatusOK)
+}
+
+func (h *Handler) handleUnquarantine(w http.ResponseWriter, r *http.Request) {
+	instance := r.PathValue("instance")
+	if !h.med.Unquarantine(instance) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s is not quarantined", instance))
+		return
+	}
+	writeJSON(w, h.med.ServerState(instance), http.StatusOK)
+}
+
+// staticRequest adds a server by address. Text carries TXT-style metadata such as role,
+// protocol, path or scheme.
+type staticRequest struct {
+	Instance string `json:"instance"`
+	Address  string `json:"address"`
+	// Addresses are alternatives to Address, tried when it is unreachable.
+	Addresses []string          `json:"addresses"`
+	Host      string            `json:"host"`
+	Port      int               `json:"port"`
+	Text      map[string]string `json:"text"`
+}
+
+func (h *Handler) handleAddStatic(w http.ResponseWriter, r *http.Request) {
+	var req staticRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	info := &discovery.ServerInfo{
+		Instance:  strings.TrimSpace(req.Instance),
+		Address:   strings.TrimSpace(req.Address),
+		Addresses: req.Addresses,
+		Host:      strings.TrimSpace(req.Host),
+		Port:      req.Port,
+		Text:      req.Text,
+		LastSeen:  time.Now(),
+	}
+	if err := h.mesh.AddStatic(info); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.logger.Info("admin: static server added", "instance", info.Instance, "address", info.Address)
+	stored, ok := h.mesh.ServersSnapshot()[info.Instance]
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("static server not stored"))
+		return
+	}
+	writeJSON(w, h.describe(stored), http.StatusCreated)
+}
+
+func (h *Handler) handleRemoveStatic(w http.ResponseWriter, r *http.Request) {
+	instance := r.PathValue("instance")
+	if !h.mesh.RemoveStatic(instance) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s is not a static server", instance))
+		return
+	}
+	h.logger.Info("admin: static server removed", "instance", instance)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) lookup(w http.ResponseWriter, r *http.Request) (*discovery.ServerInfo, bool) {
+	instance := r.PathValue("instance")
+	info, ok := h.mesh.ServersSnapshot()[instance]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", mediator.ErrUnknownServer, instance))
+		return nil, false
+	}
+	return info, true
+}
+
+func writeJSON(w http.ResponseWriter, payload any, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, map[string]any{
+		"error": map[string]any{
+			"message": err.Error(),
+			"type":    http.StatusText(status),
+		},
+	}, status)
+}
@@ -3,23 +3,64 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	log "github.com/charmbracelet/log"
+
+	"go.mcpwrapper/internal/apikey"
 	"go.mcpwrapper/internal/mediator"
+	"go.mcpwrapper/internal/ratelimit"
 	"go.mcpwrapper/internal/types"
 )
 
+// Options configure the API server.
+type Options struct {
+	// Keys, when non-empty, requires every request to carry one of these bearer keys and
+	// applies the key's model, tool and rate limits. Nil leaves the API open.
+	Keys *apikey.Set
+	// Limits throttles chat requests per `user` and per API model. Per-key limits come
+	// from Keys.
+	Limits ratelimit.Policy
+	// Logger receives one line per request, tagged with the caller's key name.
+	// Defaults to discarding.
+	Logger *log.Logger
+}
+
 // Server is the HTTP entry point that mimics the OpenAI chat completions API.
 type Server struct {
-	med *mediator.Mediator
-	mux *http.ServeMux
+	med    *mediator.Mediator
+	mux    *http.ServeMux
+	keys   *apikey.Set
+	limits ratelimit.Policy
+	logger *log.Logger
+
+	keyLimiter   *ratelimit.Limiter
+	userLimiter  *ratelimit.Limiter
+	modelLimiter *ratelimit.Limiter
 }
 
 // NewServer sets up the routing layer.
-func NewServer(med *mediator.Mediator) *Server {
+func NewServer(med *mediator.Mediator, opts Options) *Server {
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
 	s := &Server{
-		med: med,
-		mux: http.NewServeMux(),
+		med:    med,
+		mux:    http.NewServeMux(),
+		keys:   opts.Keys,
+		limits: opts.Limits,
+		logger: logger,
+
+		keyLimiter:   ratelimit.NewLimiter("key"),
+		userLimiter:  ratelimit.NewLimiter("user"),
+		modelLimiter: ratelimit.NewLimiter("model"),
 	}
 	s.routes()
 	return s
@@ -29,6 +70,8 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("GET /v1/models", s.handleModels)
 	s.mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
 	s.mux.HandleFunc("GET /v1/tools", s.handleTools)
+	s.mux.HandleFunc("GET /v1/resources", s.handleResources)
+	s.mux.HandleFunc("GET /v1/prompts", s.handlePrompts)
 }
 
 // Handler exposes the mux for integration with http.Server.
@@ -36,13 +79,88 @@ func (s *Server) Handler() http.Handler {
 	return s
 }
 
-// ServeHTTP delegates to the mux.
+// ServeHTTP authenticates the request, when keys are configured, and delegates to the mux.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	key, ok := s.authenticate(rec, r)
+	if ok && key != nil {
+		release, err := s.keyLimiter.Acquire(key.Name, key.Limit)
+		if err != nil {
+			writeLimited(rec, err)
+			ok = false
+		} else {
+			defer release()
+			r = r.WithContext(apikey.WithKey(r.Context(), key))
+		}
+	}
+	if ok {
+		s.mux.ServeHTTP(rec, r)
+	}
+
+	fields := []any{
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", rec.status,
+		"duration_ms", time.Since(start).Milliseconds(),
+	}
+	if key != nil {
+		fields = append(fields, "key", key.Name)
+	}
+	s.logger.Info("api request", fields...)
+}
+
+// authenticate resolves the caller's key, writing a 401 itself when the request may not
+// proceed. The key is nil when the API is open.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (*apikey.Key, bool) {
+	if s.keys.Len() == 0 {
+		return nil, true
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	key, ok := s.keys.Authenticate(strings.TrimSpace(token))
+	if !found || !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-agent"`)
+		writeError(w, http.StatusUnauthorized, errors.New("invalid or missing API key"))
+		return nil, false
+	}
+	return key, true
+}
+
+// admitChat applies the per-user and per-model limits to a chat request. On refusal it
+// has already written the 429.
+func (s *Server) admitChat(w http.ResponseWriter, req types.ChatCompletionRequest) (func(), bool) {
+	var releases []func()
+	release := func() {
+		for _, fn := range releases {
+			fn()
+		}
+	}
+	if user := strings.TrimSpace(req.User); user != "" {
+		fn, err := s.userLimiter.Acquire(user, s.limits.User)
+		if err != nil {
+			writeLimited(w, err)
+			return nil, false
+		}
+		releases = append(releases, fn)
+	}
+	fn, err := s.modelLimiter.Acquire(req.Model, s.limits.Model(req.Model))
+	if err != nil {
+		release()
+		writeLimited(w, err)
+		return nil, false
+	}
+	releases = append(releases, fn)
+	return release, true
 }
 
 func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
-	models := s.med.SupportedModels()
+	key := apikey.FromContext(r.Context())
+	var models []string
+	for _, m := range s.med.SupportedModels() {
+		if key.AllowsModel(m) {
+			models = append(models, m)
+		}
+	}
 
 	resp := modelsResponse{
 		Object: "list",
@@ -64,23 +182,50 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
+	// Key scopes, the per-model limits and the streamed chunks all refer to the model
+	// that will serve the request, so leaving the field out neither escapes them nor
+	// trips a scope on the empty name.
+	if req.Model == "" {
+		req.Model = s.med.DefaultModel()
+	}
+	if key := apikey.FromContext(r.Context()); !key.AllowsModel(req.Model) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("key %s may not use model %q", key.Name, req.Model))
+		return
+	}
+	release, ok := s.admitChat(w, req)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if req.Stream {
+		s.streamChatCompletion(w, r, req)
+		return
+	}
 
 	resp, err := s.med.HandleChat(r.Context(), req)
 	if err != nil {
-		switch {
-		case errors.Is(err, mediator.ErrModelUnsupported):
-			writeError(w, http.StatusNotFound, err)
-		case errors.Is(err, mediator.ErrStreamingUnsupported):
-			writeError(w, http.StatusBadRequest, err)
-		default:
-			writeError(w, http.StatusInternalServerError, err)
-		}
+		writeError(w, statusForError(err), err)
 		return
 	}
 
 	writeJSON(w, resp, http.StatusOK)
 }
 
+// statusForError maps mediator errors onto HTTP status codes.
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, mediator.ErrModelUnsupported):
+		return http.StatusNotFound
+	case errors.Is(err, mediator.ErrStreamingUnsupported):
+		return http.StatusBadRequest
+	case errors.Is(err, mediator.ErrUnknownPrompt):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	tools, err := s.med.ListTools(ctx)
@@ -96,6 +241,44 @@ func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, resp, http.StatusOK)
 }
 
+func (s *Server) handleResources(w http.ResponseWriter, r *http.Request) {
+	resources, templates, err := s.med.ListResources(r.Context())
+	if err != nil && len(resources) == 0 && len(templates) == 0 {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if resources == nil {
+		resources = []mediator.ResourceDescriptor{}
+	}
+	if templates == nil {
+		templates = []mediator.ResourceTemplateDescriptor{}
+	}
+
+	resp := resourcesResponse{
+		Object:    "list",
+		Data:      resources,
+		Templates: templates,
+	}
+	writeJSON(w, resp, http.StatusOK)
+}
+
+func (s *Server) handlePrompts(w http.ResponseWriter, r *http.Request) {
+	prompts, err := s.med.ListPrompts(r.Context())
+	if err != nil && len(prompts) == 0 {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if prompts == nil {
+		prompts = []mediator.PromptDescriptor{}
+	}
+
+	resp := promptsResponse{
+		Object: "list",
+		Data:   prompts,
+	}
+	writeJSON(w, resp, http.StatusOK)
+}
+
 type modelsResponse struct {
 	Object string            `json:"object"`
 	Data   []modelDescriptor `json:"data"`
@@ -120,13 +303,25 @@ type openAIError struct {
 type openAIErrorDetails struct {
 	Message string `json:"message"`
 	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
 }
 
 type toolsResponse struct {
-	Object string                         `json:"object"`
+	Object string                    `json:"object"`
 	Data   []mediator.ToolDescriptor `json:"data"`
 }
 
+type resourcesResponse struct {
+	Object    string                                `json:"object"`
+	Data      []mediator.ResourceDescriptor         `json:"data"`
+	Templates []mediator.ResourceTemplateDescriptor `json:"templates"`
+}
+
+type promptsResponse struct {
+	Object string                      `json:"object"`
+	Data   []mediator.PromptDescriptor `json:"data"`
+}
+
 func writeError(w http.ResponseWriter, status int, err error) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -138,3 +333,40 @@ func writeError(w http.ResponseWriter, status int, err error) {
 	}
 	_ = json.NewEncoder(w).Encode(payload)
 }
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streamed chat completions pass through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeLimited answers a refused request the way OpenAI does: 429 with Retry-After and
+// code rate_limit_exceeded.
+func writeLimited(w http.ResponseWriter, err error) {
+	retry := time.Second
+	var limited *ratelimit.Error
+	if errors.As(err, &limited) && limited.RetryAfter > retry {
+		retry = limited.RetryAfter
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(openAIError{
+		Error: openAIErrorDetails{
+			Message: err.Error(),
+			Type:    "requests",
+			Code:    "rate_limit_exceeded",
+		},
+	})
+}
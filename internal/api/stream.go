@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.mcpwrapper/internal/types"
+)
+
+// chunkStream writes chat.completion.chunk events to a streaming client.
+type chunkStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	id      string
+	model   string
+	created int64
+
+	mu sync.Mutex
+}
+
+// streamChatCompletion answers a stream=true request as server-sent events. Tool progress
+// is relayed while the tool loop runs; the final answer follows as a content chunk.
+func (s *Server) streamChatCompletion(w http.ResponseWriter, r *http.Request, req types.ChatCompletionRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported by this connection"))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	stream := &chunkStream{
+		w:       w,
+		flusher: flusher,
+		id:      newCompletionID(),
+		model:   req.Model,
+		created: time.Now().Unix(),
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	stream.send(stream.chunk(types.ChunkDelta{Role: "assistant"}, nil))
+
+	resp, err := s.med.HandleChatStream(r.Context(), req, func(p types.ToolProgress) {
+		chunk := stream.chunk(types.ChunkDelta{}, nil)
+		chunk.Progress = &p
+		stream.send(chunk)
+	})
+	if err != nil {
+		stream.sendError(err)
+		stream.done()
+		return
+	}
+
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		if choice.Message.Content != "" {
+			stream.send(stream.chunk(types.ChunkDelta{Content: choice.Message.Content}, nil))
+		}
+		finish := choice.FinishReason
+		if finish == "" {
+			finish = "stop"
+		}
+		final := stream.chunk(types.ChunkDelta{}, &finish)
+		final.Usage = &resp.Usage
+		stream.send(final)
+	}
+	stream.done()
+}
+
+func (c *chunkStream) chunk(delta types.ChunkDelta, finish *string) types.ChatCompletionChunk {
+	return types.ChatCompletionChunk{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []types.ChunkChoice{{Index: 0, Delta: delta, FinishReason: finish}},
+	}
+}
+
+func (c *chunkStream) send(payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.w, "data: %s\n\n", data)
+	c.flusher.Flush()
+}
+
+func (c *chunkStream) sendError(err error) {
+	c.send(openAIError{
+		Error: openAIErrorDetails{
+			Message: err.Error(),
+			Type:    http.StatusText(statusForError(err)),
+		},
+	})
+}
+
+func (c *chunkStream) done() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprint(c.w, "data: [DONE]\n\n")
+	c.flusher.Flush()
+}
+
+func newCompletionID() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return "chatcmpl-" + hex.EncodeToString(buf)
+}
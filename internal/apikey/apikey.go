@@ -0,0 +1,184 @@
+// Package apikey authenticates callers of the orchestrator API with bearer keys and
+// describes what each key may do: which API models it may use, which mesh functions
+// (`<instance>__<tool>`) it may see and call, and how fast it may send requests.
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"go.mcpwrapper/internal/config"
+	"go.mcpwrapper/internal/ratelimit"
+)
+
+// Key is an authenticated caller.
+type Key struct {
+	// Name identifies the key in logs; the secret itself is never logged.
+	Name string
+	// Models lists the API models the key may use. Empty allows every model.
+	Models []string
+	// Allow and Deny are glob patterns (path.Match syntax) over mesh function names.
+	// A function is offered when it matches some Allow pattern (or Allow is empty) and
+	// no Deny pattern.
+	Allow []string
+	Deny  []string
+	// Limit caps the key's request rate and concurrent requests. Zero is unlimited.
+	Limit ratelimit.Limit
+}
+
+// AllowsModel reports whether the key may use the given API model.
+func (k *Key) AllowsModel(model string) bool {
+	if k == nil || len(k.Models) == 0 {
+		return true
+	}
+	for _, m := range k.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsFunction reports whether the key may see and call the mesh function.
+func (k *Key) AllowsFunction(name string) bool {
+	if k == nil {
+		return true
+	}
+	for _, pattern := range k.Deny {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(k.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range k.Allow {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Set holds the configured keys, indexed by a digest of their secret.
+type Set struct {
+	keys map[[sha256.Size]byte]*Key
+}
+
+// Entry configures one key. Secret accepts a literal, "env:NAME" or "file:/path".
+type Entry struct {
+	Name      string           `json:"name"`
+	Secret    string           `json:"key"`
+	Models    []string         `json:"models,omitempty"`
+	Allow     []string         `json:"allow,omitempty"`
+	Deny      []string         `json:"deny,omitempty"`
+	RateLimit *ratelimit.Limit `json:"rate_limit,omitempty"`
+}
+
+// NewSet validates entries and resolves their secrets.
+func NewSet(entries []Entry) (*Set, error) {
+	s := &Set{keys: make(map[[sha256.Size]byte]*Key, len(entries))}
+	names := make(map[string]struct{}, len(entries))
+	for i, e := range entries {
+		name := strings.TrimSpace(e.Name)
+		if name == "" {
+			return nil, fmt.Errorf("key %d: name is required", i)
+		}
+		if _, dup := names[name]; dup {
+			return nil, fmt.Errorf("key %s: duplicate name", name)
+		}
+		names[name] = struct{}{}
+
+		secret, err := config.ResolveSecret(e.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", name, err)
+		}
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			return nil, fmt.Errorf("key %s: key is empty", name)
+		}
+		for _, pattern := range append(append([]string(nil), e.Allow...), e.Deny...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("key %s: invalid pattern %q", name, pattern)
+			}
+		}
+		digest := sha256.Sum256([]byte(secret))
+		if _, dup := s.keys[digest]; dup {
+			return nil, fmt.Errorf("key %s: secret shared with another key", name)
+		}
+		key := &Key{Name: name, Models: e.Models, Allow: e.Allow, Deny: e.Deny}
+		if e.RateLimit != nil {
+			key.Limit = *e.RateLimit
+		}
+		s.keys[digest] = key
+	}
+	return s, nil
+}
+
+// Load builds a Set from a JSON file (path may be empty) and the API_KEYS-style env
+// value, a comma-separated list of name:key pairs granting unrestricted access.
+func Load(path, env string) (*Set, error) {
+	var entries []Entry
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read api keys file: %w", err)
+		}
+		var doc struct {
+			Keys []Entry `json:"keys"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("parse api keys file: %w", err)
+		}
+		entries = doc.Keys
+	}
+	for _, pair := range strings.Split(env, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, secret, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, errors.New("API_KEYS entries must be name:key")
+		}
+		entries = append(entries, Entry{Name: name, Secret: secret})
+	}
+	return NewSet(entries)
+}
+
+// Len reports the number of configured keys.
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.keys)
+}
+
+// Authenticate returns the key whose secret is token.
+func (s *Set) Authenticate(token string) (*Key, bool) {
+	if s == nil || token == "" {
+		return nil, false
+	}
+	key, ok := s.keys[sha256.Sum256([]byte(token))]
+	return key, ok
+}
+
+type contextKey struct{}
+
+// WithKey attaches the authenticated key to ctx.
+func WithKey(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns the key attached by WithKey, or nil when the request was not
+// authenticated (no keys configured).
+func FromContext(ctx context.Context) *Key {
+	key, _ := ctx.Value(contextKey{}).(*Key)
+	return key
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Role definitions used when advertising over mDNS.
@@ -26,6 +27,74 @@ type Config struct {
 	Instance     string
 	Role         string
 	Description  string
+
+	// Sampling lets tool servers request completions from this agent's backend model.
+	SamplingEnabled    bool
+	SamplingMaxTokens  int
+	SamplingTokenQuota int
+	SamplingPolicyFile string
+
+	// Tool policy driven by MCP tool annotations.
+	DestructiveTools string
+	ToolRetries      int
+	ReadOnlyTools    bool
+
+	// MCPAuthFile is a JSON file with credentials for outbound MCP calls.
+	MCPAuthFile string
+
+	// Inbound API keys: a JSON file with scoped keys and/or the API_KEYS env value of
+	// name:key pairs. The API is open when both are empty.
+	APIKeysFile string
+	APIKeys     string
+
+	// LimitsFile is a JSON file with per-user, per-model and per-tool-server limits.
+	LimitsFile string
+
+	// Discovery providers: a JSON/YAML file of servers, reloaded on change, and mDNS
+	// browsing. File entries win over mDNS entries of the same instance name.
+	DiscoveryFile string
+	MDNSBrowse    bool
+	// DNSSDDomain enables unicast DNS-SD browsing of that domain, queried at DNSSDServer
+	// (host[:port]; the system resolver when empty).
+	DNSSDDomain string
+	DNSSDServer string
+	// Selector is a label selector expression; servers that do not match it are left
+	// out of discovery entirely.
+	Selector string
+	// SnapshotFile keeps the discovered servers, and the orchestrator's cached tool
+	// lists, across restarts.
+	SnapshotFile string
+
+	// Labels are published in this process's TXT record, e.g. env=dev,team=search.
+	Labels map[string]string
+
+	// Announcement signatures. MeshSecret (MESH_SECRET) is a shared HMAC secret used to
+	// sign and verify; SigningKeyFile is an Ed25519 PEM key to sign with instead, and
+	// TrustedKeysFile holds the Ed25519 public keys accepted from others.
+	// SignaturePolicy is off, quarantine or reject.
+	MeshSecret      string
+	SigningKeyFile  string
+	TrustedKeysFile string
+	SignaturePolicy string
+	SignatureMaxAge time.Duration
+
+	// Active health checks of discovered servers; a zero interval disables them.
+	HealthInterval           time.Duration
+	HealthHealthyThreshold   int
+	HealthUnhealthyThreshold int
+
+	// AdminToken guards the /admin/ endpoints; they are not served when it is empty. It
+	// comes from ADMIN_TOKEN, which accepts env: and file: references.
+	AdminToken string
+
+	// Registry accepts HTTP registrations from servers at /registry/servers.
+	Registry bool
+	// RegistryURLs are orchestrators to register this process with over HTTP, and
+	// AdvertiseAddress the host[:port] they should dial back.
+	RegistryURLs     []string
+	AdvertiseAddress string
+	// RegistryToken is the shared bearer token for registrations, from REGISTRY_TOKEN.
+	RegistryToken string
 }
 
 const (
@@ -33,6 +102,18 @@ const (
 	defaultAPIModel = "go-agent-1"
 	defaultBaseURL  = "http://ollama:11434/v1"
 	defaultAPIKey   = "ollama"
+
+	defaultSamplingMaxTokens  = 1024
+	defaultSamplingTokenQuota = 50000
+
+	defaultDestructiveTools = "allow"
+	defaultToolRetries      = 2
+
+	defaultHealthInterval     = 15 * time.Second
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+
+	defaultSignatureMaxAge = 10 * time.Minute
 )
 
 // LoadOrchestrator returns configuration tuned for the parent orchestrator.
@@ -103,6 +184,35 @@ func load(defaults loadDefaults) (Config, error) {
 
 	defaultDescription := strings.TrimSpace(os.Getenv("DESCRIPTION"))
 
+	defaultSampling := envBool("SAMPLING_ENABLED", false)
+	defaultSamplingMaxTokens := envInt("SAMPLING_MAX_TOKENS", defaultSamplingMaxTokens)
+	defaultSamplingQuota := envInt("SAMPLING_TOKEN_QUOTA", defaultSamplingTokenQuota)
+	defaultSamplingPolicyFile := strings.TrimSpace(os.Getenv("SAMPLING_POLICY_FILE"))
+
+	defaultDestructive := firstNonEmpty(os.Getenv("DESTRUCTIVE_TOOLS"), defaultDestructiveTools)
+	defaultRetries := envInt("TOOL_RETRIES", defaultToolRetries)
+	defaultReadOnly := envBool("READ_ONLY_TOOLS", false)
+	defaultAuthFile := strings.TrimSpace(os.Getenv("MCP_AUTH_FILE"))
+	defaultAPIKeysFile := strings.TrimSpace(os.Getenv("API_KEYS_FILE"))
+	defaultLimitsFile := strings.TrimSpace(os.Getenv("LIMITS_FILE"))
+	defaultDiscoveryFile := strings.TrimSpace(os.Getenv("DISCOVERY_FILE"))
+	defaultMDNSBrowse := envBool("MDNS_BROWSE", true)
+	defaultDNSSDDomain := strings.TrimSpace(os.Getenv("DNSSD_DOMAIN"))
+	defaultDNSSDServer := strings.TrimSpace(os.Getenv("DNSSD_SERVER"))
+	defaultSelector := strings.TrimSpace(os.Getenv("DISCOVERY_SELECTOR"))
+	defaultSnapshotFile := strings.TrimSpace(os.Getenv("DISCOVERY_SNAPSHOT_FILE"))
+	defaultLabels := strings.TrimSpace(os.Getenv("LABELS"))
+	defaultSigningKeyFile := strings.TrimSpace(os.Getenv("SIGNING_KEY_FILE"))
+	defaultTrustedKeysFile := strings.TrimSpace(os.Getenv("TRUSTED_KEYS_FILE"))
+	defaultSignaturePolicy := strings.TrimSpace(os.Getenv("SIGNATURE_POLICY"))
+	defaultSignatureMaxAge := envDuration("SIGNATURE_MAX_AGE", defaultSignatureMaxAge)
+	defaultRegistry := envBool("REGISTRY", false)
+	defaultHealthInterval := envDuration("HEALTH_INTERVAL", defaultHealthInterval)
+	defaultHealthyThreshold := envInt("HEALTH_HEALTHY_THRESHOLD", defaultHealthyThreshold)
+	defaultUnhealthyThreshold := envInt("HEALTH_UNHEALTHY_THRESHOLD", defaultUnhealthyThreshold)
+	defaultRegistryURLs := strings.TrimSpace(os.Getenv("REGISTRY_URLS"))
+	defaultAdvertiseAddress := strings.TrimSpace(os.Getenv("ADVERTISE_ADDRESS"))
+
 	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	modelFlag := fs.String("model", agentModelDefault, "ID of the base model exposed by this agent (required)")
 	apiModelFlag := fs.String("api-model", defaultAPIModelValue, "Model name exposed to API clients")
@@ -113,6 +223,33 @@ func load(defaults loadDefaults) (Config, error) {
 	roleFlag := fs.String("role", defaultRole, "Role advertised over mDNS (orchestrator, agent-wrapper, ...)")
 	descriptionFlag := fs.String("description", defaultDescription, "Human readable description for this agent/tool")
 	apiKeyFlag := fs.String("api-key", defaultAPIKeyValue, "API key for the upstream endpoint")
+	samplingFlag := fs.Bool("sampling", defaultSampling, "Serve MCP sampling requests from tool servers using the backend model")
+	samplingMaxTokensFlag := fs.Int("sampling-max-tokens", defaultSamplingMaxTokens, "Maximum tokens per sampling request")
+	samplingQuotaFlag := fs.Int("sampling-token-quota", defaultSamplingQuota, "Sampling tokens each tool server may use per hour (0 = unlimited)")
+	samplingPolicyFlag := fs.String("sampling-policy-file", defaultSamplingPolicyFile, "JSON file with per-server sampling policy overrides")
+	destructiveFlag := fs.String("destructive-tools", defaultDestructive, "How to treat tools annotated as destructive: allow, approve or deny")
+	toolRetriesFlag := fs.Int("tool-retries", defaultRetries, "Extra attempts for idempotent tools after a transient failure")
+	readOnlyFlag := fs.Bool("read-only-tools", defaultReadOnly, "Only offer tools annotated as read-only to the model")
+	apiKeysFileFlag := fs.String("api-keys-file", defaultAPIKeysFile, "JSON file with API keys and their model, tool and rate scopes")
+	limitsFileFlag := fs.String("limits-file", defaultLimitsFile, "JSON file with per-user, per-model and per-tool-server rate and concurrency limits")
+	discoveryFileFlag := fs.String("discovery-file", defaultDiscoveryFile, "JSON or YAML file listing servers to use alongside mDNS; reloaded when it changes")
+	mdnsBrowseFlag := fs.Bool("mdns-browse", defaultMDNSBrowse, "Discover servers by browsing mDNS")
+	dnssdDomainFlag := fs.String("dnssd-domain", defaultDNSSDDomain, "Domain to browse for _mcp-http._tcp service records over unicast DNS")
+	dnssdServerFlag := fs.String("dnssd-server", defaultDNSSDServer, "DNS server (host[:port]) for --dnssd-domain; defaults to the system resolver")
+	selectorFlag := fs.String("selector", defaultSelector, "Label selector servers must match to be discovered, e.g. 'env=prod,team in (search,ml)'")
+	snapshotFileFlag := fs.String("snapshot-file", defaultSnapshotFile, "File to save discovered servers to and restore them from on restart")
+	labelsFlag := fs.String("labels", defaultLabels, "Comma-separated key=value labels advertised with this agent, e.g. env=dev,team=search")
+	signingKeyFlag := fs.String("signing-key", defaultSigningKeyFile, "Ed25519 private key (PEM) to sign announcements with; MESH_SECRET signs with HMAC instead")
+	trustedKeysFlag := fs.String("trusted-keys", defaultTrustedKeysFile, "PEM file of Ed25519 public keys whose announcement signatures are accepted")
+	signaturePolicyFlag := fs.String("signature-policy", defaultSignaturePolicy, "What to do with unsigned or invalid announcements: off, quarantine or reject")
+	signatureMaxAgeFlag := fs.Duration("signature-max-age", defaultSignatureMaxAge, "Oldest announcement signature timestamp accepted")
+	healthIntervalFlag := fs.Duration("health-interval", defaultHealthInterval, "How often to probe discovered servers (0 disables health checks)")
+	healthyThresholdFlag := fs.Int("health-healthy-threshold", defaultHealthyThreshold, "Consecutive successful probes before a down server is used again")
+	unhealthyThresholdFlag := fs.Int("health-unhealthy-threshold", defaultUnhealthyThreshold, "Consecutive failed probes before a server is marked down")
+	registryFlag := fs.Bool("registry", defaultRegistry, "Accept HTTP registrations from servers that cannot use mDNS")
+	registryURLsFlag := fs.String("registry-urls", defaultRegistryURLs, "Comma-separated orchestrator URLs to register with over HTTP")
+	advertiseAddressFlag := fs.String("advertise-address", defaultAdvertiseAddress, "Host or host:port registries should use to reach this process")
+	authFileFlag := fs.String("mcp-auth-file", defaultAuthFile, "JSON file with per-server credentials for outbound MCP calls")
 
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		return cfg, err
@@ -152,6 +289,56 @@ func load(defaults loadDefaults) (Config, error) {
 		cfg.APIKey = defaultAPIKey
 	}
 
+	cfg.SamplingEnabled = *samplingFlag
+	cfg.SamplingMaxTokens = *samplingMaxTokensFlag
+	cfg.SamplingTokenQuota = *samplingQuotaFlag
+	cfg.SamplingPolicyFile = strings.TrimSpace(*samplingPolicyFlag)
+
+	cfg.DestructiveTools = strings.ToLower(strings.TrimSpace(*destructiveFlag))
+	cfg.ToolRetries = *toolRetriesFlag
+	if cfg.ToolRetries < 0 {
+		cfg.ToolRetries = 0
+	}
+	cfg.ReadOnlyTools = *readOnlyFlag
+	cfg.MCPAuthFile = strings.TrimSpace(*authFileFlag)
+	cfg.APIKeysFile = strings.TrimSpace(*apiKeysFileFlag)
+	cfg.APIKeys = strings.TrimSpace(os.Getenv("API_KEYS"))
+	cfg.LimitsFile = strings.TrimSpace(*limitsFileFlag)
+	cfg.DiscoveryFile = strings.TrimSpace(*discoveryFileFlag)
+	cfg.MDNSBrowse = *mdnsBrowseFlag
+	cfg.DNSSDDomain = strings.TrimSpace(*dnssdDomainFlag)
+	cfg.DNSSDServer = strings.TrimSpace(*dnssdServerFlag)
+	cfg.Selector = strings.TrimSpace(*selectorFlag)
+	cfg.SnapshotFile = strings.TrimSpace(*snapshotFileFlag)
+	cfg.SigningKeyFile = strings.TrimSpace(*signingKeyFlag)
+	cfg.TrustedKeysFile = strings.TrimSpace(*trustedKeysFlag)
+	cfg.SignaturePolicy = strings.ToLower(strings.TrimSpace(*signaturePolicyFlag))
+	cfg.SignatureMaxAge = *signatureMaxAgeFlag
+
+	cfg.HealthInterval = *healthIntervalFlag
+	if cfg.HealthInterval < 0 {
+		cfg.HealthInterval = 0
+	}
+	cfg.HealthHealthyThreshold = *healthyThresholdFlag
+	cfg.HealthUnhealthyThreshold = *unhealthyThresholdFlag
+	cfg.Registry = *registryFlag
+	cfg.RegistryURLs = splitList(*registryURLsFlag)
+	cfg.AdvertiseAddress = strings.TrimSpace(*advertiseAddressFlag)
+
+	var err error
+	if cfg.Labels, err = parseLabels(*labelsFlag); err != nil {
+		return cfg, err
+	}
+	if cfg.AdminToken, err = envSecret("ADMIN_TOKEN"); err != nil {
+		return cfg, err
+	}
+	if cfg.RegistryToken, err = envSecret("REGISTRY_TOKEN"); err != nil {
+		return cfg, err
+	}
+	if cfg.MeshSecret, err = envSecret("MESH_SECRET"); err != nil {
+		return cfg, err
+	}
+
 	return cfg, nil
 }
 
@@ -171,6 +358,63 @@ func resolvePort(flagValue int, envValue string, fallback int) int {
 	return defaultPort
 }
 
+func envBool(key string, fallback bool) bool {
+	if env := strings.TrimSpace(os.Getenv(key)); env != "" {
+		if val, err := strconv.ParseBool(env); err == nil {
+			return val
+		}
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if env := strings.TrimSpace(os.Getenv(key)); env != "" {
+		if val, err := time.ParseDuration(env); err == nil {
+			return val
+		}
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if env := strings.TrimSpace(os.Getenv(key)); env != "" {
+		if val, err := strconv.Atoi(env); err == nil {
+			return val
+		}
+		fmt.Fprintf(os.Stderr, "invalid %s value %q, falling back to default\n", key, env)
+	}
+	return fallback
+}
+
+// splitList parses a comma-separated list, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseLabels parses comma-separated key=value pairs.
+func parseLabels(value string) (map[string]string, error) {
+	items := splitList(value)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(items))
+	for _, item := range items {
+		key, val, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q: want key=value", item)
+		}
+		labels[key] = strings.TrimSpace(val)
+	}
+	return labels, nil
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if strings.TrimSpace(v) != "" {
@@ -13,6 +13,17 @@ type ToolConfig struct {
 	Advertise bool
 	Instance  string
 	Role      string
+	// Labels are published in the TXT record, e.g. env=dev,team=search.
+	Labels map[string]string
+
+	// Registry registration, as for the agent binaries.
+	RegistryURLs     []string
+	AdvertiseAddress string
+	RegistryToken    string
+
+	// Announcement signing, as for the agent binaries.
+	MeshSecret     string
+	SigningKeyFile string
 }
 
 const defaultToolRole = "tool"
@@ -43,6 +54,10 @@ func LoadToolServer() (ToolConfig, error) {
 	advertiseFlag := fs.Bool("advertise", defaultAdvertise, "Publish this tool server over mDNS")
 	instanceFlag := fs.String("instance", defaultInstance, "Instance name advertised over mDNS")
 	roleFlag := fs.String("role", defaultRole, "Role advertised over mDNS")
+	registryURLsFlag := fs.String("registry-urls", strings.TrimSpace(os.Getenv("REGISTRY_URLS")), "Comma-separated orchestrator URLs to register with over HTTP")
+	labelsFlag := fs.String("labels", strings.TrimSpace(os.Getenv("LABELS")), "Comma-separated key=value labels advertised with this server, e.g. env=dev,team=search")
+	signingKeyFlag := fs.String("signing-key", strings.TrimSpace(os.Getenv("SIGNING_KEY_FILE")), "Ed25519 private key (PEM) to sign announcements with; MESH_SECRET signs with HMAC instead")
+	advertiseAddressFlag := fs.String("advertise-address", strings.TrimSpace(os.Getenv("ADVERTISE_ADDRESS")), "Host or host:port registries should use to reach this server")
 
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		return cfg, err
@@ -58,6 +73,20 @@ func LoadToolServer() (ToolConfig, error) {
 	if cfg.Role == "" {
 		cfg.Role = defaultToolRole
 	}
+	cfg.RegistryURLs = splitList(*registryURLsFlag)
+	cfg.AdvertiseAddress = strings.TrimSpace(*advertiseAddressFlag)
+	cfg.SigningKeyFile = strings.TrimSpace(*signingKeyFlag)
+
+	var err error
+	if cfg.Labels, err = parseLabels(*labelsFlag); err != nil {
+		return cfg, err
+	}
+	if cfg.RegistryToken, err = envSecret("REGISTRY_TOKEN"); err != nil {
+		return cfg, err
+	}
+	if cfg.MeshSecret, err = envSecret("MESH_SECRET"); err != nil {
+		return cfg, err
+	}
 
 	return cfg, nil
 }
@@ -2,11 +2,14 @@ package discovery
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/grandcat/zeroconf"
+	log "github.com/charmbracelet/log"
+	"github.com/libp2p/zeroconf/v2"
 )
 
 // AnnounceOptions define the metadata broadcast for this service.
@@ -16,49 +19,194 @@ type AnnounceOptions struct {
 	Domain   string
 	Port     int
 	Text     map[string]string
+	// Labels such as env, team or mesh are published as TXT keys next to Text, for
+	// browsers to filter with a Selector. Text wins when both set a key.
+	Labels map[string]string
+	// TTL is advertised on the mDNS records: browsers drop the server this long after
+	// its last answer unless it says goodbye first. Defaults to 45s.
+	TTL time.Duration
+
+	// Registries are base URLs of orchestrators running a Registry. The service
+	// registers with each over HTTP, in addition to mDNS, and keeps the registration
+	// alive with heartbeats.
+	Registries []string
+	// RegistryToken is sent as a bearer token to the registries.
+	RegistryToken string
+	// Address is the host or host:port registries should dial. Empty lets each registry
+	// use the source address of the registration.
+	Address string
+	// Logger receives registry errors. Defaults to discarding.
+	Logger *log.Logger
+	// Signer, when set, signs the TXT record (see Verifier) and re-signs it every two
+	// minutes so that its timestamp stays fresh.
+	Signer *Signer
+	// KeepName skips probing for other servers using Instance. By default a taken name
+	// is replaced with "Instance (2)", "Instance (3)" and so on.
+	KeepName bool
 }
 
-// Announcer manages the lifetime of an mDNS advertisement.
+// Announcer manages the lifetime of an mDNS advertisement and any registry
+// registrations.
 type Announcer struct {
-	server *zeroconf.Server
-	once   sync.Once
+	server    *zeroconf.Server
+	registrar *registrar
+	instance  string
+	port      int
+	labels    map[string]string
+	signer    *Signer
+
+	// mu guards text, the unsigned TXT record, and serialises re-announcements.
+	mu   sync.Mutex
+	text map[string]string
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
 }
 
-// NewAnnouncer publishes an mDNS record for the agent and returns a controller.
+// NewAnnouncer publishes an mDNS record for the agent, starts registering with the
+// configured registries, and returns a controller. Unless opts.KeepName is set, it first
+// spends about a second probing for other servers using opts.Instance and renames itself
+// if one does; Instance reports the name in use.
 func NewAnnouncer(opts AnnounceOptions) (*Announcer, error) {
 	opts = opts.withDefaults()
 	if opts.Port <= 0 {
 		return nil, fmt.Errorf("invalid port %d", opts.Port)
 	}
-
-	text := make([]string, 0, len(opts.Text))
-	for k, v := range opts.Text {
-		key := strings.TrimSpace(k)
-		if key == "" {
-			continue
+	if !opts.KeepName {
+		name, err := claimInstanceName(opts)
+		switch {
+		case err != nil:
+			opts.logger().Warn("instance name not probed; a duplicate name would conflict", "instance", opts.Instance, "error", err)
+		case name != opts.Instance:
+			opts.logger().Warn("instance name in use by another server; renamed", "instance", opts.Instance, "renamed", name)
+			opts.Instance = name
 		}
-		value := strings.TrimSpace(v)
-		text = append(text, fmt.Sprintf("%s=%s", key, value))
 	}
 
-	server, err := zeroconf.Register(opts.Instance, opts.Service, opts.Domain, opts.Port, text, nil)
+	a := &Announcer{
+		instance: opts.Instance,
+		port:     opts.Port,
+		labels:   opts.Labels,
+		signer:   opts.Signer,
+		text:     normalizeText(withLabels(opts.Text, opts.Labels)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	opts.Text = a.signed(a.text)
+
+	server, err := zeroconf.Register(opts.Instance, opts.Service, opts.Domain, opts.Port, formatText(opts.Text), nil,
+		zeroconf.TTL(uint32(opts.TTL/time.Second)))
 	if err != nil {
 		return nil, err
 	}
-	return &Announcer{
-		server: server,
-	}, nil
+	a.server = server
+	if len(opts.Registries) > 0 {
+		a.registrar = startRegistrar(opts)
+	}
+	if a.signer != nil {
+		go a.resign()
+	} else {
+		close(a.done)
+	}
+	return a, nil
+}
+
+// Instance returns the instance name being announced, which differs from the requested
+// one when that was taken.
+func (a *Announcer) Instance() string { return a.instance }
+
+// SetText replaces the advertised TXT record and re-announces it, so browsers pick up
+// the change without waiting for the record to expire.
+func (a *Announcer) SetText(text map[string]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.text = normalizeText(withLabels(text, a.labels))
+	a.announce()
+}
+
+// Update merges text into the advertised TXT record, leaving other keys as they are, and
+// re-announces it if a value changed. The service stays registered throughout; browsers
+// see an EventUpdated listing the changed keys. It suits frequently changing status such
+// as load or readiness.
+func (a *Announcer) Update(text map[string]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	next := make(map[string]string, len(a.text)+len(text))
+	for k, v := range a.text {
+		next[k] = v
+	}
+	changed := false
+	for k, v := range normalizeText(text) {
+		if cur, ok := next[k]; !ok || cur != v {
+			next[k] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	a.text = next
+	a.announce()
+}
+
+// announce publishes a.text, signed afresh; a.mu must be held.
+func (a *Announcer) announce() {
+	text := a.signed(a.text)
+	if a.server != nil {
+		a.server.SetText(formatText(text))
+	}
+	if a.registrar != nil {
+		a.registrar.setText(text)
+	}
+}
+
+func (a *Announcer) signed(text map[string]string) map[string]string {
+	if a.signer == nil {
+		return text
+	}
+	return a.signer.Sign(a.instance, a.port, text)
 }
 
-// Stop removes the advertisement.
+// resign re-announces the record with a fresh signature until Stop.
+func (a *Announcer) resign() {
+	defer close(a.done)
+	ticker := time.NewTicker(defaultSignInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			a.announce()
+			a.mu.Unlock()
+		}
+	}
+}
+
+// Stop sends an mDNS goodbye, so browsers remove the server at once, and deregisters
+// from the registries.
 func (a *Announcer) Stop() {
 	a.once.Do(func() {
+		close(a.stop)
+		<-a.done
 		if a.server != nil {
 			a.server.Shutdown()
 		}
+		if a.registrar != nil {
+			a.registrar.stop()
+		}
 	})
 }
 
+func (o AnnounceOptions) logger() *log.Logger {
+	if o.Logger == nil {
+		return log.New(io.Discard)
+	}
+	return o.Logger
+}
+
 func (o AnnounceOptions) withDefaults() AnnounceOptions {
 	if o.Service == "" {
 		o.Service = defaultService
@@ -73,8 +221,51 @@ func (o AnnounceOptions) withDefaults() AnnounceOptions {
 			o.Instance = "mcp-agent"
 		}
 	}
+	if o.TTL < time.Second {
+		o.TTL = defaultEntryTTL
+	}
 	if o.Text == nil {
 		o.Text = map[string]string{}
 	}
 	return o
 }
+
+// normalizeText trims keys and values as they will appear in the TXT record, so that
+// signatures cover exactly what browsers see.
+func normalizeText(text map[string]string) map[string]string {
+	out := make(map[string]string, len(text))
+	for k, v := range text {
+		if key := strings.TrimSpace(k); key != "" {
+			out[key] = strings.TrimSpace(v)
+		}
+	}
+	return out
+}
+
+// withLabels returns text with labels added under keys text does not set.
+func withLabels(text, labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return text
+	}
+	merged := make(map[string]string, len(text)+len(labels))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range text {
+		merged[k] = v
+	}
+	return merged
+}
+
+func formatText(values map[string]string) []string {
+	text := make([]string, 0, len(values))
+	for k, v := range values {
+		key := strings.TrimSpace(k)
+		if key == "" {
+			continue
+		}
+		value := strings.TrimSpace(v)
+		text = append(text, fmt.Sprintf("%s=%s", key, value))
+	}
+	return text
+}
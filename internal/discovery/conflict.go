@@ -0,0 +1,228 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/libp2p/zeroconf/v2"
+)
+
+const (
+	// probeWindow is how long an Announcer listens for servers already using its
+	// instance name before claiming it.
+	probeWindow = time.Second
+	// maxInstanceLabel is the longest DNS label, and so the longest instance name.
+	maxInstanceLabel = 63
+)
+
+var numberedName = regexp.MustCompile(`^(.*) \((\d+)\)$`)
+
+// EventConflict is emitted when a server claims an instance name that another live server
+// holds from a different endpoint. Server is the holder, which keeps the name; Rival is
+// the claimant, which is ignored until the holder lapses.
+const EventConflict EventType = "conflict"
+
+// rival is a server whose claim on a record's instance name was turned down.
+type rival struct {
+	info    *ServerInfo
+	expires time.Time
+}
+
+// live reports whether rec still holds its name at now. Records without a TTL, such as
+// static servers, are replaced freely and never conflict.
+func (rec *record) live(now time.Time) bool {
+	return !rec.expires.IsZero() && rec.expires.After(now)
+}
+
+// addRival notes info as a rival claim lasting ttl. It reports true when the rival is new
+// rather than a refresh of one already noted.
+func (rec *record) addRival(info *ServerInfo, ttl time.Duration, now time.Time) bool {
+	if ttl <= 0 {
+		ttl = defaultEntryTTL
+	}
+	if rec.rivals == nil {
+		rec.rivals = make(map[string]*rival)
+	}
+	_, known := rec.rivals[info.Address]
+	rec.rivals[info.Address] = &rival{info: info, expires: now.Add(ttl)}
+	rec.syncConflicts()
+	return !known
+}
+
+// inheritRivals carries prev's live rivals over to rec, which refreshes it.
+func (rec *record) inheritRivals(prev *record, now time.Time) {
+	for addr, r := range prev.rivals {
+		if r.expires.After(now) && addr != rec.info.Address {
+			if rec.rivals == nil {
+				rec.rivals = make(map[string]*rival)
+			}
+			rec.rivals[addr] = r
+		}
+	}
+	rec.syncConflicts()
+}
+
+// pruneRivals drops rivals that lapsed by now, reporting whether any did.
+func (rec *record) pruneRivals(now time.Time) bool {
+	pruned := false
+	for addr, r := range rec.rivals {
+		if !r.expires.After(now) {
+			delete(rec.rivals, addr)
+			pruned = true
+		}
+	}
+	if pruned {
+		rec.syncConflicts()
+	}
+	return pruned
+}
+
+// successor returns a record for the most recently seen live rival, inheriting the rest,
+// or nil when there is none. It takes over the name when rec lapses.
+func (rec *record) successor(now time.Time) *record {
+	var next *rival
+	for _, r := range rec.rivals {
+		if r.expires.After(now) && (next == nil || r.info.LastSeen.After(next.info.LastSeen)) {
+			next = r
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	info := cloneServerInfo(next.info)
+	info.Conflicts = nil
+	succ := &record{info: info, expires: next.expires}
+	succ.inheritRivals(rec, now)
+	return succ
+}
+
+// syncConflicts lists the rivals' addresses on rec.info.
+func (rec *record) syncConflicts() {
+	rec.info.Conflicts = nil
+	for addr := range rec.rivals {
+		rec.info.Conflicts = append(rec.info.Conflicts, addr)
+	}
+	sort.Strings(rec.info.Conflicts)
+}
+
+// sameEndpoint reports whether a and b are the same server: the same port and at least
+// one address in common. Anything else claiming one instance name is a conflict.
+func sameEndpoint(a, b *ServerInfo) bool {
+	if a.Port != b.Port {
+		return false
+	}
+	for _, addr := range append([]string{a.Address}, a.Addresses...) {
+		if addr != "" && (addr == b.Address || slices.Contains(b.Addresses, addr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// atHost reports whether one of info's addresses is at ip. Addresses given by host name
+// never match.
+func atHost(info *ServerInfo, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, addr := range append([]string{info.Address}, info.Addresses...) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		host, _, _ = strings.Cut(host, "%")
+		if ip.Equal(net.ParseIP(host)) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportConflict broadcasts EventConflict when the server source index holds for
+// instance is the one in the snapshot; a conflict behind an override is not news.
+func (d *Discovery) reportConflict(index int, instance string, claimant *ServerInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	current, ok := d.snapshot.Load().(map[string]*ServerInfo)[instance]
+	if !ok || current.Source != d.sources[index].name {
+		return
+	}
+	d.broadcast(Event{Type: EventConflict, Server: cloneServerInfo(current), Rival: cloneServerInfo(claimant)})
+}
+
+// claimInstanceName probes mDNS for other servers using opts.Instance and, if one does,
+// picks the first free name in the DNS-SD style "name (2)", "name (3)", ... A server at
+// one of this host's addresses on opts.Port is taken to be a previous run of this one.
+func claimInstanceName(opts AnnounceOptions) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeWindow)
+	defer cancel()
+	entries := make(chan *zeroconf.ServiceEntry)
+	browsed := make(chan error, 1)
+	go func() {
+		browsed <- zeroconf.Browse(ctx, opts.Service, opts.Domain, entries)
+	}()
+	local := localAddresses()
+	taken := make(map[string]bool)
+	for entry := range entries {
+		if entry == nil {
+			continue
+		}
+		info := serverFromEntry(entry)
+		if info.Port == opts.Port && slices.ContainsFunc(info.Addresses, func(addr string) bool {
+			host, _, _ := net.SplitHostPort(addr)
+			return local[host]
+		}) {
+			continue
+		}
+		taken[info.Instance] = true
+	}
+	if err := <-browsed; err != nil {
+		return "", fmt.Errorf("probe: %w", err)
+	}
+	name := opts.Instance
+	for taken[name] {
+		name = nextInstanceName(name)
+	}
+	return name, nil
+}
+
+// nextInstanceName numbers name, or increments its number: "tools" becomes "tools (2)"
+// and "tools (2)" becomes "tools (3)". The base is shortened to fit a DNS label.
+func nextInstanceName(name string) string {
+	base, n := name, 2
+	if m := numberedName.FindStringSubmatch(name); m != nil {
+		if i, err := strconv.Atoi(m[2]); err == nil {
+			base, n = m[1], i+1
+		}
+	}
+	suffix := fmt.Sprintf(" (%d)", n)
+	if len(base)+len(suffix) > maxInstanceLabel {
+		base = base[:max(0, maxInstanceLabel-len(suffix))]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+	}
+	return base + suffix
+}
+
+func localAddresses() map[string]bool {
+	local := make(map[string]bool)
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return local
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			local[ipnet.IP.String()] = true
+		}
+	}
+	return local
+}
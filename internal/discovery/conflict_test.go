@@ -0,0 +1,129 @@
+package discovery
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestNextInstanceName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "tools", want: "tools (2)"},
+		{name: "tools (2)", want: "tools (3)"},
+		{name: "tools (9)", want: "tools (10)"},
+		{name: "tools(2)", want: "tools(2) (2)"},
+		{name: "tools (two)", want: "tools (two) (2)"},
+		{name: strings.Repeat("a", 70), want: strings.Repeat("a", 59) + " (2)"},
+		{name: strings.Repeat("a", 59) + " (9)", want: strings.Repeat("a", 58) + " (10)"},
+		// 59 bytes would split the last "é", so the base keeps 58.
+		{name: strings.Repeat("é", 40), want: strings.Repeat("é", 29) + " (2)"},
+	}
+	for _, tt := range tests {
+		got := nextInstanceName(tt.name)
+		if got != tt.want {
+			t.Errorf("nextInstanceName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if len(got) > maxInstanceLabel || !utf8.ValidString(got) {
+			t.Errorf("nextInstanceName(%q) = %q is no valid DNS label", tt.name, got)
+		}
+	}
+}
+
+func TestSameEndpoint(t *testing.T) {
+	multi := endpoint("tools", "10.0.0.1")
+	multi.Addresses = append(multi.Addresses, "[fd00::1]:8080")
+	moved := endpoint("tools", "10.0.0.2")
+	otherPort := endpoint("tools", "10.0.0.1")
+	otherPort.Port = 9090
+
+	tests := []struct {
+		name string
+		a, b *ServerInfo
+		want bool
+	}{
+		{name: "same address", a: endpoint("tools", "10.0.0.1"), b: endpoint("tools", "10.0.0.1"), want: true},
+		{name: "other address", a: endpoint("tools", "10.0.0.1"), b: moved},
+		{name: "other port", a: endpoint("tools", "10.0.0.1"), b: otherPort},
+		{
+			name: "one address in common", a: multi,
+			b: &ServerInfo{Port: 8080, Address: "[fd00::1]:8080", Addresses: []string{"[fd00::1]:8080"}}, want: true,
+		},
+		{name: "no addresses", a: &ServerInfo{Port: 8080}, b: &ServerInfo{Port: 8080}},
+	}
+	for _, tt := range tests {
+		if got := sameEndpoint(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: sameEndpoint = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := sameEndpoint(tt.b, tt.a); got != tt.want {
+			t.Errorf("%s: sameEndpoint reversed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSuccessor(t *testing.T) {
+	now := time.Now()
+	claim := func(ip string, seen time.Duration) *ServerInfo {
+		info := endpoint("tools", ip)
+		info.LastSeen = now.Add(-seen)
+		return info
+	}
+	tests := []struct {
+		name   string
+		rivals []*ServerInfo
+		// lapsed lists rival addresses whose claim ran out before now.
+		lapsed        []string
+		wantHolder    string
+		wantConflicts []string
+	}{
+		{name: "no rivals"},
+		{name: "only lapsed rivals", rivals: []*ServerInfo{claim("10.0.0.2", 0)}, lapsed: []string{"10.0.0.2:8080"}},
+		{name: "one rival", rivals: []*ServerInfo{claim("10.0.0.2", 0)}, wantHolder: "10.0.0.2:8080"},
+		{
+			name:          "most recently seen rival wins",
+			rivals:        []*ServerInfo{claim("10.0.0.2", 30*time.Second), claim("10.0.0.3", time.Second), claim("10.0.0.4", time.Minute)},
+			wantHolder:    "10.0.0.3:8080",
+			wantConflicts: []string{"10.0.0.2:8080", "10.0.0.4:8080"},
+		},
+		{
+			name:       "lapsed rivals are not inherited",
+			rivals:     []*ServerInfo{claim("10.0.0.2", time.Second), claim("10.0.0.3", 0)},
+			lapsed:     []string{"10.0.0.3:8080"},
+			wantHolder: "10.0.0.2:8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &record{info: endpoint("tools", "10.0.0.1"), expires: now}
+			for _, info := range tt.rivals {
+				rec.addRival(info, time.Minute, now)
+			}
+			for _, addr := range tt.lapsed {
+				rec.rivals[addr].expires = now.Add(-time.Second)
+			}
+			succ := rec.successor(now)
+			if tt.wantHolder == "" {
+				if succ != nil {
+					t.Fatalf("successor at %s, want none", succ.info.Address)
+				}
+				return
+			}
+			if succ == nil {
+				t.Fatalf("no successor, want %s", tt.wantHolder)
+			}
+			if succ.info.Address != tt.wantHolder {
+				t.Errorf("successor at %s, want %s", succ.info.Address, tt.wantHolder)
+			}
+			if !slices.Equal(succ.info.Conflicts, tt.wantConflicts) {
+				t.Errorf("conflicts = %v, want %v", succ.info.Conflicts, tt.wantConflicts)
+			}
+			if want := now.Add(time.Minute); !succ.expires.Equal(want) {
+				t.Errorf("successor expires %v, want its own claim's expiry %v", succ.expires, want)
+			}
+		})
+	}
+}
@@ -2,26 +2,43 @@ package discovery
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/grandcat/zeroconf"
+	log "github.com/charmbracelet/log"
 )
 
 // ServerInfo captures the metadata required by the mediator to connect to an MCP server.
 type ServerInfo struct {
-	Instance string            `json:"instance"`
-	Host     string            `json:"host"`
-	Port     int               `json:"port"`
-	Address  string            `json:"address"`
-	Kind     string            `json:"kind"`
-	LastSeen time.Time         `json:"last_seen"`
-	Text     map[string]string `json:"text"`
+	Instance string `json:"instance"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Address  string `json:"address"`
+	// Addresses lists every host:port the server advertised, Address first. Clients fall
+	// back to the others when Address is unreachable. It may be empty when Address is
+	// the only one.
+	Addresses []string          `json:"addresses,omitempty"`
+	Kind      string            `json:"kind"`
+	LastSeen  time.Time         `json:"last_seen"`
+	Text      map[string]string `json:"text"`
+	// Source names the provider the entry came from, e.g. "mdns", "file" or "static".
+	Source string `json:"source"`
+	// Health is set by a HealthChecker; it is HealthUnknown without one.
+	Health Health `json:"health"`
+	// Signature is the outcome of checking the announcement's signature, when
+	// Options.Verifier is set and the source is not trusted.
+	Signature SignatureStatus `json:"signature,omitempty"`
+	// Conflicts lists the addresses of other servers claiming this instance name. They
+	// are ignored while this server stays live (see EventConflict).
+	Conflicts []string `json:"conflicts,omitempty"`
 }
 
 // EventType captures the type of change for a discovered server.
@@ -32,33 +49,113 @@ const (
 	EventAdded   EventType = "added"
 	EventUpdated EventType = "updated"
 	EventRemoved EventType = "removed"
+	// EventResync replaces the subscriber's view with Snapshot. It is the first event on
+	// every subscription, and it stands in for events a subscriber was too slow to take.
+	EventResync EventType = "resync"
 )
 
 // Event represents a change in the discovery set.
 type Event struct {
 	Type   EventType
 	Server *ServerInfo
+	// Seq numbers changes from 1 in the order they happened. A subscriber sees each Seq
+	// exactly once, or a resync whose Seq is the last change its Snapshot includes.
+	Seq uint64
+	// Snapshot is the full server set, for EventResync only.
+	Snapshot map[string]*ServerInfo
+	// Changes lists the TXT keys that differ from the server's previous version, for
+	// EventUpdated only. It is empty when only the address or source changed.
+	Changes []TextChange
+	// Rival is the server turned down for claiming Server's instance name, for
+	// EventConflict only.
+	Rival *ServerInfo
 }
 
 // Options control how discovery behaves at runtime.
 type Options struct {
+	// Providers feed the server set. When two report the same instance name, the one
+	// listed first wins. Nil browses mDNS with Service, Domain and EntryTTL.
+	Providers []Provider
+
+	// Selector limits the snapshot to matching servers; the rest are ignored entirely.
+	// Servers added with AddStatic are kept regardless. The zero Selector keeps all.
+	Selector Selector
+	// Verifier checks the signatures of servers from untrusted sources (see
+	// verifiesSource). Under SignatureReject failing servers are left out; under
+	// SignatureQuarantine they are kept with their Signature status. Nil skips checks.
+	Verifier *Verifier
+
+	// SnapshotFile, when set, keeps the server set across restarts: it is saved there
+	// every SnapshotInterval (default 1m) and on Stop, and Start restores it. Restored
+	// servers have Source SourceSnapshot and are used until a provider reports them,
+	// which replaces them, or until SnapshotTTL (default 2m) passes.
+	SnapshotFile     string
+	SnapshotInterval time.Duration
+	SnapshotTTL      time.Duration
+	// Logger receives snapshot errors. Defaults to discarding.
+	Logger *log.Logger
+
 	Service       string
 	Domain        string
 	EntryTTL      time.Duration
 	PruneInterval time.Duration
 }
 
-// Discovery maintains a continually refreshed snapshot of visible MCP servers.
+// Discovery maintains a continually refreshed snapshot of visible MCP servers, merged from
+// its providers.
 type Discovery struct {
 	opts     Options
+	logger   *log.Logger
 	snapshot atomic.Value
 
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
-	mu     sync.Mutex
+	// mu guards sources and serialises snapshot updates.
+	mu sync.Mutex
+	// sources hold each provider's records in precedence order. Index 0 is the static
+	// set managed with AddStatic, which overrides every provider. With a SnapshotFile,
+	// the last, at snapshotIndex, holds the restored servers.
+	sources       []*source
+	snapshotIndex int
+	// health holds the checked health of each instance in the snapshot.
+	health map[string]Health
+
+	// seq is the Seq of the latest event; it is guarded by mu, like every broadcast.
+	seq uint64
 
 	subMu       sync.RWMutex
-	subscribers map[chan Event]struct{}
+	subscribers map[chan Event]*subscriber
+
+	// persistMu guards the snapshot extensions and the restored state not yet claimed.
+	persistMu  sync.Mutex
+	extensions map[string]SnapshotExtension
+	restored   map[string]json.RawMessage
+}
+
+// subscriber is one Subscribe channel and the pump that resyncs it.
+type subscriber struct {
+	ch chan Event
+	// resync is set, under Discovery.mu, when the subscriber must be sent a snapshot: at
+	// first, and whenever an event did not fit its buffer. Events are not queued for it
+	// until the pump has delivered a snapshot that includes them.
+	resync bool
+	wake   chan struct{}
+	done   chan struct{}
+	pumped chan struct{}
+}
+
+// source is one provider's view of the mesh.
+type source struct {
+	name    string
+	records map[string]*record
+}
+
+type record struct {
+	info *ServerInfo
+	// expires is when the record lapses unless refreshed; zero never expires.
+	expires time.Time
+	// rivals are other endpoints claiming the instance name, keyed by address.
+	rivals map[string]*rival
 }
 
 // Default constants for the mDNS discovery loop.
@@ -69,6 +166,9 @@ const (
 	defaultPruneInterval = 15 * time.Second
 )
 
+// SourceStatic is the Source of servers added with AddStatic.
+const SourceStatic = "static"
+
 // Known server kinds advertised via TXT records.
 const (
 	ServerKindTool         = "tool"
@@ -80,65 +180,91 @@ const (
 // New returns a discovery instance ready to be started.
 func New(opts Options) *Discovery {
 	opts = opts.withDefaults()
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
 	d := &Discovery{
 		opts:        opts,
-		subscribers: make(map[chan Event]struct{}),
+		logger:      logger,
+		subscribers: make(map[chan Event]*subscriber),
+		sources:     []*source{{name: SourceStatic, records: make(map[string]*record)}},
+		health:      make(map[string]Health),
+		extensions:  make(map[string]SnapshotExtension),
+	}
+	for _, p := range opts.Providers {
+		d.sources = append(d.sources, &source{name: p.Name(), records: make(map[string]*record)})
+	}
+	if opts.SnapshotFile != "" {
+		d.snapshotIndex = len(d.sources)
+		d.sources = append(d.sources, &source{name: SourceSnapshot, records: make(map[string]*record)})
 	}
 	d.snapshot.Store(make(map[string]*ServerInfo))
 	return d
 }
 
-// Start launches the browsing and pruning goroutines. It is safe to call once.
+// Start restores the SnapshotFile, if any, and launches the providers and the pruning
+// goroutine. It is safe to call once.
 func (d *Discovery) Start(parent context.Context) error {
 	if parent == nil {
 		return errors.New("nil context")
 	}
 	ctx, cancel := context.WithCancel(parent)
 	d.cancel = cancel
-	entries := make(chan *zeroconf.ServiceEntry)
 
-	resolver, err := zeroconf.NewResolver(nil)
-	if err != nil {
-		cancel()
-		return fmt.Errorf("create resolver: %w", err)
+	if d.opts.SnapshotFile != "" {
+		if err := d.restoreSnapshot(); err != nil {
+			d.logger.Warn("discovery snapshot: restore failed; starting empty", "error", err)
+		}
 	}
 
-	d.wg.Add(1)
-	go func() {
-		defer d.wg.Done()
-		d.consumeEntries(ctx, entries)
-	}()
+	for i, p := range d.opts.Providers {
+		if err := p.Start(ctx, &Sink{d: d, index: i + 1}); err != nil {
+			cancel()
+			d.wg.Wait()
+			return fmt.Errorf("start %s discovery: %w", p.Name(), err)
+		}
+	}
 
 	d.wg.Add(1)
 	go func() {
 		defer d.wg.Done()
 		d.pruneLoop(ctx)
 	}()
-
-	// Launch browse in its own goroutine to avoid blocking Start.
-	d.wg.Add(1)
-	go func() {
-		defer d.wg.Done()
-		_ = resolver.Browse(ctx, d.opts.Service, d.opts.Domain, entries)
-		close(entries)
-	}()
+	if d.opts.SnapshotFile != "" {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.snapshotLoop(ctx)
+		}()
+	}
 
 	return nil
 }
 
-// Stop terminates discovery and waits for goroutines to finish.
+// Stop terminates discovery, waits for goroutines to finish and saves the SnapshotFile,
+// if any.
 func (d *Discovery) Stop() {
 	if d.cancel != nil {
 		d.cancel()
 	}
 	d.wg.Wait()
+	if d.opts.SnapshotFile != "" && d.cancel != nil {
+		if err := d.saveSnapshot(); err != nil {
+			d.logger.Warn("discovery snapshot: save failed", "file", d.opts.SnapshotFile, "error", err)
+		}
+	}
 
 	d.subMu.Lock()
-	for ch := range d.subscribers {
-		close(ch)
+	subs := make([]*subscriber, 0, len(d.subscribers))
+	for ch, sub := range d.subscribers {
+		subs = append(subs, sub)
 		delete(d.subscribers, ch)
 	}
 	d.subMu.Unlock()
+	for _, sub := range subs {
+		sub.close()
+	}
 }
 
 // ServersSnapshot returns a copy of the known servers map for safe iteration.
@@ -150,84 +276,161 @@ func (d *Discovery) ServersSnapshot() map[string]*ServerInfo {
 // Subscribe registers a listener channel that will receive discovery events.
 // The returned channel should be read until closed; when the discovery is stopped,
 // all subscriber channels are closed automatically.
+//
+// The first event is an EventResync with the current servers. Events never block
+// discovery: when the buffer is full, later events are dropped for this subscriber and
+// replaced by an EventResync once it catches up, so its view always converges.
 func (d *Discovery) Subscribe(buffer int) chan Event {
 	if buffer <= 0 {
 		buffer = 1
 	}
-	ch := make(chan Event, buffer)
+	sub := &subscriber{
+		ch:     make(chan Event, buffer),
+		resync: true,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		pumped: make(chan struct{}),
+	}
+	sub.wake <- struct{}{}
+	go d.pump(sub)
+
+	d.mu.Lock()
 	d.subMu.Lock()
-	d.subscribers[ch] = struct{}{}
+	d.subscribers[sub.ch] = sub
 	d.subMu.Unlock()
-	return ch
+	d.mu.Unlock()
+	return sub.ch
+}
+
+// SubscribeFunc calls fn with every event, in order, on a dedicated goroutine, until the
+// returned cancel is called or discovery stops. fn may block; events arriving meanwhile
+// are buffered and, beyond buffer, folded into an EventResync. cancel waits for fn to
+// return and must not be called from fn.
+func (d *Discovery) SubscribeFunc(buffer int, fn func(Event)) (cancel func()) {
+	ch := d.Subscribe(buffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for evt := range ch {
+			fn(evt)
+		}
+	}()
+	return func() {
+		d.Unsubscribe(ch)
+		<-done
+	}
 }
 
 // Unsubscribe removes the provided channel from the subscriber list and closes it.
 func (d *Discovery) Unsubscribe(ch chan Event) {
 	d.subMu.Lock()
-	if _, ok := d.subscribers[ch]; ok {
-		delete(d.subscribers, ch)
-		close(ch)
-	}
+	sub, ok := d.subscribers[ch]
+	delete(d.subscribers, ch)
 	d.subMu.Unlock()
+	if ok {
+		sub.close()
+	}
 }
 
-func (d *Discovery) consumeEntries(ctx context.Context, entries <-chan *zeroconf.ServiceEntry) {
+// pump delivers snapshots to a subscriber that needs a resync. It repeats the snapshot
+// until no event slipped past while the subscriber was taking it.
+func (d *Discovery) pump(sub *subscriber) {
+	defer close(sub.pumped)
 	for {
 		select {
-		case <-ctx.Done():
+		case <-sub.done:
 			return
-		case entry, ok := <-entries:
-			if !ok {
+		case <-sub.wake:
+		}
+		for {
+			d.mu.Lock()
+			seq := d.seq
+			snapshot := cloneServers(d.snapshot.Load().(map[string]*ServerInfo))
+			d.mu.Unlock()
+
+			select {
+			case sub.ch <- Event{Type: EventResync, Seq: seq, Snapshot: snapshot}:
+			case <-sub.done:
 				return
 			}
-			if entry == nil {
-				continue
+
+			d.mu.Lock()
+			caughtUp := d.seq == seq
+			if caughtUp {
+				sub.resync = false
+			}
+			d.mu.Unlock()
+			if caughtUp {
+				break
 			}
-			d.observe(entry)
 		}
 	}
 }
 
-func (d *Discovery) observe(entry *zeroconf.ServiceEntry) {
-	now := time.Now()
-	host := entry.HostName
-	address := host
-	if len(entry.AddrIPv4) > 0 {
-		address = net.JoinHostPort(entry.AddrIPv4[0].String(), fmt.Sprint(entry.Port))
-	} else if len(entry.AddrIPv6) > 0 {
-		address = net.JoinHostPort(entry.AddrIPv6[0].String(), fmt.Sprint(entry.Port))
-	} else {
-		address = net.JoinHostPort(entry.HostName, fmt.Sprint(entry.Port))
-	}
-
-	textMap := make(map[string]string, len(entry.Text))
-	for _, txt := range entry.Text {
-		if kv := parseTxtRecord(txt); len(kv) == 2 {
-			textMap[kv[0]] = kv[1]
-		}
+// close stops the pump, then closes the channel; nothing sends on it afterwards because
+// the subscriber has already left the map.
+func (sub *subscriber) close() {
+	close(sub.done)
+	<-sub.pumped
+	close(sub.ch)
+}
+
+// AddStatic registers a server that no provider reports, e.g. one on another network
+// segment. It overrides any provider's entry of the same instance name and never expires.
+func (d *Discovery) AddStatic(info *ServerInfo) error {
+	srv, err := normalizeStatic(info)
+	if err != nil {
+		return err
 	}
+	(&Sink{d: d, index: 0}).Upsert(srv, 0)
+	return nil
+}
 
-	srv := &ServerInfo{
-		Instance: entry.Instance,
-		Host:     host,
-		Port:     entry.Port,
-		Address:  address,
-		Kind:     classifyKind(textMap),
-		LastSeen: now,
-		Text:     textMap,
-	}
-
-	d.updateSnapshot(func(current map[string]*ServerInfo) map[string]*ServerInfo {
-		_, exists := current[entry.Instance]
-		clone := cloneServers(current)
-		clone[entry.Instance] = srv
-		if exists {
-			d.broadcast(Event{Type: EventUpdated, Server: cloneServerInfo(srv)})
-		} else {
-			d.broadcast(Event{Type: EventAdded, Server: cloneServerInfo(srv)})
+// RemoveStatic drops a server added with AddStatic. It reports false when the instance
+// was not static. A provider's entry of the same name, if any, takes its place.
+func (d *Discovery) RemoveStatic(instance string) bool {
+	removed := false
+	d.update(0, func(records map[string]*record) []string {
+		if _, ok := records[instance]; !ok {
+			return nil
 		}
-		return clone
+		delete(records, instance)
+		removed = true
+		return []string{instance}
 	})
+	return removed
+}
+
+// IsStatic reports whether instance was added with AddStatic.
+func (d *Discovery) IsStatic(instance string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.sources[0].records[instance]
+	return ok
+}
+
+// normalizeStatic validates a configured server and fills in its address and kind.
+func normalizeStatic(info *ServerInfo) (*ServerInfo, error) {
+	if info == nil || strings.TrimSpace(info.Instance) == "" {
+		return nil, errors.New("instance is required")
+	}
+	srv := cloneServerInfo(info)
+	if srv.Text == nil {
+		srv.Text = make(map[string]string)
+	}
+	if srv.Address == "" && len(srv.Addresses) > 0 {
+		srv.Address = srv.Addresses[0]
+	}
+	if srv.Address == "" {
+		if srv.Host == "" || srv.Port <= 0 {
+			return nil, fmt.Errorf("%s: address or host and port are required", srv.Instance)
+		}
+		srv.Address = net.JoinHostPort(srv.Host, fmt.Sprint(srv.Port))
+	}
+	if srv.Kind == "" {
+		srv.Kind = classifyKind(srv.Text)
+	}
+	return srv, nil
 }
 
 func (d *Discovery) pruneLoop(ctx context.Context) {
@@ -243,38 +446,97 @@ func (d *Discovery) pruneLoop(ctx context.Context) {
 	}
 }
 
+// pruneStale drops provider records that were not refreshed within their TTL, handing
+// the name to a live rival if there is one, and forgets lapsed rivals.
 func (d *Discovery) pruneStale() {
-	threshold := time.Now().Add(-d.opts.EntryTTL)
-	d.updateSnapshot(func(current map[string]*ServerInfo) map[string]*ServerInfo {
-		if len(current) == 0 {
-			return current
-		}
-		clone := cloneServers(current)
-		for key, info := range clone {
-			if info.LastSeen.Before(threshold) {
-				d.broadcast(Event{Type: EventRemoved, Server: cloneServerInfo(info)})
-				delete(clone, key)
+	now := time.Now()
+	for i := range d.sources {
+		d.update(i, func(records map[string]*record) []string {
+			var touched []string
+			for name, rec := range records {
+				switch {
+				case !rec.expires.IsZero() && rec.expires.Before(now):
+					if succ := rec.successor(now); succ != nil {
+						records[name] = succ
+					} else {
+						delete(records, name)
+					}
+					touched = append(touched, name)
+				case rec.pruneRivals(now):
+					touched = append(touched, name)
+				}
 			}
-		}
-		return clone
-	})
+			return touched
+		})
+	}
 }
 
-func (d *Discovery) updateSnapshot(modifier func(map[string]*ServerInfo) map[string]*ServerInfo) {
+// update changes the records of source index under the lock, then merges the touched
+// instances into the snapshot and broadcasts the resulting events.
+func (d *Discovery) update(index int, modify func(records map[string]*record) []string) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	touched := modify(d.sources[index].records)
+	if len(touched) == 0 {
+		return
+	}
 	current := d.snapshot.Load().(map[string]*ServerInfo)
-	updated := modifier(current)
-	d.snapshot.Store(updated)
+	clone := cloneServers(current)
+	for _, name := range touched {
+		winner, from := d.winner(name)
+		if d.snapshotIndex > 0 && from >= 0 && from != d.snapshotIndex {
+			// A provider confirmed the server; its restored entry must not outlive it.
+			delete(d.sources[d.snapshotIndex].records, name)
+		}
+		if from > 0 && !d.opts.Selector.Matches(winner) {
+			winner = nil
+		}
+		if winner != nil && winner.Signature != "" && winner.Signature != SignatureValid &&
+			d.opts.Verifier.Policy() == SignatureReject {
+			winner = nil
+		}
+		prev, existed := current[name]
+		if winner != nil && existed && prev.Address != winner.Address {
+			// Checks of the old address say nothing about the new one.
+			delete(d.health, name)
+		}
+		if winner != nil {
+			winner = cloneServerInfo(winner)
+			winner.Health = d.healthOf(name)
+		}
+		switch {
+		case winner == nil && existed:
+			delete(clone, name)
+			delete(d.health, name)
+			d.broadcast(Event{Type: EventRemoved, Server: cloneServerInfo(prev)})
+		case winner == nil:
+		case !existed:
+			clone[name] = winner
+			d.broadcast(Event{Type: EventAdded, Server: cloneServerInfo(winner)})
+		case from == index || prev.Source != winner.Source:
+			// A change from a provider that is overridden for this name is not news.
+			clone[name] = winner
+			d.broadcast(Event{Type: EventUpdated, Server: cloneServerInfo(winner), Changes: DiffText(prev.Text, winner.Text)})
+		}
+	}
+	d.snapshot.Store(clone)
 }
 
-func parseTxtRecord(txt string) []string {
-	for i := 0; i < len(txt); i++ {
-		if txt[i] == '=' {
-			return []string{txt[:i], txt[i+1:]}
+func (d *Discovery) healthOf(instance string) Health {
+	if h, ok := d.health[instance]; ok {
+		return h
+	}
+	return HealthUnknown
+}
+
+// winner returns the highest-precedence record for instance and its source index.
+func (d *Discovery) winner(instance string) (*ServerInfo, int) {
+	for i, src := range d.sources {
+		if rec, ok := src.records[instance]; ok {
+			return rec.info, i
 		}
 	}
-	return nil
+	return nil, -1
 }
 
 func cloneServers(in map[string]*ServerInfo) map[string]*ServerInfo {
@@ -298,6 +560,19 @@ func (o Options) withDefaults() Options {
 	if o.PruneInterval == 0 {
 		o.PruneInterval = defaultPruneInterval
 	}
+	if o.SnapshotInterval <= 0 {
+		o.SnapshotInterval = defaultSnapshotInterval
+	}
+	if o.SnapshotTTL <= 0 {
+		o.SnapshotTTL = defaultSnapshotTTL
+	}
+	if o.Providers == nil {
+		o.Providers = []Provider{NewMDNSProvider(MDNSOptions{
+			Service:  o.Service,
+			Domain:   o.Domain,
+			EntryTTL: o.EntryTTL,
+		})}
+	}
 	return o
 }
 
@@ -325,6 +600,8 @@ func cloneServerInfo(in *ServerInfo) *ServerInfo {
 		return nil
 	}
 	info := *in
+	info.Addresses = slices.Clone(in.Addresses)
+	info.Conflicts = slices.Clone(in.Conflicts)
 	if in.Text != nil {
 		textCopy := make(map[string]string, len(in.Text))
 		for tk, tv := range in.Text {
@@ -335,16 +612,28 @@ func cloneServerInfo(in *ServerInfo) *ServerInfo {
 	return &info
 }
 
+// broadcast numbers event and queues it for every subscriber that is not waiting for a
+// resync. Callers hold d.mu.
 func (d *Discovery) broadcast(event Event) {
 	if event.Server == nil {
 		return
 	}
+	d.seq++
+	event.Seq = d.seq
 	d.subMu.RLock()
 	defer d.subMu.RUnlock()
-	for ch := range d.subscribers {
+	for _, sub := range d.subscribers {
+		if sub.resync {
+			continue
+		}
 		select {
-		case ch <- event:
+		case sub.ch <- event:
 		default:
+			sub.resync = true
+			select {
+			case sub.wake <- struct{}{}:
+			default:
+			}
 		}
 	}
 }
@@ -0,0 +1,303 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+)
+
+// SourceDNSSD is the Source of servers found through unicast DNS-SD.
+const SourceDNSSD = "dnssd"
+
+const (
+	defaultDNSSDInterval = 30 * time.Second
+	defaultDNSSDTimeout  = 5 * time.Second
+)
+
+// DNSSDOptions configure a DNSSDProvider.
+type DNSSDOptions struct {
+	// Server is the DNS server to query, as host or host:port. Defaults to the first
+	// nameserver in /etc/resolv.conf.
+	Server string
+	// Domain holds the service records, e.g. "mesh.example.com".
+	Domain string
+	// Service is the service type browsed. Defaults to _mcp-http._tcp.
+	Service string
+	// Interval is how often the records are queried. Defaults to 30s. Servers expire
+	// after three intervals without a successful query.
+	Interval time.Duration
+	// Timeout bounds each DNS exchange. Defaults to 5s.
+	Timeout time.Duration
+	// Logger receives query errors. Defaults to discarding.
+	Logger *log.Logger
+}
+
+// DNSSDProvider browses service records on a unicast DNS server (RFC 6763), for networks
+// where a DNS server publishes PTR, SRV and TXT records but multicast is blocked.
+type DNSSDProvider struct {
+	opts   DNSSDOptions
+	udp    *dns.Client
+	tcp    *dns.Client
+	logger *log.Logger
+}
+
+// NewDNSSDProvider returns a provider for opts.Domain.
+func NewDNSSDProvider(opts DNSSDOptions) *DNSSDProvider {
+	if opts.Service == "" {
+		opts.Service = defaultService
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultDNSSDInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultDNSSDTimeout
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
+	return &DNSSDProvider{
+		opts:   opts,
+		udp:    &dns.Client{Timeout: opts.Timeout},
+		tcp:    &dns.Client{Net: "tcp", Timeout: opts.Timeout},
+		logger: logger,
+	}
+}
+
+// Name implements Provider.
+func (p *DNSSDProvider) Name() string { return SourceDNSSD }
+
+// Start implements Provider.
+func (p *DNSSDProvider) Start(ctx context.Context, sink *Sink) error {
+	if strings.TrimSpace(p.opts.Domain) == "" {
+		return errors.New("dns-sd domain is required")
+	}
+	server, err := resolveDNSServer(p.opts.Server)
+	if err != nil {
+		return err
+	}
+	p.opts.Server = server
+
+	sink.Go(func() {
+		ticker := time.NewTicker(p.opts.Interval)
+		defer ticker.Stop()
+		for {
+			p.refresh(ctx, sink)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	return nil
+}
+
+func (p *DNSSDProvider) refresh(ctx context.Context, sink *Sink) {
+	servers, err := p.Browse(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.logger.Warn("dns-sd query failed", "server", p.opts.Server, "domain", p.opts.Domain, "error", err)
+		}
+		return
+	}
+	sink.Replace(servers, 3*p.opts.Interval)
+}
+
+// Browse queries the service's instances and resolves each to a server. Instances that
+// fail to resolve are skipped.
+func (p *DNSSDProvider) Browse(ctx context.Context) ([]*ServerInfo, error) {
+	serviceName := dns.Fqdn(p.opts.Service + "." + strings.TrimSuffix(p.opts.Domain, "."))
+	resp, err := p.query(ctx, serviceName, dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]*ServerInfo, 0, len(resp.Answer))
+	for _, rr := range resp.Answer {
+		ptr, ok := rr.(*dns.PTR)
+		if !ok {
+			continue
+		}
+		srv, err := p.resolve(ctx, ptr.Ptr, serviceName)
+		if err != nil {
+			p.logger.Warn("dns-sd instance unresolved", "name", ptr.Ptr, "error", err)
+			continue
+		}
+		servers = append(servers, srv)
+	}
+	return servers, nil
+}
+
+// resolve turns a service instance name into a server from its SRV, TXT and address
+// records.
+func (p *DNSSDProvider) resolve(ctx context.Context, name, serviceName string) (*ServerInfo, error) {
+	srvResp, err := p.query(ctx, name, dns.TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+	var records []*dns.SRV
+	for _, rr := range srvResp.Answer {
+		if srv, ok := rr.(*dns.SRV); ok {
+			records = append(records, srv)
+		}
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no SRV record")
+	}
+	// Lowest priority first, then highest weight.
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		return records[i].Weight > records[j].Weight
+	})
+	target := records[0]
+
+	text := make(map[string]string)
+	txtResp, err := p.query(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range txtResp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			for _, entry := range txt.Txt {
+				if kv := parseTxtRecord(entry); len(kv) == 2 {
+					text[kv[0]] = kv[1]
+				}
+			}
+		}
+	}
+
+	host := strings.TrimSuffix(target.Target, ".")
+	port := strconv.Itoa(int(target.Port))
+	var addresses []string
+	for _, ip := range p.lookupIPs(ctx, target.Target, srvResp.Extra) {
+		addresses = append(addresses, net.JoinHostPort(ip.String(), port))
+	}
+	address := net.JoinHostPort(host, port)
+	if len(addresses) > 0 {
+		address = addresses[0]
+	}
+
+	return &ServerInfo{
+		Instance:  instanceLabel(name, serviceName),
+		Host:      host,
+		Port:      int(target.Port),
+		Address:   address,
+		Addresses: addresses,
+		Kind:      classifyKind(text),
+		Text:      text,
+	}, nil
+}
+
+// lookupIPs finds the addresses of host, from the additional records of the SRV
+// response when it carries any, otherwise with A and AAAA queries. It returns nil when
+// there are none, leaving the host name to the dialer.
+func (p *DNSSDProvider) lookupIPs(ctx context.Context, host string, extra []dns.RR) []net.IP {
+	if ips := addressRecords(host, extra); len(ips) > 0 {
+		return ips
+	}
+	var ips []net.IP
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		resp, err := p.query(ctx, host, qtype)
+		if err != nil {
+			continue
+		}
+		ips = append(ips, addressRecords(host, resp.Answer)...)
+	}
+	return ips
+}
+
+func addressRecords(host string, rrs []dns.RR) []net.IP {
+	var ips []net.IP
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Header().Name, host) {
+			continue
+		}
+		switch rec := rr.(type) {
+		case *dns.A:
+			ips = append(ips, rec.A)
+		case *dns.AAAA:
+			ips = append(ips, rec.AAAA)
+		}
+	}
+	return ips
+}
+
+// query sends one question, retrying over TCP when the UDP answer is truncated.
+func (p *DNSSDProvider) query(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	resp, _, err := p.udp.ExchangeContext(ctx, msg, p.opts.Server)
+	if err == nil && resp.Truncated {
+		resp, _, err = p.tcp.ExchangeContext(ctx, msg, p.opts.Server)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", dns.TypeToString[qtype], name, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("%s %s: %s", dns.TypeToString[qtype], name, dns.RcodeToString[resp.Rcode])
+	}
+	return resp, nil
+}
+
+// resolveDNSServer adds the default port to server, or picks the system resolver.
+func resolveDNSServer(server string) (string, error) {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil || len(conf.Servers) == 0 {
+			return "", errors.New("dns-sd server not set and no nameserver in /etc/resolv.conf")
+		}
+		return net.JoinHostPort(conf.Servers[0], conf.Port), nil
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		return net.JoinHostPort(server, "53"), nil
+	}
+	return server, nil
+}
+
+// instanceLabel extracts the instance name from a service instance name such as
+// `My\ Tools._mcp-http._tcp.example.com.`, undoing DNS presentation escapes.
+func instanceLabel(name, serviceName string) string {
+	label := name
+	if len(name) > len(serviceName) && strings.EqualFold(name[len(name)-len(serviceName):], serviceName) {
+		label = strings.TrimSuffix(name[:len(name)-len(serviceName)], ".")
+	}
+	return unescapeLabel(label)
+}
+
+// unescapeLabel undoes the DNS presentation escapes (`\ `, `\032`) of a single label.
+func unescapeLabel(label string) string {
+	var b strings.Builder
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if c != '\\' || i+1 >= len(label) {
+			b.WriteByte(c)
+			continue
+		}
+		if i+3 < len(label) && isDigit(label[i+1]) && isDigit(label[i+2]) && isDigit(label[i+3]) {
+			if n, err := strconv.Atoi(label[i+1 : i+4]); err == nil && n < 256 {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(label[i+1])
+		i++
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
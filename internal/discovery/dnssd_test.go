@@ -0,0 +1,307 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const testService = "_mcp-http._tcp.example.com."
+
+// zone is an in-process DNS server answering from fixed records over UDP and TCP on one
+// port.
+type zone struct {
+	addr    string
+	answers map[string][]dns.RR
+	extra   map[string][]dns.RR
+	// truncate lists the questions whose UDP answers are cut short with the TC bit.
+	truncate map[string]bool
+
+	mu      sync.Mutex
+	queries []string
+}
+
+func key(name string, qtype uint16) string {
+	return strings.ToLower(name) + " " + dns.TypeToString[qtype]
+}
+
+// serveZone starts a server for z and points z.addr at it.
+func serveZone(t *testing.T, z *zone) {
+	t.Helper()
+	var (
+		pc  net.PacketConn
+		ln  net.Listener
+		err error
+	)
+	for attempt := 0; attempt < 10; attempt++ {
+		if pc, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatalf("listen udp: %v", err)
+		}
+		if ln, err = net.Listen("tcp", pc.LocalAddr().String()); err == nil {
+			break
+		}
+		pc.Close()
+	}
+	if err != nil {
+		t.Fatalf("listen tcp: %v", err)
+	}
+	z.addr = pc.LocalAddr().String()
+	for _, server := range []*dns.Server{{PacketConn: pc, Handler: z}, {Listener: ln, Handler: z}} {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go server.ActivateAndServe()
+		<-started
+		t.Cleanup(func() { server.Shutdown() })
+	}
+}
+
+func (z *zone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+	k := key(q.Name, q.Qtype)
+	network := w.LocalAddr().Network()
+	z.mu.Lock()
+	z.queries = append(z.queries, network+" "+k)
+	z.mu.Unlock()
+
+	resp := new(dns.Msg)
+	resp.SetReply(r)
+	answers, ok := z.answers[k]
+	if !ok {
+		resp.Rcode = dns.RcodeNameError
+	}
+	if network == "udp" && z.truncate[k] {
+		resp.Truncated = true
+	} else {
+		resp.Answer = answers
+		resp.Extra = z.extra[k]
+	}
+	w.WriteMsg(resp)
+}
+
+func (z *zone) asked(network, name string, qtype uint16) bool {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return slices.Contains(z.queries, network+" "+key(name, qtype))
+}
+
+func ptr(instance string) dns.RR {
+	return &dns.PTR{Hdr: dns.RR_Header{Name: testService, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 60},
+		Ptr: instance + "." + testService}
+}
+
+func srv(instance string, priority, weight, port uint16, target string) dns.RR {
+	return &dns.SRV{Hdr: dns.RR_Header{Name: instance + "." + testService, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 60},
+		Priority: priority, Weight: weight, Port: port, Target: target}
+}
+
+func txt(instance string, entries ...string) dns.RR {
+	return &dns.TXT{Hdr: dns.RR_Header{Name: instance + "." + testService, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+		Txt: entries}
+}
+
+func a(host, ip string) dns.RR {
+	return &dns.A{Hdr: dns.RR_Header{Name: host, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.ParseIP(ip)}
+}
+
+func aaaa(host, ip string) dns.RR {
+	return &dns.AAAA{Hdr: dns.RR_Header{Name: host, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60}, AAAA: net.ParseIP(ip)}
+}
+
+func browseZone(t *testing.T, z *zone) []*ServerInfo {
+	t.Helper()
+	serveZone(t, z)
+	p := NewDNSSDProvider(DNSSDOptions{Server: z.addr, Domain: "example.com", Timeout: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	servers, err := p.Browse(ctx)
+	if err != nil {
+		t.Fatalf("Browse: %v", err)
+	}
+	return servers
+}
+
+func TestDNSSDBrowse(t *testing.T) {
+	z := &zone{
+		answers: map[string][]dns.RR{
+			key(testService, dns.TypePTR):              {ptr(`My\ Tools`)},
+			key(`My\ Tools.`+testService, dns.TypeSRV): {srv(`My\ Tools`, 0, 0, 8080, "tools.example.com.")},
+			key(`My\ Tools.`+testService, dns.TypeTXT): {txt(`My\ Tools`, "role=agent-wrapper", "path=/mcp")},
+			key("tools.example.com.", dns.TypeA):       {a("tools.example.com.", "10.0.0.7")},
+			key("tools.example.com.", dns.TypeAAAA):    {aaaa("tools.example.com.", "fd00::7")},
+		},
+	}
+	servers := browseZone(t, z)
+	if len(servers) != 1 {
+		t.Fatalf("got %d servers, want 1", len(servers))
+	}
+	got := servers[0]
+	if got.Instance != "My Tools" {
+		t.Errorf("Instance = %q, want %q", got.Instance, "My Tools")
+	}
+	if got.Host != "tools.example.com" || got.Port != 8080 {
+		t.Errorf("endpoint = %s:%d, want tools.example.com:8080", got.Host, got.Port)
+	}
+	if want := []string{"10.0.0.7:8080", "[fd00::7]:8080"}; !slices.Equal(got.Addresses, want) {
+		t.Errorf("Addresses = %v, want %v", got.Addresses, want)
+	}
+	if got.Address != "10.0.0.7:8080" {
+		t.Errorf("Address = %q, want the first address", got.Address)
+	}
+	if got.Kind != ServerKindAgentWrapper || got.Text["path"] != "/mcp" {
+		t.Errorf("Kind = %q, Text = %v, want agent-wrapper with path /mcp", got.Kind, got.Text)
+	}
+}
+
+func TestDNSSDResolve(t *testing.T) {
+	const name = "tools." + testService
+	tests := []struct {
+		name          string
+		srv           []dns.RR
+		extra         []dns.RR
+		address       []dns.RR
+		wantHost      string
+		wantAddresses []string
+		// wantLookup is whether an A query should be needed.
+		wantLookup bool
+	}{
+		{
+			name: "lowest priority wins",
+			srv: []dns.RR{
+				srv("tools", 20, 100, 9000, "backup.example.com."),
+				srv("tools", 10, 0, 8080, "primary.example.com."),
+			},
+			address:       []dns.RR{a("primary.example.com.", "10.0.0.1")},
+			wantHost:      "primary.example.com",
+			wantAddresses: []string{"10.0.0.1:8080"},
+			wantLookup:    true,
+		},
+		{
+			name: "highest weight breaks a tie",
+			srv: []dns.RR{
+				srv("tools", 10, 5, 8080, "light.example.com."),
+				srv("tools", 10, 50, 8080, "heavy.example.com."),
+			},
+			address:       []dns.RR{a("heavy.example.com.", "10.0.0.2")},
+			wantHost:      "heavy.example.com",
+			wantAddresses: []string{"10.0.0.2:8080"},
+			wantLookup:    true,
+		},
+		{
+			name:          "additional records spare the lookup",
+			srv:           []dns.RR{srv("tools", 0, 0, 8080, "tools.example.com.")},
+			extra:         []dns.RR{a("tools.example.com.", "10.0.0.3"), a("other.example.com.", "10.0.0.9")},
+			wantHost:      "tools.example.com",
+			wantAddresses: []string{"10.0.0.3:8080"},
+		},
+		{
+			name:       "no address leaves the host name",
+			srv:        []dns.RR{srv("tools", 0, 0, 8080, "tools.example.com.")},
+			wantHost:   "tools.example.com",
+			wantLookup: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := &zone{
+				answers: map[string][]dns.RR{
+					key(testService, dns.TypePTR): {ptr("tools")},
+					key(name, dns.TypeSRV):        tt.srv,
+					key(name, dns.TypeTXT):        {txt("tools")},
+				},
+				extra: map[string][]dns.RR{key(name, dns.TypeSRV): tt.extra},
+			}
+			for _, rr := range tt.address {
+				z.answers[key(rr.Header().Name, dns.TypeA)] = []dns.RR{rr}
+			}
+			servers := browseZone(t, z)
+			if len(servers) != 1 {
+				t.Fatalf("got %d servers, want 1", len(servers))
+			}
+			got := servers[0]
+			if got.Host != tt.wantHost {
+				t.Errorf("Host = %q, want %q", got.Host, tt.wantHost)
+			}
+			if !slices.Equal(got.Addresses, tt.wantAddresses) {
+				t.Errorf("Addresses = %v, want %v", got.Addresses, tt.wantAddresses)
+			}
+			wantAddress := tt.wantHost + ":8080"
+			if len(tt.wantAddresses) > 0 {
+				wantAddress = tt.wantAddresses[0]
+			}
+			if got.Address != wantAddress {
+				t.Errorf("Address = %q, want %q", got.Address, wantAddress)
+			}
+			if looked := z.asked("udp", tt.wantHost+".", dns.TypeA); looked != tt.wantLookup {
+				t.Errorf("A query sent = %v, want %v", looked, tt.wantLookup)
+			}
+		})
+	}
+}
+
+func TestDNSSDSkipsUnresolved(t *testing.T) {
+	z := &zone{
+		answers: map[string][]dns.RR{
+			key(testService, dns.TypePTR):          {ptr("gone"), ptr("tools")},
+			key("tools."+testService, dns.TypeSRV): {srv("tools", 0, 0, 8080, "tools.example.com.")},
+			key("tools."+testService, dns.TypeTXT): {txt("tools")},
+			key("tools.example.com.", dns.TypeA):   {a("tools.example.com.", "10.0.0.1")},
+		},
+	}
+	servers := browseZone(t, z)
+	if len(servers) != 1 || servers[0].Instance != "tools" {
+		t.Fatalf("got %v, want only tools", servers)
+	}
+}
+
+func TestDNSSDTruncatedFallsBackToTCP(t *testing.T) {
+	names := make([]dns.RR, 0, 3)
+	z := &zone{
+		answers:  map[string][]dns.RR{},
+		truncate: map[string]bool{key(testService, dns.TypePTR): true},
+	}
+	for _, instance := range []string{"one", "two", "three"} {
+		names = append(names, ptr(instance))
+		z.answers[key(instance+"."+testService, dns.TypeSRV)] = []dns.RR{srv(instance, 0, 0, 8080, instance+".example.com.")}
+		z.answers[key(instance+"."+testService, dns.TypeTXT)] = []dns.RR{txt(instance)}
+		z.answers[key(instance+".example.com.", dns.TypeA)] = []dns.RR{a(instance+".example.com.", "10.0.0.1")}
+	}
+	z.answers[key(testService, dns.TypePTR)] = names
+
+	servers := browseZone(t, z)
+	if len(servers) != 3 {
+		t.Fatalf("got %d servers, want 3", len(servers))
+	}
+	if !z.asked("tcp", testService, dns.TypePTR) {
+		t.Error("truncated PTR answer not retried over TCP")
+	}
+	if z.asked("tcp", "one."+testService, dns.TypeSRV) {
+		t.Error("complete SRV answer retried over TCP")
+	}
+}
+
+func TestInstanceLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "tools." + testService, want: "tools"},
+		{name: `My\ Tools.` + testService, want: "My Tools"},
+		{name: `My\032Tools.` + testService, want: "My Tools"},
+		{name: `tools\.v2.` + testService, want: "tools.v2"},
+		{name: `caf\195\169.` + testService, want: "café"},
+		{name: `back\\slash.` + testService, want: `back\slash`},
+		{name: `tools.` + strings.ToUpper(testService), want: "tools"},
+		{name: "tools.elsewhere.example.", want: "tools.elsewhere.example."},
+	}
+	for _, tt := range tests {
+		if got := instanceLabel(tt.name, testService); got != tt.want {
+			t.Errorf("instanceLabel(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
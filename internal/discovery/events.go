@@ -0,0 +1,78 @@
+package discovery
+
+import "sort"
+
+// ResyncEvents turns an EventResync into the added, updated, health-changed and removed
+// events that move a subscriber's view, known, to the resync snapshot. Subscribers that
+// keep their own map can replay these through their usual event handling.
+func ResyncEvents(known map[string]*ServerInfo, resync Event) []Event {
+	names := make([]string, 0, len(known)+len(resync.Snapshot))
+	for name := range known {
+		if _, ok := resync.Snapshot[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name := range resync.Snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var events []Event
+	for _, name := range names {
+		prev, had := known[name]
+		next, has := resync.Snapshot[name]
+		switch {
+		case had && !has:
+			events = append(events, Event{Type: EventRemoved, Server: prev, Seq: resync.Seq})
+		case !had:
+			events = append(events, Event{Type: EventAdded, Server: next, Seq: resync.Seq})
+		default:
+			if !sameServer(prev, next) || prev.Source != next.Source {
+				events = append(events, Event{Type: EventUpdated, Server: next, Seq: resync.Seq, Changes: DiffText(prev.Text, next.Text)})
+			}
+			if prev.Health != next.Health {
+				events = append(events, Event{Type: EventHealthChanged, Server: next, Seq: resync.Seq})
+			}
+		}
+	}
+	return events
+}
+
+// TextChange is a TXT key whose value differs between two versions of a server. Added
+// and Removed mark keys that only one version has.
+type TextChange struct {
+	Key     string `json:"key"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+	Added   bool   `json:"added,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// DiffText returns the keys that were added, removed or changed going from prev to next,
+// in key order.
+func DiffText(prev, next map[string]string) []TextChange {
+	var changes []TextChange
+	for k, old := range prev {
+		if v, ok := next[k]; !ok {
+			changes = append(changes, TextChange{Key: k, Old: old, Removed: true})
+		} else if v != old {
+			changes = append(changes, TextChange{Key: k, Old: old, New: v})
+		}
+	}
+	for k, v := range next {
+		if _, ok := prev[k]; !ok {
+			changes = append(changes, TextChange{Key: k, New: v, Added: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// ChangedKeys returns the keys of changes, e.g. for logging.
+func ChangedKeys(changes []TextChange) []string {
+	keys := make([]string, len(changes))
+	for i, c := range changes {
+		keys[i] = c.Key
+	}
+	return keys
+}
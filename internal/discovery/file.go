@@ -0,0 +1,168 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/charmbracelet/log"
+	"gopkg.in/yaml.v3"
+)
+
+// SourceFile is the Source of servers listed in a discovery file.
+const SourceFile = "file"
+
+const defaultFilePollInterval = 5 * time.Second
+
+// FileOptions configure a FileProvider.
+type FileOptions struct {
+	// Path is a JSON (.json) or YAML file listing servers:
+	//
+	//	servers:
+	//	  - instance: calc
+	//	    address: calc.tools.svc:9000
+	//	    text: {role: tool, protocol: jsonrpc}
+	Path string
+	// PollInterval is how often the file is checked for changes. Defaults to 5s.
+	PollInterval time.Duration
+	// Logger receives reload errors. Defaults to discarding.
+	Logger *log.Logger
+}
+
+// FileProvider lists the servers in a file and reloads them when it changes, for
+// networks where multicast does not reach (Docker networks, Kubernetes, VPNs). Its
+// servers never expire; removing one from the file withdraws it.
+type FileProvider struct {
+	opts   FileOptions
+	logger *log.Logger
+}
+
+// fileEntry is one server in a discovery file.
+type fileEntry struct {
+	Instance string `json:"instance" yaml:"instance"`
+	Address  string `json:"address" yaml:"address"`
+	// Addresses are alternatives to Address, for servers on several networks.
+	Addresses []string          `json:"addresses" yaml:"addresses"`
+	Host      string            `json:"host" yaml:"host"`
+	Port      int               `json:"port" yaml:"port"`
+	Kind      string            `json:"kind" yaml:"kind"`
+	Text      map[string]string `json:"text" yaml:"text"`
+}
+
+// NewFileProvider returns a provider reading opts.Path.
+func NewFileProvider(opts FileOptions) *FileProvider {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultFilePollInterval
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
+	return &FileProvider{opts: opts, logger: logger}
+}
+
+// Name implements Provider.
+func (p *FileProvider) Name() string { return SourceFile }
+
+// Start implements Provider. The file must load on start; later reload errors are logged
+// and keep the previous servers.
+func (p *FileProvider) Start(ctx context.Context, sink *Sink) error {
+	data, err := os.ReadFile(p.opts.Path)
+	if err != nil {
+		return fmt.Errorf("read discovery file: %w", err)
+	}
+	servers, err := p.parse(data)
+	if err != nil {
+		return err
+	}
+	sink.Replace(servers, 0)
+
+	sink.Go(func() {
+		p.watch(ctx, sink, data)
+	})
+	return nil
+}
+
+// watch polls the file, reloading it whenever its contents change. Polling rather than
+// inotify also catches the symlink swaps Kubernetes uses to update mounted ConfigMaps.
+func (p *FileProvider) watch(ctx context.Context, sink *Sink, loaded []byte) {
+	ticker := time.NewTicker(p.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		data, err := os.ReadFile(p.opts.Path)
+		if err != nil {
+			p.logger.Warn("discovery file unreadable; keeping previous servers", "path", p.opts.Path, "error", err)
+			continue
+		}
+		if bytes.Equal(data, loaded) {
+			continue
+		}
+		servers, err := p.parse(data)
+		if err != nil {
+			p.logger.Warn("discovery file invalid; keeping previous servers", "path", p.opts.Path, "error", err)
+			loaded = data
+			continue
+		}
+		loaded = data
+		sink.Replace(servers, 0)
+		p.logger.Info("discovery file reloaded", "path", p.opts.Path, "servers", len(servers))
+	}
+}
+
+func (p *FileProvider) parse(data []byte) ([]*ServerInfo, error) {
+	var doc struct {
+		Servers []fileEntry `json:"servers" yaml:"servers"`
+	}
+	var err error
+	if strings.EqualFold(filepath.Ext(p.opts.Path), ".json") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse discovery file: %w", err)
+	}
+	servers := make([]*ServerInfo, 0, len(doc.Servers))
+	seen := make(map[string]struct{}, len(doc.Servers))
+	for i, e := range doc.Servers {
+		srv, err := normalizeStatic(&ServerInfo{
+			Instance:  strings.TrimSpace(e.Instance),
+			Address:   strings.TrimSpace(e.Address),
+			Addresses: trimAll(e.Addresses),
+			Host:      strings.TrimSpace(e.Host),
+			Port:      e.Port,
+			Kind:      strings.TrimSpace(e.Kind),
+			Text:      e.Text,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("discovery file server %d: %w", i, err)
+		}
+		if _, dup := seen[srv.Instance]; dup {
+			return nil, fmt.Errorf("discovery file: duplicate instance %s", srv.Instance)
+		}
+		seen[srv.Instance] = struct{}{}
+		servers = append(servers, srv)
+	}
+	return servers, nil
+}
+
+func trimAll(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,230 @@
+package discovery
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/charmbracelet/log"
+)
+
+// Health is the result of active health checks on a server.
+type Health string
+
+// Health states. Servers start out unknown until a HealthChecker has probed them.
+const (
+	HealthUnknown Health = "unknown"
+	HealthUp      Health = "up"
+	HealthDown    Health = "down"
+)
+
+// EventHealthChanged is emitted when a server's Health changes.
+const EventHealthChanged EventType = "health_changed"
+
+// Probe checks one server, returning nil when it is healthy.
+type Probe func(ctx context.Context, server *ServerInfo) error
+
+const (
+	defaultHealthInterval     = 15 * time.Second
+	defaultHealthTimeout      = 5 * time.Second
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+	maxConcurrentHealthProbes = 16
+)
+
+// HealthOptions configure a HealthChecker.
+type HealthOptions struct {
+	// Probe checks a server. Required.
+	Probe Probe
+	// Kinds limits checks to these server kinds. Empty checks every server.
+	Kinds []string
+	// Interval between rounds of checks. Defaults to 15s.
+	Interval time.Duration
+	// Timeout bounds each probe. Defaults to 5s.
+	Timeout time.Duration
+	// HealthyThreshold is the number of consecutive successes that bring a down server
+	// back up. Defaults to 2. An unknown server is up after its first success.
+	HealthyThreshold int
+	// UnhealthyThreshold is the number of consecutive failures that mark a server down.
+	// Defaults to 3.
+	UnhealthyThreshold int
+	// Logger receives health transitions. Defaults to discarding.
+	Logger *log.Logger
+}
+
+// HealthChecker probes the servers of a Discovery and records their Health on it.
+type HealthChecker struct {
+	d      *Discovery
+	opts   HealthOptions
+	kinds  map[string]struct{}
+	logger *log.Logger
+
+	mu       sync.Mutex
+	counters map[string]*healthCounter
+}
+
+type healthCounter struct {
+	// address is where the counted probes went; a server that moves starts over.
+	address   string
+	successes int
+	failures  int
+	lastError string
+}
+
+// NewHealthChecker returns a checker for d. Call Run to start it.
+func NewHealthChecker(d *Discovery, opts HealthOptions) *HealthChecker {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultHealthInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultHealthTimeout
+	}
+	if opts.HealthyThreshold <= 0 {
+		opts.HealthyThreshold = defaultHealthyThreshold
+	}
+	if opts.UnhealthyThreshold <= 0 {
+		opts.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
+	kinds := make(map[string]struct{}, len(opts.Kinds))
+	for _, k := range opts.Kinds {
+		kinds[strings.ToLower(strings.TrimSpace(k))] = struct{}{}
+	}
+	return &HealthChecker{
+		d:        d,
+		opts:     opts,
+		kinds:    kinds,
+		logger:   logger,
+		counters: make(map[string]*healthCounter),
+	}
+}
+
+// Run checks every server each interval until ctx ends.
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.opts.Interval)
+	defer ticker.Stop()
+	for {
+		h.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll runs one round of probes and waits for it to finish.
+func (h *HealthChecker) CheckAll(ctx context.Context) {
+	snapshot := h.d.ServersSnapshot()
+	h.forget(snapshot)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxConcurrentHealthProbes)
+	for _, srv := range snapshot {
+		if len(h.kinds) > 0 {
+			if _, ok := h.kinds[strings.ToLower(strings.TrimSpace(srv.Kind))]; !ok {
+				continue
+			}
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(srv *ServerInfo) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			probeCtx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
+			err := h.opts.Probe(probeCtx, srv)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			h.record(srv, err)
+		}(srv)
+	}
+	wg.Wait()
+}
+
+// record counts a probe result and moves the server up or down when a threshold is met.
+func (h *HealthChecker) record(srv *ServerInfo, err error) {
+	h.mu.Lock()
+	c, ok := h.counters[srv.Instance]
+	if !ok || c.address != srv.Address {
+		c = &healthCounter{address: srv.Address}
+		h.counters[srv.Instance] = c
+	}
+	next := srv.Health
+	if err == nil {
+		c.successes++
+		c.failures = 0
+		c.lastError = ""
+		if srv.Health != HealthUp && (srv.Health != HealthDown || c.successes >= h.opts.HealthyThreshold) {
+			next = HealthUp
+		}
+	} else {
+		c.failures++
+		c.successes = 0
+		c.lastError = err.Error()
+		if srv.Health != HealthDown && c.failures >= h.opts.UnhealthyThreshold {
+			next = HealthDown
+		}
+	}
+	h.mu.Unlock()
+
+	if next == srv.Health {
+		return
+	}
+	if !h.d.setHealth(srv, next) {
+		return
+	}
+	if next == HealthDown {
+		h.logger.Warn("server unhealthy", "instance", srv.Instance, "failures", h.opts.UnhealthyThreshold, "error", err)
+	} else {
+		h.logger.Info("server healthy", "instance", srv.Instance)
+	}
+}
+
+// forget drops counters for servers that have left the snapshot or moved.
+func (h *HealthChecker) forget(snapshot map[string]*ServerInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for name, c := range h.counters {
+		if srv, ok := snapshot[name]; !ok || srv.Address != c.address {
+			delete(h.counters, name)
+		}
+	}
+}
+
+// LastError returns the error of the latest failed probe of instance, if the server has
+// not succeeded since.
+func (h *HealthChecker) LastError(instance string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c, ok := h.counters[instance]; ok {
+		return c.lastError
+	}
+	return ""
+}
+
+// setHealth records the health of probed and broadcasts EventHealthChanged. It reports
+// false when the server is no longer known at the probed address or already had that
+// health.
+func (d *Discovery) setHealth(probed *ServerInfo, health Health) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	instance := probed.Instance
+	current := d.snapshot.Load().(map[string]*ServerInfo)
+	srv, ok := current[instance]
+	if !ok || srv.Address != probed.Address || srv.Health == health {
+		return false
+	}
+	d.health[instance] = health
+	clone := cloneServers(current)
+	clone[instance].Health = health
+	d.snapshot.Store(clone)
+	d.broadcast(Event{Type: EventHealthChanged, Server: cloneServerInfo(clone[instance])})
+	return true
+}
@@ -0,0 +1,44 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHealthResetWhenServerMoves(t *testing.T) {
+	d, sink := testSink(SourceMDNS, Options{})
+	sink.Upsert(endpoint("tools", "10.0.0.1"), time.Minute)
+	sink.Upsert(endpoint("tools", "10.0.0.2"), time.Minute)
+	checker := NewHealthChecker(d, HealthOptions{
+		Probe:              func(context.Context, *ServerInfo) error { return errors.New("connection refused") },
+		UnhealthyThreshold: 2,
+	})
+	ctx := context.Background()
+	checker.CheckAll(ctx)
+	checker.CheckAll(ctx)
+	old := d.ServersSnapshot()["tools"]
+	if old.Health != HealthDown {
+		t.Fatalf("health at the old address = %s, want down", old.Health)
+	}
+
+	// The holder leaves and the rival at another address takes the name over.
+	sink.Withdraw("tools", net.ParseIP("10.0.0.1"))
+	moved := d.ServersSnapshot()["tools"]
+	if moved.Address != "10.0.0.2:8080" || moved.Health != HealthUnknown {
+		t.Fatalf("after the move: %s %s, want 10.0.0.2:8080 unknown", moved.Address, moved.Health)
+	}
+
+	// Failures counted against the old address do not carry over.
+	checker.CheckAll(ctx)
+	if got := d.ServersSnapshot()["tools"].Health; got != HealthUnknown {
+		t.Errorf("health after one failure at the new address = %s, want unknown", got)
+	}
+	// A probe of the old address that finishes late does not decide the new one.
+	checker.record(old, nil)
+	if got := d.ServersSnapshot()["tools"].Health; got != HealthUnknown {
+		t.Errorf("health after a late probe of the old address = %s, want unknown", got)
+	}
+}
@@ -0,0 +1,332 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/charmbracelet/log"
+	"github.com/libp2p/zeroconf/v2"
+	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// SourceMDNS is the Source of servers found by browsing mDNS.
+const SourceMDNS = "mdns"
+
+// mdnsQueryWindow is how long each re-query listens for answers.
+const mdnsQueryWindow = 2 * time.Second
+
+var (
+	mdnsGroupIPv4 = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	mdnsGroupIPv6 = &net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: 5353}
+)
+
+// MDNSOptions configure mDNS browsing.
+type MDNSOptions struct {
+	Service string
+	Domain  string
+	// EntryTTL is how long a sighting keeps a server listed when its records carry no
+	// TTL. Otherwise the advertised TTL is honoured.
+	EntryTTL time.Duration
+	// RequeryInterval is how often the service is queried afresh, so that responders
+	// re-announce and their entries are refreshed before the TTL lapses. Defaults to a
+	// third of EntryTTL.
+	RequeryInterval time.Duration
+	// Logger receives browse errors. Defaults to discarding.
+	Logger *log.Logger
+}
+
+// MDNSProvider browses zeroconf for MCP servers on the local network.
+type MDNSProvider struct {
+	opts   MDNSOptions
+	logger *log.Logger
+}
+
+// NewMDNSProvider returns a provider browsing opts.Service in opts.Domain.
+func NewMDNSProvider(opts MDNSOptions) *MDNSProvider {
+	if opts.Service == "" {
+		opts.Service = defaultService
+	}
+	if opts.Domain == "" {
+		opts.Domain = defaultDomain
+	}
+	if opts.EntryTTL == 0 {
+		opts.EntryTTL = defaultEntryTTL
+	}
+	if opts.RequeryInterval <= 0 {
+		opts.RequeryInterval = opts.EntryTTL / 3
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
+	return &MDNSProvider{opts: opts, logger: logger}
+}
+
+// Name implements Provider.
+func (p *MDNSProvider) Name() string { return SourceMDNS }
+
+// Start implements Provider. Besides browsing, it listens for unsolicited announcements:
+// goodbye packets (records with a TTL of zero, sent by a stopping Announcer), so servers
+// shutting down cleanly are removed at once rather than when their TTL lapses, and TXT
+// records re-announced by Announcer.Update, so changes show up without a re-query.
+func (p *MDNSProvider) Start(ctx context.Context, sink *Sink) error {
+	if err := p.watchAnnouncements(ctx, sink); err != nil {
+		p.logger.Warn("mDNS announcements not monitored; stopped servers linger until their TTL", "err", err)
+	}
+
+	// Launch browse in its own goroutine to avoid blocking Start.
+	sink.Go(func() {
+		p.browse(ctx, sink)
+	})
+	sink.Go(func() {
+		p.requery(ctx, sink)
+	})
+	return nil
+}
+
+// browse feeds entries found by browsing to sink until ctx ends. Each instance is
+// reported once, so later sightings come from requery.
+func (p *MDNSProvider) browse(ctx context.Context, sink *Sink) {
+	entries := make(chan *zeroconf.ServiceEntry)
+	go func() {
+		// Browse closes entries once ctx is done; goodbyes are not passed on.
+		if err := zeroconf.Browse(ctx, p.opts.Service, p.opts.Domain, entries); err != nil {
+			p.logger.Warn("mDNS browse failed", "err", err)
+		}
+	}()
+	for entry := range entries {
+		if entry == nil {
+			continue
+		}
+		sink.Upsert(serverFromEntry(entry), p.entryTTL(entry))
+	}
+}
+
+// requery browses afresh every RequeryInterval, for mdnsQueryWindow, so every live
+// responder answers again and its entry is refreshed.
+func (p *MDNSProvider) requery(ctx context.Context, sink *Sink) {
+	ticker := time.NewTicker(p.opts.RequeryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		queryCtx, cancel := context.WithTimeout(ctx, mdnsQueryWindow)
+		p.browse(queryCtx, sink)
+		cancel()
+	}
+}
+
+// entryTTL is the TTL advertised by entry, or EntryTTL when it advertises none.
+func (p *MDNSProvider) entryTTL(entry *zeroconf.ServiceEntry) time.Duration {
+	if entry.Expiry.IsZero() {
+		return p.opts.EntryTTL
+	}
+	return time.Until(entry.Expiry).Round(time.Second)
+}
+
+// watchAnnouncements joins the mDNS groups and passes every packet received to
+// handleAnnouncement. It fails only if neither IPv4 nor IPv6 can be joined.
+func (p *MDNSProvider) watchAnnouncements(ctx context.Context, sink *Sink) error {
+	ifaces := multicastInterfaces()
+	// Readers return the packet length and its source address.
+	var readers []func([]byte) (int, net.IP, error)
+	var closers []io.Closer
+
+	conn4, err4 := net.ListenUDP("udp4", mdnsGroupIPv4)
+	if err4 == nil {
+		pc := ipv4.NewPacketConn(conn4)
+		joined := 0
+		for i := range ifaces {
+			if pc.JoinGroup(&ifaces[i], &net.UDPAddr{IP: mdnsGroupIPv4.IP}) == nil {
+				joined++
+			}
+		}
+		if joined == 0 {
+			conn4.Close()
+			err4 = fmt.Errorf("udp4: no interface joined %s", mdnsGroupIPv4.IP)
+		} else {
+			readers = append(readers, func(b []byte) (int, net.IP, error) {
+				n, _, src, err := pc.ReadFrom(b)
+				return n, sourceIP(src), err
+			})
+			closers = append(closers, conn4)
+		}
+	}
+	conn6, err6 := net.ListenUDP("udp6", mdnsGroupIPv6)
+	if err6 == nil {
+		pc := ipv6.NewPacketConn(conn6)
+		joined := 0
+		for i := range ifaces {
+			if pc.JoinGroup(&ifaces[i], &net.UDPAddr{IP: mdnsGroupIPv6.IP}) == nil {
+				joined++
+			}
+		}
+		if joined == 0 {
+			conn6.Close()
+			err6 = fmt.Errorf("udp6: no interface joined %s", mdnsGroupIPv6.IP)
+		} else {
+			readers = append(readers, func(b []byte) (int, net.IP, error) {
+				n, _, src, err := pc.ReadFrom(b)
+				return n, sourceIP(src), err
+			})
+			closers = append(closers, conn6)
+		}
+	}
+	if len(readers) == 0 {
+		return fmt.Errorf("%v; %v", err4, err6)
+	}
+
+	sink.Go(func() {
+		<-ctx.Done()
+		for _, c := range closers {
+			c.Close()
+		}
+	})
+	serviceName := dns.Fqdn(strings.Trim(p.opts.Service, ".") + "." + strings.Trim(p.opts.Domain, "."))
+	for _, read := range readers {
+		sink.Go(func() {
+			buf := make([]byte, 65536)
+			for {
+				n, from, err := read(buf)
+				if err != nil {
+					return
+				}
+				p.handleAnnouncement(sink, buf[:n], from, serviceName)
+			}
+		})
+	}
+	return nil
+}
+
+// handleAnnouncement applies an unsolicited packet sent from the address from: instances
+// whose PTR record it announces with a zero TTL are withdrawn if from is their host (see
+// Sink.Withdraw), and TXT records it announces for known instances are applied.
+func (p *MDNSProvider) handleAnnouncement(sink *Sink, packet []byte, from net.IP, serviceName string) {
+	gone, texts := announcements(packet, serviceName)
+	for _, instance := range gone {
+		// Only the server's own host may say goodbye for it.
+		if sink.Has(instance) && !sink.Withdraw(instance, from) {
+			p.logger.Debug("mDNS goodbye ignored: sender is not the server", "instance", instance, "from", from)
+		}
+	}
+	for _, t := range texts {
+		// Unknown instances are left to browsing, which resolves their address.
+		sink.UpdateText(t.instance, t.text, t.ttl)
+	}
+}
+
+// textUpdate is a TXT record announced for an instance.
+type textUpdate struct {
+	instance string
+	text     map[string]string
+	ttl      time.Duration
+}
+
+// announcements returns the instances a response packet withdraws from serviceName and
+// the TXT records it announces for instances of serviceName.
+func announcements(packet []byte, serviceName string) (gone []string, texts []textUpdate) {
+	var msg dns.Msg
+	if err := msg.Unpack(packet); err != nil || !msg.Response {
+		return nil, nil
+	}
+	for _, rr := range msg.Answer {
+		switch rr := rr.(type) {
+		case *dns.PTR:
+			if rr.Hdr.Ttl == 0 && strings.EqualFold(rr.Hdr.Name, serviceName) {
+				gone = append(gone, instanceLabel(rr.Ptr, serviceName))
+			}
+		case *dns.TXT:
+			name := rr.Hdr.Name
+			if rr.Hdr.Ttl == 0 || len(name) <= len(serviceName) ||
+				!strings.EqualFold(name[len(name)-len(serviceName):], serviceName) {
+				continue
+			}
+			texts = append(texts, textUpdate{
+				instance: instanceLabel(name, serviceName),
+				text:     parseTxtRecords(rr.Txt),
+				ttl:      time.Duration(rr.Hdr.Ttl) * time.Second,
+			})
+		}
+	}
+	return gone, texts
+}
+
+// sourceIP returns the IP address of a packet's sender, or nil.
+func sourceIP(addr net.Addr) net.IP {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp.IP
+	}
+	return nil
+}
+
+func multicastInterfaces() []net.Interface {
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var out []net.Interface
+	for _, iface := range all {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 {
+			out = append(out, iface)
+		}
+	}
+	return out
+}
+
+func serverFromEntry(entry *zeroconf.ServiceEntry) *ServerInfo {
+	host := entry.HostName
+	port := fmt.Sprint(entry.Port)
+	// IPv4 first, as before multi-address support; the dialer interleaves families.
+	var addresses []string
+	for _, ip := range entry.AddrIPv4 {
+		addresses = append(addresses, net.JoinHostPort(ip.String(), port))
+	}
+	for _, ip := range entry.AddrIPv6 {
+		addresses = append(addresses, net.JoinHostPort(ip.String(), port))
+	}
+	address := net.JoinHostPort(host, port)
+	if len(addresses) > 0 {
+		address = addresses[0]
+	}
+
+	textMap := parseTxtRecords(entry.Text)
+
+	return &ServerInfo{
+		// zeroconf leaves the instance in presentation format, e.g. `My\ Tools`.
+		Instance:  unescapeLabel(entry.Instance),
+		Host:      host,
+		Port:      entry.Port,
+		Address:   address,
+		Addresses: addresses,
+		Kind:      classifyKind(textMap),
+		Text:      textMap,
+	}
+}
+
+func parseTxtRecords(records []string) map[string]string {
+	text := make(map[string]string, len(records))
+	for _, txt := range records {
+		if kv := parseTxtRecord(txt); len(kv) == 2 {
+			text[kv[0]] = kv[1]
+		}
+	}
+	return text
+}
+
+func parseTxtRecord(txt string) []string {
+	for i := 0; i < len(txt); i++ {
+		if txt[i] == '=' {
+			return []string{txt[:i], txt[i+1:]}
+		}
+	}
+	return nil
+}
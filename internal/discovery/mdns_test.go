@@ -0,0 +1,227 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/libp2p/zeroconf/v2"
+	"github.com/miekg/dns"
+)
+
+const mdnsService = "_mcp-http._tcp.local."
+
+// nopProvider stands in for a provider whose sink a test drives directly.
+type nopProvider struct{ name string }
+
+func (p nopProvider) Name() string                       { return p.name }
+func (p nopProvider) Start(context.Context, *Sink) error { return nil }
+
+// testSink returns a discovery with one provider named name and that provider's sink.
+func testSink(name string, opts Options) (*Discovery, *Sink) {
+	opts.Providers = []Provider{nopProvider{name: name}}
+	d := New(opts)
+	return d, &Sink{d: d, index: 1}
+}
+
+func endpoint(instance, ip string) *ServerInfo {
+	addr := net.JoinHostPort(ip, "8080")
+	return &ServerInfo{Instance: instance, Host: instance + ".local", Port: 8080, Address: addr, Addresses: []string{addr}}
+}
+
+func goodbye(instance string) dns.RR {
+	return &dns.PTR{Hdr: dns.RR_Header{Name: mdnsService, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 0},
+		Ptr: instance + "." + mdnsService}
+}
+
+func announcedText(instance string, ttl uint32, entries ...string) dns.RR {
+	return &dns.TXT{Hdr: dns.RR_Header{Name: instance + "." + mdnsService, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl},
+		Txt: entries}
+}
+
+func packet(t *testing.T, response bool, answers ...dns.RR) []byte {
+	t.Helper()
+	msg := &dns.Msg{MsgHdr: dns.MsgHdr{Response: response}, Answer: answers}
+	data, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	return data
+}
+
+func TestAnnouncements(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  bool
+		answers   []dns.RR
+		wantGone  []string
+		wantTexts map[string]string
+	}{
+		{
+			name:     "goodbye",
+			response: true,
+			answers:  []dns.RR{goodbye("tools")},
+			wantGone: []string{"tools"},
+		},
+		{
+			name:     "escaped instance",
+			response: true,
+			answers:  []dns.RR{goodbye(`My\ Tools`)},
+			wantGone: []string{"My Tools"},
+		},
+		{
+			name:     "live PTR is no goodbye",
+			response: true,
+			answers: []dns.RR{&dns.PTR{Hdr: dns.RR_Header{Name: mdnsService, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 120},
+				Ptr: "tools." + mdnsService}},
+		},
+		{
+			name:     "other service",
+			response: true,
+			answers: []dns.RR{&dns.PTR{Hdr: dns.RR_Header{Name: "_http._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET},
+				Ptr: "tools._http._tcp.local."}},
+		},
+		{
+			name:     "query is ignored",
+			response: false,
+			answers:  []dns.RR{goodbye("tools")},
+		},
+		{
+			name:      "TXT update",
+			response:  true,
+			answers:   []dns.RR{announcedText("tools", 120, "role=tool", "env=prod")},
+			wantTexts: map[string]string{"tools": "env=prod"},
+		},
+		{
+			name:     "TXT withdrawn is no update",
+			response: true,
+			answers:  []dns.RR{announcedText("tools", 0, "env=prod")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gone, texts := announcements(packet(t, tt.response, tt.answers...), mdnsService)
+			if !slices.Equal(gone, tt.wantGone) {
+				t.Errorf("gone = %v, want %v", gone, tt.wantGone)
+			}
+			if len(texts) != len(tt.wantTexts) {
+				t.Fatalf("texts = %+v, want %d", texts, len(tt.wantTexts))
+			}
+			for _, text := range texts {
+				want, ok := tt.wantTexts[text.instance]
+				if !ok || "env="+text.text["env"] != want {
+					t.Errorf("text for %s = %v, want %s", text.instance, text.text, want)
+				}
+				if text.ttl != 120*time.Second {
+					t.Errorf("text ttl = %v, want 2m", text.ttl)
+				}
+			}
+		})
+	}
+}
+
+func TestEntryTTL(t *testing.T) {
+	p := NewMDNSProvider(MDNSOptions{EntryTTL: 45 * time.Second})
+	tests := []struct {
+		name   string
+		expiry time.Time
+		want   time.Duration
+	}{
+		{name: "no expiry uses EntryTTL", want: 45 * time.Second},
+		{name: "advertised TTL", expiry: time.Now().Add(120 * time.Second), want: 120 * time.Second},
+		{name: "short TTL", expiry: time.Now().Add(10 * time.Second), want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		entry := &zeroconf.ServiceEntry{Expiry: tt.expiry}
+		if got := p.entryTTL(entry); got != tt.want {
+			t.Errorf("%s: entryTTL = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	tests := []struct {
+		name   string
+		holder string
+		rival  string
+		from   string
+		// wantDropped is Withdraw's result; wantHolder the address holding the name
+		// afterwards, empty when it is gone.
+		wantDropped   bool
+		wantHolder    string
+		wantConflicts []string
+	}{
+		{name: "holder says goodbye", holder: "10.0.0.1", from: "10.0.0.1", wantDropped: true},
+		{name: "stranger says goodbye", holder: "10.0.0.1", from: "10.0.0.9", wantHolder: "10.0.0.1:8080"},
+		{name: "no sender", holder: "10.0.0.1", wantHolder: "10.0.0.1:8080"},
+		{
+			name: "holder leaves, rival takes over", holder: "10.0.0.1", rival: "10.0.0.2", from: "10.0.0.1",
+			wantDropped: true, wantHolder: "10.0.0.2:8080",
+		},
+		{
+			name: "rival leaves", holder: "10.0.0.1", rival: "10.0.0.2", from: "10.0.0.2",
+			wantDropped: true, wantHolder: "10.0.0.1:8080",
+		},
+		{
+			name: "stranger cannot remove a rival", holder: "10.0.0.1", rival: "10.0.0.2", from: "10.0.0.9",
+			wantHolder: "10.0.0.1:8080", wantConflicts: []string{"10.0.0.2:8080"},
+		},
+		{name: "link-local holder with zone", holder: "fe80::1%eth0", from: "fe80::1", wantDropped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, sink := testSink(SourceMDNS, Options{})
+			sink.Upsert(endpoint("tools", tt.holder), time.Minute)
+			if tt.rival != "" {
+				if sink.Upsert(endpoint("tools", tt.rival), time.Minute) {
+					t.Fatal("rival took the name from a live holder")
+				}
+			}
+			if got := sink.Withdraw("tools", net.ParseIP(tt.from)); got != tt.wantDropped {
+				t.Errorf("Withdraw = %v, want %v", got, tt.wantDropped)
+			}
+			got, ok := d.ServersSnapshot()["tools"]
+			switch {
+			case tt.wantHolder == "" && ok:
+				t.Errorf("tools still listed at %s", got.Address)
+			case tt.wantHolder != "" && !ok:
+				t.Errorf("tools gone, want it at %s", tt.wantHolder)
+			case ok:
+				if got.Address != tt.wantHolder {
+					t.Errorf("holder = %s, want %s", got.Address, tt.wantHolder)
+				}
+				if !slices.Equal(got.Conflicts, tt.wantConflicts) {
+					t.Errorf("conflicts = %v, want %v", got.Conflicts, tt.wantConflicts)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleAnnouncement(t *testing.T) {
+	p := NewMDNSProvider(MDNSOptions{})
+	d, sink := testSink(SourceMDNS, Options{})
+	sink.Upsert(endpoint("tools", "10.0.0.1"), time.Minute)
+	sink.Upsert(endpoint("search", "10.0.0.2"), time.Minute)
+
+	// A host may not say goodbye for a server on another host.
+	p.handleAnnouncement(sink, packet(t, true, goodbye("tools")), net.ParseIP("10.0.0.9"), mdnsService)
+	if _, ok := d.ServersSnapshot()["tools"]; !ok {
+		t.Fatal("goodbye from another host withdrew tools")
+	}
+
+	p.handleAnnouncement(sink, packet(t, true, goodbye("tools"), announcedText("search", 120, "role=tool", "env=prod"),
+		announcedText("unknown", 120, "env=prod")), net.ParseIP("10.0.0.1"), mdnsService)
+	servers := d.ServersSnapshot()
+	if _, ok := servers["tools"]; ok {
+		t.Error("goodbye from the server's own host ignored")
+	}
+	if got := servers["search"]; got == nil || got.Text["env"] != "prod" || got.Address != "10.0.0.2:8080" {
+		t.Errorf("search = %+v, want the announced text at its old address", got)
+	}
+	if _, ok := servers["unknown"]; ok {
+		t.Error("TXT announcement listed an instance browsing has not resolved")
+	}
+}
@@ -0,0 +1,183 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SourceSnapshot is the Source of servers restored from Options.SnapshotFile. They are
+// unverified: no provider has reported them since the restart.
+const SourceSnapshot = "snapshot"
+
+const (
+	defaultSnapshotInterval = time.Minute
+	defaultSnapshotTTL      = 2 * time.Minute
+	// snapshotMaxAge drops saved servers last seen this long ago, so that ones never
+	// confirmed again do not survive restart after restart.
+	snapshotMaxAge  = 24 * time.Hour
+	snapshotVersion = 1
+)
+
+// SnapshotExtension persists state that belongs with the server set across restarts,
+// such as cached tool lists. See Discovery.Persist.
+type SnapshotExtension interface {
+	// SaveSnapshot returns the state to save; it is called with every save.
+	SaveSnapshot() (json.RawMessage, error)
+	// RestoreSnapshot receives the state saved by the previous run.
+	RestoreSnapshot(data json.RawMessage) error
+}
+
+// snapshotFile is the layout of Options.SnapshotFile.
+type snapshotFile struct {
+	Version    int                        `json:"version"`
+	SavedAt    time.Time                  `json:"saved_at"`
+	Servers    []*ServerInfo              `json:"servers"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+}
+
+// Unverified reports whether info was restored from a snapshot and has not been
+// reported by a provider since.
+func (info *ServerInfo) Unverified() bool { return info.Source == SourceSnapshot }
+
+// Persist saves ext's state with the snapshot under name. If the snapshot restored by
+// Start holds state for name, ext receives it at once. Without Options.SnapshotFile it
+// does nothing.
+func (d *Discovery) Persist(name string, ext SnapshotExtension) {
+	if d.opts.SnapshotFile == "" {
+		return
+	}
+	d.persistMu.Lock()
+	defer d.persistMu.Unlock()
+	d.extensions[name] = ext
+	if data, ok := d.restored[name]; ok {
+		delete(d.restored, name)
+		if err := ext.RestoreSnapshot(data); err != nil {
+			d.logger.Warn("discovery snapshot: restore failed", "extension", name, "error", err)
+		}
+	}
+}
+
+// restoreSnapshot lists the servers saved in Options.SnapshotFile under the snapshot
+// source, each for SnapshotTTL unless a provider reports it first, and keeps the
+// extensions' state for Persist. With a Verifier, the saved signatures are checked
+// afresh, as the file may have been edited; static, file and DNS-SD servers are exempt
+// as usual. A missing file is not an error.
+func (d *Discovery) restoreSnapshot() error {
+	data, err := os.ReadFile(d.opts.SnapshotFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var file snapshotFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse %s: %w", d.opts.SnapshotFile, err)
+	}
+	if file.Version != snapshotVersion {
+		return fmt.Errorf("%s: unsupported version %d", d.opts.SnapshotFile, file.Version)
+	}
+
+	d.persistMu.Lock()
+	d.restored = file.Extensions
+	d.persistMu.Unlock()
+
+	now := time.Now()
+	restored := 0
+	d.update(d.snapshotIndex, func(records map[string]*record) []string {
+		var touched []string
+		for _, saved := range file.Servers {
+			if saved == nil || saved.Instance == "" || now.Sub(saved.LastSeen) > snapshotMaxAge {
+				continue
+			}
+			info := cloneServerInfo(saved)
+			info.Source = SourceSnapshot
+			info.Health = HealthUnknown
+			info.Conflicts = nil
+			info.Signature = ""
+			if v := d.opts.Verifier; v != nil && verifiesSource(saved.Source) {
+				info.Signature = v.check(info, SourceSnapshot)
+			}
+			records[info.Instance] = &record{info: info, expires: now.Add(d.opts.SnapshotTTL)}
+			touched = append(touched, info.Instance)
+		}
+		restored = len(touched)
+		return touched
+	})
+	d.logger.Info("discovery snapshot restored", "file", d.opts.SnapshotFile, "servers", restored,
+		"saved_at", file.SavedAt.Format(time.RFC3339))
+	return nil
+}
+
+// saveSnapshot writes the server set and the extensions' state to Options.SnapshotFile,
+// replacing it atomically. Static servers and ones that failed signature verification are
+// left out.
+func (d *Discovery) saveSnapshot() error {
+	file := snapshotFile{Version: snapshotVersion, SavedAt: time.Now(), Servers: []*ServerInfo{}}
+	for _, info := range d.ServersSnapshot() {
+		if info.Source == SourceStatic || (info.Signature != "" && info.Signature != SignatureValid) {
+			continue
+		}
+		file.Servers = append(file.Servers, info)
+	}
+	sort.Slice(file.Servers, func(i, j int) bool { return file.Servers[i].Instance < file.Servers[j].Instance })
+
+	d.persistMu.Lock()
+	if len(d.extensions) > 0 || len(d.restored) > 0 {
+		file.Extensions = make(map[string]json.RawMessage, len(d.extensions)+len(d.restored))
+	}
+	// State no extension has claimed yet is carried over for the next run.
+	for name, data := range d.restored {
+		file.Extensions[name] = data
+	}
+	for name, ext := range d.extensions {
+		data, err := ext.SaveSnapshot()
+		if err != nil {
+			d.logger.Warn("discovery snapshot: save failed", "extension", name, "error", err)
+			continue
+		}
+		file.Extensions[name] = data
+	}
+	d.persistMu.Unlock()
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(d.opts.SnapshotFile), filepath.Base(d.opts.SnapshotFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.opts.SnapshotFile)
+}
+
+// snapshotLoop saves the snapshot every SnapshotInterval until ctx ends.
+func (d *Discovery) snapshotLoop(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.saveSnapshot(); err != nil {
+				d.logger.Warn("discovery snapshot: save failed", "file", d.opts.SnapshotFile, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package discovery
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryExtension keeps snapshot state in memory.
+type memoryExtension struct {
+	data     json.RawMessage
+	restored json.RawMessage
+}
+
+func (e *memoryExtension) SaveSnapshot() (json.RawMessage, error) { return e.data, nil }
+
+func (e *memoryExtension) RestoreSnapshot(data json.RawMessage) error {
+	e.restored = data
+	return nil
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	secret := []byte("shared secret")
+	verifier, err := NewVerifier(VerifierOptions{Secret: secret, Policy: SignatureQuarantine})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	signer := NewHMACSigner(secret)
+	signed := func(instance, ip string) *ServerInfo {
+		info := endpoint(instance, ip)
+		info.Text = signer.Sign(instance, info.Port, map[string]string{"role": "tool"})
+		return info
+	}
+
+	before, sink := testSink(SourceMDNS, Options{SnapshotFile: file, Verifier: verifier})
+	sink.Upsert(signed("tools", "10.0.0.1"), time.Minute)
+	sink.Upsert(signed("search", "10.0.0.2"), time.Minute)
+	sink.Upsert(endpoint("rogue", "10.0.0.3"), time.Minute)
+	if err := before.AddStatic(endpoint("billing", "10.0.0.4")); err != nil {
+		t.Fatalf("AddStatic: %v", err)
+	}
+	before.Persist("tools", &memoryExtension{data: json.RawMessage(`{"weather":["forecast"]}`)})
+	if err := before.saveSnapshot(); err != nil {
+		t.Fatalf("saveSnapshot: %v", err)
+	}
+
+	after, _ := testSink(SourceMDNS, Options{SnapshotFile: file, Verifier: verifier})
+	if err := after.restoreSnapshot(); err != nil {
+		t.Fatalf("restoreSnapshot: %v", err)
+	}
+	servers := after.ServersSnapshot()
+	if len(servers) != 2 || servers["tools"] == nil || servers["search"] == nil {
+		t.Fatalf("restored %v, want tools and search only", serverNames(servers))
+	}
+	for name, info := range servers {
+		if !info.Unverified() || info.Health != HealthUnknown || info.Signature != SignatureValid {
+			t.Errorf("%s: source %s, health %s, signature %s; want snapshot, unknown, valid",
+				name, info.Source, info.Health, info.Signature)
+		}
+	}
+	if got := servers["tools"].Address; got != "10.0.0.1:8080" {
+		t.Errorf("tools address = %s, want 10.0.0.1:8080", got)
+	}
+
+	// State no extension has claimed is carried over to the next run.
+	if err := after.saveSnapshot(); err != nil {
+		t.Fatalf("saveSnapshot after restore: %v", err)
+	}
+	third, _ := testSink(SourceMDNS, Options{SnapshotFile: file})
+	if err := third.restoreSnapshot(); err != nil {
+		t.Fatalf("restoreSnapshot: %v", err)
+	}
+	ext := &memoryExtension{}
+	third.Persist("tools", ext)
+	if string(ext.restored) != `{"weather":["forecast"]}` {
+		t.Errorf("extension restored %s", ext.restored)
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	now := time.Now()
+	fresh := endpoint("tools", "10.0.0.1")
+	fresh.LastSeen = now.Add(-time.Hour)
+	stale := endpoint("search", "10.0.0.2")
+	stale.LastSeen = now.Add(-snapshotMaxAge - time.Minute)
+
+	tests := []struct {
+		name string
+		// file is the snapshot's content; nil leaves the file missing.
+		file        *snapshotFile
+		wantServers []string
+		wantErr     string
+	}{
+		{name: "missing file"},
+		{
+			name:        "stale servers dropped",
+			file:        &snapshotFile{Version: snapshotVersion, Servers: []*ServerInfo{fresh, stale, nil}},
+			wantServers: []string{"tools"},
+		},
+		{
+			name:    "unsupported version",
+			file:    &snapshotFile{Version: snapshotVersion + 1, Servers: []*ServerInfo{fresh}},
+			wantErr: "unsupported version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshot.json")
+			if tt.file != nil {
+				data, err := json.Marshal(tt.file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			d, _ := testSink(SourceMDNS, Options{SnapshotFile: path})
+			err := d.restoreSnapshot()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("restoreSnapshot error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("restoreSnapshot: %v", err)
+			}
+			if got := serverNames(d.ServersSnapshot()); strings.Join(got, ",") != strings.Join(tt.wantServers, ",") {
+				t.Errorf("restored %v, want %v", got, tt.wantServers)
+			}
+		})
+	}
+}
+
+func serverNames(servers map[string]*ServerInfo) []string {
+	var names []string
+	for name := range servers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
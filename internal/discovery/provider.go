@@ -0,0 +1,220 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"slices"
+	"time"
+)
+
+// Provider is a source of servers for Discovery: mDNS browsing, a file of static
+// entries, and so on. Discovery merges what its providers report into one snapshot.
+type Provider interface {
+	// Name is recorded as the Source of the provider's servers.
+	Name() string
+	// Start begins reporting servers to sink and returns once the provider is running.
+	// Background work must stop when ctx ends and should be launched with sink.Go so
+	// that Discovery.Stop waits for it.
+	Start(ctx context.Context, sink *Sink) error
+}
+
+// Sink receives one provider's servers. It is safe for concurrent use.
+type Sink struct {
+	d     *Discovery
+	index int
+}
+
+// Upsert adds or refreshes a server. With a positive ttl the server is dropped unless
+// refreshed within ttl; zero keeps it until Remove or Replace. Refreshing an unchanged
+// server produces no event.
+//
+// While a server added with a ttl is live, another endpoint (see sameEndpoint) upserting
+// the same instance name is turned down: it is listed in the holder's Conflicts, the
+// first claim emits EventConflict, and it takes over only if the holder lapses. Upsert
+// reports false when info was turned down this way.
+func (s *Sink) Upsert(info *ServerInfo, ttl time.Duration) bool {
+	if info == nil || info.Instance == "" {
+		return false
+	}
+	now := time.Now()
+	rec := s.record(info, ttl, now)
+	name := rec.info.Instance
+	accepted, conflict := true, false
+	s.d.update(s.index, func(records map[string]*record) []string {
+		prev, ok := records[name]
+		if ok && prev.live(now) && !sameEndpoint(prev.info, rec.info) {
+			accepted = false
+			if !prev.addRival(rec.info, ttl, now) {
+				return nil
+			}
+			conflict = true
+			return []string{name}
+		}
+		if ok {
+			rec.inheritRivals(prev, now)
+		}
+		records[name] = rec
+		if ok && sameServer(prev.info, rec.info) {
+			return nil
+		}
+		return []string{name}
+	})
+	if conflict {
+		s.d.reportConflict(s.index, name, rec.info)
+	}
+	return accepted
+}
+
+// Remove withdraws a server the provider reported earlier.
+func (s *Sink) Remove(instance string) {
+	s.d.update(s.index, func(records map[string]*record) []string {
+		if _, ok := records[instance]; !ok {
+			return nil
+		}
+		delete(records, instance)
+		return []string{instance}
+	})
+}
+
+// Withdraw handles a goodbye for instance sent from the address from, dropping only the
+// endpoint at that address: the holder, whose name passes to a live rival if there is
+// one, or a rival. A goodbye from any other address is ignored, so that one host cannot
+// withdraw another's server. It reports whether anything was dropped.
+func (s *Sink) Withdraw(instance string, from net.IP) bool {
+	now := time.Now()
+	dropped := false
+	s.d.update(s.index, func(records map[string]*record) []string {
+		rec, ok := records[instance]
+		if !ok {
+			return nil
+		}
+		if atHost(rec.info, from) {
+			dropped = true
+			if succ := rec.successor(now); succ != nil {
+				records[instance] = succ
+			} else {
+				delete(records, instance)
+			}
+			return []string{instance}
+		}
+		for addr, r := range rec.rivals {
+			if atHost(r.info, from) {
+				delete(rec.rivals, addr)
+				dropped = true
+			}
+		}
+		if !dropped {
+			return nil
+		}
+		rec.syncConflicts()
+		return []string{instance}
+	})
+	return dropped
+}
+
+// Replace sets the provider's complete server list: servers missing from infos are
+// removed and the rest are upserted with ttl. Only servers that were added, removed or
+// changed produce events.
+func (s *Sink) Replace(infos []*ServerInfo, ttl time.Duration) {
+	now := time.Now()
+	next := make(map[string]*record, len(infos))
+	for _, info := range infos {
+		if info == nil || info.Instance == "" {
+			continue
+		}
+		next[info.Instance] = s.record(info, ttl, now)
+	}
+	s.d.update(s.index, func(records map[string]*record) []string {
+		var touched []string
+		for name := range records {
+			if _, ok := next[name]; !ok {
+				delete(records, name)
+				touched = append(touched, name)
+			}
+		}
+		for name, rec := range next {
+			prev, ok := records[name]
+			records[name] = rec
+			if !ok || !sameServer(prev.info, rec.info) {
+				touched = append(touched, name)
+			}
+		}
+		return touched
+	})
+}
+
+// UpdateText replaces the TXT record of a server the provider reported earlier, keeping
+// its addresses, and refreshes it with ttl as Upsert does. The kind is derived afresh from
+// text. It reports false, changing nothing, when the provider does not list instance. It
+// changes nothing either while other servers claim the name, since the text could be
+// theirs.
+func (s *Sink) UpdateText(instance string, text map[string]string, ttl time.Duration) bool {
+	s.d.mu.Lock()
+	prev, ok := s.d.sources[s.index].records[instance]
+	contested := ok && len(prev.rivals) > 0
+	s.d.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if contested {
+		// The text may be the rival's; wait for a sighting that carries the address.
+		return true
+	}
+	info := cloneServerInfo(prev.info)
+	info.Text = text
+	info.Kind = ""
+	s.Upsert(info, ttl)
+	return true
+}
+
+// Has reports whether the provider currently lists instance.
+func (s *Sink) Has(instance string) bool {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	_, ok := s.d.sources[s.index].records[instance]
+	return ok
+}
+
+// Go runs fn in the background; Discovery.Stop waits for it to return.
+func (s *Sink) Go(fn func()) {
+	s.d.wg.Add(1)
+	go func() {
+		defer s.d.wg.Done()
+		fn()
+	}()
+}
+
+func (s *Sink) record(info *ServerInfo, ttl time.Duration, now time.Time) *record {
+	srv := cloneServerInfo(info)
+	srv.Source = s.d.sources[s.index].name
+	if srv.Kind == "" {
+		srv.Kind = classifyKind(srv.Text)
+	}
+	srv.LastSeen = now
+	srv.Conflicts = nil
+	srv.Signature = ""
+	if v := s.d.opts.Verifier; v != nil && verifiesSource(srv.Source) {
+		srv.Signature = v.check(srv, srv.Source)
+	}
+	rec := &record{info: srv}
+	if ttl > 0 {
+		rec.expires = now.Add(ttl)
+	}
+	return rec
+}
+
+// sameServer reports whether a and b describe the same endpoint and metadata.
+func sameServer(a, b *ServerInfo) bool {
+	if a.Instance != b.Instance || a.Host != b.Host || a.Port != b.Port ||
+		a.Address != b.Address || a.Kind != b.Kind || len(a.Text) != len(b.Text) ||
+		!slices.Equal(a.Addresses, b.Addresses) || a.Signature != b.Signature ||
+		!slices.Equal(a.Conflicts, b.Conflicts) {
+		return false
+	}
+	for k, v := range a.Text {
+		if bv, ok := b.Text[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,356 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/charmbracelet/log"
+)
+
+// SourceRegistry is the Source of servers that registered over HTTP.
+const SourceRegistry = "registry"
+
+// RegistryPath is where a Registry accepts registrations, relative to its base URL.
+const RegistryPath = "/registry/servers"
+
+// Registration is what a server POSTs to a registry, and re-POSTs as its heartbeat.
+type Registration struct {
+	Instance string `json:"instance"`
+	// Address is the host:port to dial. When empty the registry uses Host, or else the
+	// request's source address, with Port.
+	Address string            `json:"address,omitempty"`
+	Host    string            `json:"host,omitempty"`
+	Port    int               `json:"port"`
+	Text    map[string]string `json:"text,omitempty"`
+}
+
+// RegistrationResponse tells the server how long its registration lasts; it should
+// heartbeat well within that.
+type RegistrationResponse struct {
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// RegistryOptions configure a Registry.
+type RegistryOptions struct {
+	// Token, when set, must be sent as a bearer token by registering servers.
+	Token string
+	// EntryTTL is how long a registration lasts without a heartbeat. Defaults to 45s,
+	// the same as an mDNS sighting.
+	EntryTTL time.Duration
+	// Logger receives registrations and withdrawals. Defaults to discarding.
+	Logger *log.Logger
+}
+
+// Registry is a Provider fed by servers registering over HTTP, for networks where
+// multicast does not reach. Mount it at RegistryPath.
+type Registry struct {
+	opts   RegistryOptions
+	token  [sha256.Size]byte
+	logger *log.Logger
+	mux    *http.ServeMux
+
+	mu   sync.RWMutex
+	sink *Sink
+}
+
+// NewRegistry returns a registry; it accepts registrations once its Discovery starts.
+func NewRegistry(opts RegistryOptions) *Registry {
+	if opts.EntryTTL <= 0 {
+		opts.EntryTTL = defaultEntryTTL
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
+	r := &Registry{
+		opts:   opts,
+		token:  sha256.Sum256([]byte(opts.Token)),
+		logger: logger,
+		mux:    http.NewServeMux(),
+	}
+	r.mux.HandleFunc("POST "+RegistryPath, r.handleRegister)
+	r.mux.HandleFunc("DELETE "+RegistryPath+"/{instance}", r.handleDeregister)
+	return r
+}
+
+// Name implements Provider.
+func (r *Registry) Name() string { return SourceRegistry }
+
+// Start implements Provider.
+func (r *Registry) Start(ctx context.Context, sink *Sink) error {
+	r.mu.Lock()
+	r.sink = sink
+	r.mu.Unlock()
+	return nil
+}
+
+// ServeHTTP checks the registry token and dispatches.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.opts.Token != "" {
+		token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+		if subtle.ConstantTimeCompare(sum[:], r.token[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-agent-registry"`)
+			http.Error(w, "invalid or missing registry token", http.StatusUnauthorized)
+			return
+		}
+	}
+	r.mux.ServeHTTP(w, req)
+}
+
+func (r *Registry) currentSink() *Sink {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sink
+}
+
+func (r *Registry) handleRegister(w http.ResponseWriter, req *http.Request) {
+	sink := r.currentSink()
+	if sink == nil {
+		http.Error(w, "registry not started", http.StatusServiceUnavailable)
+		return
+	}
+	var reg Registration
+	if err := json.NewDecoder(req.Body).Decode(&reg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	info := &ServerInfo{
+		Instance: strings.TrimSpace(reg.Instance),
+		Address:  strings.TrimSpace(reg.Address),
+		Host:     strings.TrimSpace(reg.Host),
+		Port:     reg.Port,
+		Text:     reg.Text,
+	}
+	if info.Address == "" && info.Host == "" {
+		if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+			info.Host = host
+		}
+	}
+	srv, err := normalizeStatic(info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !sink.Has(srv.Instance) {
+		r.logger.Info("server registered", "instance", srv.Instance, "address", srv.Address)
+	}
+	if !sink.Upsert(srv, r.opts.EntryTTL) {
+		http.Error(w, fmt.Sprintf("instance name %q is held by another server", srv.Instance), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(RegistrationResponse{TTLSeconds: int(r.opts.EntryTTL / time.Second)})
+}
+
+func (r *Registry) handleDeregister(w http.ResponseWriter, req *http.Request) {
+	sink := r.currentSink()
+	if sink == nil {
+		http.Error(w, "registry not started", http.StatusServiceUnavailable)
+		return
+	}
+	instance := req.PathValue("instance")
+	if sink.Has(instance) {
+		r.logger.Info("server deregistered", "instance", instance)
+	}
+	sink.Remove(instance)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// registrar keeps one server registered with a set of registries.
+type registrar struct {
+	urls   []string
+	token  string
+	client *http.Client
+	logger *log.Logger
+
+	mu  sync.Mutex
+	reg Registration
+	// taken marks the registries that turned the instance name down because another
+	// server holds it; they are not sent a deregistration.
+	taken map[string]bool
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+const (
+	defaultHeartbeat = 15 * time.Second
+	registryTimeout  = 5 * time.Second
+)
+
+// errNameTaken is returned by a registry that has the instance name registered to
+// another server.
+var errNameTaken = errors.New("instance name held by another server")
+
+func startRegistrar(opts AnnounceOptions) *registrar {
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
+	urls := make([]string, 0, len(opts.Registries))
+	for _, u := range opts.Registries {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			urls = append(urls, u+RegistryPath)
+		}
+	}
+	reg := Registration{Instance: opts.Instance, Port: opts.Port, Text: cloneText(opts.Text)}
+	if _, _, err := net.SplitHostPort(opts.Address); err == nil {
+		reg.Address = opts.Address
+	} else {
+		reg.Host = opts.Address
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &registrar{
+		urls:   urls,
+		token:  opts.RegistryToken,
+		client: &http.Client{Timeout: registryTimeout},
+		logger: logger,
+		reg:    reg,
+		taken:  make(map[string]bool),
+		wake:   make(chan struct{}, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go r.loop(ctx)
+	return r
+}
+
+// loop registers immediately, then heartbeats at a third of the shortest TTL the
+// registries grant, and re-registers at once when the text changes.
+func (r *registrar) loop(ctx context.Context) {
+	defer close(r.done)
+	for {
+		interval := r.registerAll(ctx)
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-r.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *registrar) registerAll(ctx context.Context) time.Duration {
+	r.mu.Lock()
+	body, _ := json.Marshal(r.reg)
+	r.mu.Unlock()
+
+	interval := defaultHeartbeat
+	for _, u := range r.urls {
+		ttl, err := r.register(ctx, u, body)
+		r.mu.Lock()
+		wasTaken := r.taken[u]
+		r.taken[u] = errors.Is(err, errNameTaken)
+		r.mu.Unlock()
+		if errors.Is(err, errNameTaken) {
+			if !wasTaken {
+				r.logger.Warn("instance name held by another server at registry; set a unique --instance",
+					"registry", u, "instance", r.reg.Instance)
+			}
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Warn("registry heartbeat failed", "registry", u, "error", err)
+			}
+			continue
+		}
+		if beat := ttl / 3; beat > 0 && beat < interval {
+			interval = beat
+		}
+	}
+	return interval
+}
+
+func (r *registrar) register(ctx context.Context, target string, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	r.authorize(req)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return 0, errNameTaken
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("registry returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var out RegistrationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, fmt.Errorf("decode registry response: %w", err)
+	}
+	return time.Duration(out.TTLSeconds) * time.Second, nil
+}
+
+func (r *registrar) authorize(req *http.Request) {
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+}
+
+func (r *registrar) setText(text map[string]string) {
+	r.mu.Lock()
+	r.reg.Text = cloneText(text)
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop ends the heartbeats and deregisters, so registries drop the server at once
+// instead of after its TTL.
+func (r *registrar) stop() {
+	r.cancel()
+	<-r.done
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	for _, u := range r.urls {
+		if r.taken[u] {
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u+"/"+url.PathEscape(r.reg.Instance), nil)
+		if err != nil {
+			continue
+		}
+		r.authorize(req)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			r.logger.Warn("registry deregistration failed", "registry", u, "error", err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+func cloneText(text map[string]string) map[string]string {
+	out := make(map[string]string, len(text))
+	for k, v := range text {
+		out[k] = v
+	}
+	return out
+}
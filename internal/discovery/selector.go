@@ -0,0 +1,185 @@
+package discovery
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SelectorKindKey is the selector key that matches a server's Kind rather than a TXT key.
+const SelectorKindKey = "kind"
+
+// Selector picks servers by their TXT labels, in the syntax of Kubernetes label
+// selectors. Requirements are separated by commas and must all hold:
+//
+//	env=prod            label equals a value (== is accepted too)
+//	env!=dev            label is absent or differs
+//	env in (prod,stg)   label is one of the values
+//	env notin (dev)     label is absent or none of the values
+//	team                label is present
+//	!team               label is absent
+//
+// The key "kind" matches the server kind (tool, agent-wrapper, ...). The zero Selector
+// matches every server.
+type Selector struct {
+	expr string
+	reqs []requirement
+}
+
+type selectorOp int
+
+const (
+	opEquals selectorOp = iota
+	opNotEquals
+	opIn
+	opNotIn
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key    string
+	op     selectorOp
+	values []string
+}
+
+var (
+	selectorKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_./-]*$`)
+	selectorSet = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+)
+
+// ParseSelector parses a selector expression. An empty expression matches everything.
+func ParseSelector(expr string) (Selector, error) {
+	sel := Selector{expr: strings.TrimSpace(expr)}
+	if sel.expr == "" {
+		return sel, nil
+	}
+	parts, err := splitRequirements(sel.expr)
+	if err != nil {
+		return Selector{}, err
+	}
+	for _, part := range parts {
+		req, err := parseRequirement(part)
+		if err != nil {
+			return Selector{}, fmt.Errorf("selector %q: %w", sel.expr, err)
+		}
+		sel.reqs = append(sel.reqs, req)
+	}
+	return sel, nil
+}
+
+// MustParseSelector is ParseSelector for constant expressions; it panics on error.
+func MustParseSelector(expr string) Selector {
+	sel, err := ParseSelector(expr)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// Empty reports whether the selector matches every server.
+func (s Selector) Empty() bool { return len(s.reqs) == 0 }
+
+// String returns the expression the selector was parsed from.
+func (s Selector) String() string { return s.expr }
+
+// Matches reports whether info satisfies every requirement.
+func (s Selector) Matches(info *ServerInfo) bool {
+	if info == nil {
+		return false
+	}
+	for _, req := range s.reqs {
+		if !req.matches(info) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r requirement) matches(info *ServerInfo) bool {
+	value, ok := info.Text[r.key]
+	if r.key == SelectorKindKey {
+		value, ok = info.Kind, info.Kind != ""
+	}
+	switch r.op {
+	case opEquals:
+		return ok && value == r.values[0]
+	case opNotEquals:
+		return !ok || value != r.values[0]
+	case opIn:
+		return ok && slices.Contains(r.values, value)
+	case opNotIn:
+		return !ok || !slices.Contains(r.values, value)
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	}
+	return false
+}
+
+// splitRequirements splits expr on the commas that are not inside a value set.
+func splitRequirements(expr string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("selector %q: unbalanced parentheses", expr)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("selector %q: unbalanced parentheses", expr)
+	}
+	return append(parts, expr[start:]), nil
+}
+
+func parseRequirement(text string) (requirement, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return requirement{}, fmt.Errorf("empty requirement")
+	}
+	var req requirement
+	switch {
+	case selectorSet.MatchString(text):
+		m := selectorSet.FindStringSubmatch(text)
+		req.key, req.op = m[1], opIn
+		if m[2] == "notin" {
+			req.op = opNotIn
+		}
+		for _, v := range strings.Split(m[3], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				req.values = append(req.values, v)
+			}
+		}
+		if len(req.values) == 0 {
+			return requirement{}, fmt.Errorf("%q: empty value set", text)
+		}
+	case strings.HasPrefix(text, "!") && !strings.Contains(text, "="):
+		req.key, req.op = strings.TrimSpace(text[1:]), opNotExists
+	case strings.Contains(text, "!="):
+		key, value, _ := strings.Cut(text, "!=")
+		req.key, req.op, req.values = strings.TrimSpace(key), opNotEquals, []string{strings.TrimSpace(value)}
+	case strings.Contains(text, "="):
+		key, value, _ := strings.Cut(text, "=")
+		value = strings.TrimPrefix(value, "=")
+		req.key, req.op, req.values = strings.TrimSpace(key), opEquals, []string{strings.TrimSpace(value)}
+	default:
+		req.key, req.op = text, opExists
+	}
+	if !selectorKey.MatchString(req.key) {
+		return requirement{}, fmt.Errorf("%q: invalid key %q", text, req.key)
+	}
+	return req, nil
+}
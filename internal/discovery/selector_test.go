@@ -0,0 +1,82 @@
+package discovery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: ""},
+		{expr: "  "},
+		{expr: "env=prod"},
+		{expr: "env==prod"},
+		{expr: "env != dev"},
+		{expr: "env in (prod, stg)"},
+		{expr: "env notin (dev)"},
+		{expr: "team"},
+		{expr: "!team"},
+		{expr: "kind=tool,env in (prod,stg),!deprecated"},
+		{expr: "app.example.com/tier=gold"},
+		{expr: "env=prod,", wantErr: true},
+		{expr: ",env=prod", wantErr: true},
+		{expr: "env in (prod", wantErr: true},
+		{expr: "env in prod)", wantErr: true},
+		{expr: "env in ()", wantErr: true},
+		{expr: "env in ( , )", wantErr: true},
+		{expr: "=prod", wantErr: true},
+		{expr: "!", wantErr: true},
+		{expr: "-env=prod", wantErr: true},
+		{expr: "env name=prod", wantErr: true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSelector(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if err == nil && sel.String() != strings.TrimSpace(tt.expr) {
+			t.Errorf("ParseSelector(%q).String() = %q", tt.expr, sel.String())
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	prod := &ServerInfo{Kind: "tool", Text: map[string]string{"env": "prod", "team": "search"}}
+	staging := &ServerInfo{Kind: "agent-wrapper", Text: map[string]string{"env": "stg"}}
+	bare := &ServerInfo{Text: map[string]string{}}
+
+	tests := []struct {
+		expr string
+		// want lists whether prod, staging and bare match.
+		want [3]bool
+	}{
+		{expr: "", want: [3]bool{true, true, true}},
+		{expr: "env=prod", want: [3]bool{true, false, false}},
+		{expr: "env==stg", want: [3]bool{false, true, false}},
+		{expr: "env!=prod", want: [3]bool{false, true, true}},
+		{expr: "env in (prod,stg)", want: [3]bool{true, true, false}},
+		{expr: "env notin (prod)", want: [3]bool{false, true, true}},
+		{expr: "team", want: [3]bool{true, false, false}},
+		{expr: "!team", want: [3]bool{false, true, true}},
+		{expr: "kind=tool", want: [3]bool{true, false, false}},
+		{expr: "kind", want: [3]bool{true, true, false}},
+		{expr: "!kind", want: [3]bool{false, false, true}},
+		{expr: "kind in (tool, agent-wrapper), env!=stg", want: [3]bool{true, false, false}},
+		{expr: "env=prod,!team", want: [3]bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		sel := MustParseSelector(tt.expr)
+		for i, info := range []*ServerInfo{prod, staging, bare} {
+			if got := sel.Matches(info); got != tt.want[i] {
+				t.Errorf("%q matches %v = %v, want %v", tt.expr, info.Text, got, tt.want[i])
+			}
+		}
+		if sel.Matches(nil) {
+			t.Errorf("%q matches nil", tt.expr)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package discovery
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/charmbracelet/log"
+)
+
+// TXT keys carrying an announcement signature.
+const (
+	TextSignature          = "sig"
+	TextSignatureAlgorithm = "sig_alg"
+	TextSignatureTime      = "sig_ts"
+)
+
+// Signature algorithms, as advertised under TextSignatureAlgorithm.
+const (
+	SignatureHMACSHA256 = "hmac-sha256"
+	SignatureEd25519    = "ed25519"
+)
+
+const (
+	// defaultSignInterval is how often an Announcer re-signs its TXT record, so that
+	// the timestamp stays well within a verifier's MaxAge.
+	defaultSignInterval    = 2 * time.Minute
+	defaultSignatureMaxAge = 10 * time.Minute
+	// maxLoggedFailures bounds the failures a Verifier remembers.
+	maxLoggedFailures = 1024
+)
+
+// SignatureStatus is the outcome of verifying a server's announcement. It is empty when
+// the server was not verified, because no Verifier is configured or its source is trusted.
+type SignatureStatus string
+
+const (
+	SignatureValid    SignatureStatus = "valid"
+	SignatureUnsigned SignatureStatus = "unsigned"
+	SignatureInvalid  SignatureStatus = "invalid"
+)
+
+// SignaturePolicy decides what happens to servers whose announcement is unsigned or fails
+// verification.
+type SignaturePolicy string
+
+const (
+	// SignatureOff skips verification.
+	SignatureOff SignaturePolicy = "off"
+	// SignatureQuarantine keeps such servers visible, e.g. to the admin API, but the
+	// mediator never lists or calls them.
+	SignatureQuarantine SignaturePolicy = "quarantine"
+	// SignatureReject leaves them out of discovery entirely.
+	SignatureReject SignaturePolicy = "reject"
+)
+
+// ParseSignaturePolicy validates a policy name; empty selects SignatureOff.
+func ParseSignaturePolicy(value string) (SignaturePolicy, error) {
+	switch policy := SignaturePolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return SignatureOff, nil
+	case SignatureOff, SignatureQuarantine, SignatureReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid signature policy %q (want off, quarantine or reject)", value)
+	}
+}
+
+// Signer signs announcements with a shared HMAC secret or an Ed25519 private key.
+type Signer struct {
+	algorithm string
+	secret    []byte
+	key       ed25519.PrivateKey
+}
+
+// NewHMACSigner signs with HMAC-SHA256 under a secret shared by the whole mesh.
+func NewHMACSigner(secret []byte) *Signer {
+	return &Signer{algorithm: SignatureHMACSHA256, secret: secret}
+}
+
+// NewEd25519Signer signs with key; verifiers need the matching public key.
+func NewEd25519Signer(key ed25519.PrivateKey) *Signer {
+	return &Signer{algorithm: SignatureEd25519, key: key}
+}
+
+// LoadSigner returns an Ed25519 signer for the PEM key in keyFile, else an HMAC signer
+// for secret, else nil when both are empty.
+func LoadSigner(keyFile, secret string) (*Signer, error) {
+	if keyFile != "" {
+		key, err := LoadEd25519PrivateKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewEd25519Signer(key), nil
+	}
+	if secret != "" {
+		return NewHMACSigner([]byte(secret)), nil
+	}
+	return nil, nil
+}
+
+// Sign returns a copy of text carrying a signature, made now, over instance, port and
+// every other TXT key.
+func (s *Signer) Sign(instance string, port int, text map[string]string) map[string]string {
+	signed := make(map[string]string, len(text)+3)
+	for k, v := range text {
+		signed[k] = v
+	}
+	delete(signed, TextSignature)
+	signed[TextSignatureAlgorithm] = s.algorithm
+	signed[TextSignatureTime] = strconv.FormatInt(time.Now().Unix(), 10)
+	payload := signaturePayload(instance, port, signed)
+	var sig []byte
+	switch s.algorithm {
+	case SignatureEd25519:
+		sig = ed25519.Sign(s.key, payload)
+	default:
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(payload)
+		sig = mac.Sum(nil)
+	}
+	signed[TextSignature] = base64.RawURLEncoding.EncodeToString(sig)
+	return signed
+}
+
+// VerifierOptions configure a Verifier. At least one of Secret and PublicKeys is needed.
+type VerifierOptions struct {
+	// Secret verifies hmac-sha256 signatures.
+	Secret []byte
+	// PublicKeys verify ed25519 signatures; any one of them may have signed.
+	PublicKeys []ed25519.PublicKey
+	// MaxAge bounds how old (or how far in the future) a signature's timestamp may be.
+	// Announcers re-sign every two minutes. Defaults to 10m.
+	MaxAge time.Duration
+	// Policy applies to unsigned and invalid servers: SignatureQuarantine or
+	// SignatureReject, the default.
+	Policy SignaturePolicy
+	// Logger receives a warning when a server fails verification. Defaults to discarding.
+	Logger *log.Logger
+}
+
+// Verifier checks announcement signatures for Discovery (see Options.Verifier).
+type Verifier struct {
+	opts   VerifierOptions
+	logger *log.Logger
+
+	// failures holds the last failure logged per instance, so each is logged once.
+	mu       sync.Mutex
+	failures map[string]string
+}
+
+// NewVerifier returns a verifier for opts. Policy must be quarantine or reject; to skip
+// verification, configure no verifier.
+func NewVerifier(opts VerifierOptions) (*Verifier, error) {
+	if len(opts.Secret) == 0 && len(opts.PublicKeys) == 0 {
+		return nil, errors.New("signature verification needs a shared secret or public keys")
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = defaultSignatureMaxAge
+	}
+	switch opts.Policy {
+	case "":
+		opts.Policy = SignatureReject
+	case SignatureQuarantine, SignatureReject:
+	default:
+		return nil, fmt.Errorf("verifier policy must be quarantine or reject, not %q", opts.Policy)
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
+	return &Verifier{opts: opts, logger: logger, failures: make(map[string]string)}, nil
+}
+
+// Policy reports what happens to servers that fail verification.
+func (v *Verifier) Policy() SignaturePolicy { return v.opts.Policy }
+
+// Verify checks the signature in info's TXT record, returning why it failed otherwise.
+func (v *Verifier) Verify(info *ServerInfo) (SignatureStatus, error) {
+	sigText, ok := info.Text[TextSignature]
+	if !ok {
+		return SignatureUnsigned, errors.New("no signature")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigText)
+	if err != nil {
+		return SignatureInvalid, fmt.Errorf("malformed signature: %w", err)
+	}
+	ts, err := strconv.ParseInt(info.Text[TextSignatureTime], 10, 64)
+	if err != nil {
+		return SignatureInvalid, errors.New("missing or malformed signature timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > v.opts.MaxAge || age < -v.opts.MaxAge {
+		return SignatureInvalid, fmt.Errorf("signature timestamp is %s off, beyond %s", age.Round(time.Second), v.opts.MaxAge)
+	}
+	payload := signaturePayload(info.Instance, info.Port, info.Text)
+	switch alg := info.Text[TextSignatureAlgorithm]; alg {
+	case SignatureHMACSHA256:
+		if len(v.opts.Secret) == 0 {
+			return SignatureInvalid, errors.New("no shared secret configured for hmac-sha256")
+		}
+		mac := hmac.New(sha256.New, v.opts.Secret)
+		mac.Write(payload)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return SignatureInvalid, errors.New("hmac-sha256 signature mismatch")
+		}
+	case SignatureEd25519:
+		for _, key := range v.opts.PublicKeys {
+			if ed25519.Verify(key, payload, sig) {
+				return SignatureValid, nil
+			}
+		}
+		return SignatureInvalid, errors.New("ed25519 signature matches no trusted key")
+	default:
+		return SignatureInvalid, fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+	return SignatureValid, nil
+}
+
+// check verifies info for source and logs a failure the first time it is seen.
+func (v *Verifier) check(info *ServerInfo, source string) SignatureStatus {
+	status, err := v.Verify(info)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err == nil {
+		delete(v.failures, info.Instance)
+		return status
+	}
+	if v.failures[info.Instance] != err.Error() {
+		if len(v.failures) >= maxLoggedFailures {
+			clear(v.failures)
+		}
+		v.failures[info.Instance] = err.Error()
+		v.logger.Warn("server announcement failed verification",
+			"instance", info.Instance, "source", source, "status", status, "policy", v.opts.Policy, "reason", err)
+	}
+	return status
+}
+
+// verifiesSource reports whether servers from source must be signed. Static servers,
+// discovery files and DNS-SD zones are configured by the operator and are trusted.
+func verifiesSource(source string) bool {
+	switch source {
+	case SourceStatic, SourceFile, SourceDNSSD:
+		return false
+	}
+	return true
+}
+
+// signaturePayload is the byte string that is signed: a version tag, the instance, the
+// port and the sorted TXT pairs other than the signature itself.
+func signaturePayload(instance string, port int, text map[string]string) []byte {
+	lines := []string{"mcp-announce-v1", instance, strconv.Itoa(port)}
+	keys := make([]string, 0, len(text))
+	for k := range text {
+		if k != TextSignature {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lines = append(lines, k+"="+text[k])
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// LoadEd25519PrivateKey reads a PKCS#8 PEM private key, as written by
+// `openssl genpkey -algorithm ed25519`.
+func LoadEd25519PrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s: no PEM block", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s: not an ed25519 key", path)
+	}
+	return key, nil
+}
+
+// LoadEd25519PublicKeys reads every PKIX PEM public key in path, as written by
+// `openssl pkey -pubout`.
+func LoadEd25519PublicKeys(path string) ([]ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read trusted keys: %w", err)
+	}
+	var keys []ed25519.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("trusted keys %s: %w", path, err)
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("trusted keys %s: not an ed25519 key", path)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("trusted keys %s: no PEM public keys", path)
+	}
+	return keys, nil
+}
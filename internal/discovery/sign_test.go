@@ -0,0 +1,195 @@
+package discovery
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("mesh secret")
+
+// signedAt signs text for instance with testSecret as if at the given time.
+func signedAt(instance string, port int, text map[string]string, at time.Time) map[string]string {
+	signed := map[string]string{TextSignatureAlgorithm: SignatureHMACSHA256, TextSignatureTime: strconv.FormatInt(at.Unix(), 10)}
+	for k, v := range text {
+		signed[k] = v
+	}
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write(signaturePayload(instance, port, signed))
+	signed[TextSignature] = base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, untrusted, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(VerifierOptions{Secret: testSecret, PublicKeys: []ed25519.PublicKey{public}, MaxAge: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	text := map[string]string{"role": "tool", "env": "prod"}
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		text map[string]string
+		// port is the port the verifier sees; zero means the signed one.
+		port   int
+		tamper func(text map[string]string)
+		want   SignatureStatus
+	}{
+		{name: "hmac", text: NewHMACSigner(testSecret).Sign("tools", 8080, text), want: SignatureValid},
+		{name: "ed25519", text: NewEd25519Signer(private).Sign("tools", 8080, text), want: SignatureValid},
+		{name: "ed25519 untrusted key", text: NewEd25519Signer(untrusted).Sign("tools", 8080, text), want: SignatureInvalid},
+		{name: "wrong secret", text: NewHMACSigner([]byte("other secret")).Sign("tools", 8080, text), want: SignatureInvalid},
+		{name: "unsigned", text: text, want: SignatureUnsigned},
+		{
+			name: "tampered value", text: NewHMACSigner(testSecret).Sign("tools", 8080, text),
+			tamper: func(text map[string]string) { text["env"] = "dev" }, want: SignatureInvalid,
+		},
+		{
+			name: "added key", text: NewEd25519Signer(private).Sign("tools", 8080, text),
+			tamper: func(text map[string]string) { text["admin"] = "true" }, want: SignatureInvalid,
+		},
+		{
+			name: "removed key", text: NewHMACSigner(testSecret).Sign("tools", 8080, text),
+			tamper: func(text map[string]string) { delete(text, "role") }, want: SignatureInvalid,
+		},
+		{name: "other port", text: NewHMACSigner(testSecret).Sign("tools", 8080, text), port: 9090, want: SignatureInvalid},
+		{
+			name: "malformed signature", text: NewHMACSigner(testSecret).Sign("tools", 8080, text),
+			tamper: func(text map[string]string) { text[TextSignature] = "not base64!" }, want: SignatureInvalid,
+		},
+		{
+			name: "unknown algorithm", text: NewHMACSigner(testSecret).Sign("tools", 8080, text),
+			tamper: func(text map[string]string) { text[TextSignatureAlgorithm] = "md5" }, want: SignatureInvalid,
+		},
+		{
+			name: "no timestamp", text: NewHMACSigner(testSecret).Sign("tools", 8080, text),
+			tamper: func(text map[string]string) { delete(text, TextSignatureTime) }, want: SignatureInvalid,
+		},
+		{name: "within MaxAge", text: signedAt("tools", 8080, text, now.Add(-9*time.Minute)), want: SignatureValid},
+		{name: "older than MaxAge", text: signedAt("tools", 8080, text, now.Add(-11*time.Minute)), want: SignatureInvalid},
+		{name: "beyond MaxAge in the future", text: signedAt("tools", 8080, text, now.Add(11*time.Minute)), want: SignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := endpoint("tools", "10.0.0.1")
+			info.Text = make(map[string]string, len(tt.text))
+			for k, v := range tt.text {
+				info.Text[k] = v
+			}
+			if tt.tamper != nil {
+				tt.tamper(info.Text)
+			}
+			if tt.port != 0 {
+				info.Port = tt.port
+			}
+			got, err := v.Verify(info)
+			if got != tt.want {
+				t.Errorf("Verify = %s (%v), want %s", got, err, tt.want)
+			}
+			if (err == nil) != (tt.want == SignatureValid) {
+				t.Errorf("Verify error = %v with status %s", err, got)
+			}
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       VerifierOptions
+		wantPolicy SignaturePolicy
+		wantErr    bool
+	}{
+		{name: "default policy", opts: VerifierOptions{Secret: testSecret}, wantPolicy: SignatureReject},
+		{name: "quarantine", opts: VerifierOptions{Secret: testSecret, Policy: SignatureQuarantine}, wantPolicy: SignatureQuarantine},
+		{name: "off", opts: VerifierOptions{Secret: testSecret, Policy: SignatureOff}, wantErr: true},
+		{name: "unknown policy", opts: VerifierOptions{Secret: testSecret, Policy: "audit"}, wantErr: true},
+		{name: "no secret or keys", opts: VerifierOptions{Policy: SignatureReject}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewVerifier(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewVerifier succeeded with policy %s", v.Policy())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewVerifier: %v", err)
+			}
+			if v.Policy() != tt.wantPolicy {
+				t.Errorf("Policy = %s, want %s", v.Policy(), tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestSignaturePolicy(t *testing.T) {
+	signer := NewHMACSigner(testSecret)
+	tests := []struct {
+		policy SignaturePolicy
+		// want maps the listed instances to their signature status.
+		want map[string]SignatureStatus
+	}{
+		{
+			policy: SignatureReject,
+			want:   map[string]SignatureStatus{"tools": SignatureValid, "billing": ""},
+		},
+		{
+			policy: SignatureQuarantine,
+			want: map[string]SignatureStatus{
+				"tools": SignatureValid, "rogue": SignatureUnsigned, "forged": SignatureInvalid, "billing": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			v, err := NewVerifier(VerifierOptions{Secret: testSecret, Policy: tt.policy})
+			if err != nil {
+				t.Fatalf("NewVerifier: %v", err)
+			}
+			d, sink := testSink(SourceMDNS, Options{Verifier: v})
+			tools := endpoint("tools", "10.0.0.1")
+			tools.Text = signer.Sign("tools", tools.Port, map[string]string{"role": "tool"})
+			sink.Upsert(tools, time.Minute)
+			sink.Upsert(endpoint("rogue", "10.0.0.2"), time.Minute)
+			forged := endpoint("forged", "10.0.0.3")
+			forged.Text = signer.Sign("forged", forged.Port, map[string]string{"role": "tool"})
+			forged.Text["role"] = "admin"
+			sink.Upsert(forged, time.Minute)
+			// Static servers are configured by the operator and need no signature.
+			if err := d.AddStatic(endpoint("billing", "10.0.0.4")); err != nil {
+				t.Fatalf("AddStatic: %v", err)
+			}
+
+			servers := d.ServersSnapshot()
+			if len(servers) != len(tt.want) {
+				t.Errorf("listed %v, want %d servers", serverNames(servers), len(tt.want))
+			}
+			for name, want := range tt.want {
+				got, ok := servers[name]
+				if !ok {
+					t.Errorf("%s not listed", name)
+					continue
+				}
+				if got.Signature != want {
+					t.Errorf("%s signature = %q, want %q", name, got.Signature, want)
+				}
+			}
+		})
+	}
+}
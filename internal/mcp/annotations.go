@@ -0,0 +1,51 @@
+package mcp
+
+// ToolAnnotations are the MCP behavioural hints a server attaches to a tool. They are
+// advisory: clients use them for policy, never as a security boundary. Unset hints take
+// the defaults from the MCP specification, exposed through the accessor methods.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+	IdempotentHint  *bool  `json:"idempotentHint,omitempty"`
+	OpenWorldHint   *bool  `json:"openWorldHint,omitempty"`
+}
+
+// ReadOnly reports whether the tool does not modify its environment (default false).
+func (a *ToolAnnotations) ReadOnly() bool {
+	return a != nil && a.ReadOnlyHint != nil && *a.ReadOnlyHint
+}
+
+// Destructive reports whether the tool may perform destructive updates. Read-only tools
+// are never destructive; otherwise the default is true.
+func (a *ToolAnnotations) Destructive() bool {
+	if a.ReadOnly() {
+		return false
+	}
+	if a == nil || a.DestructiveHint == nil {
+		return true
+	}
+	return *a.DestructiveHint
+}
+
+// Idempotent reports whether repeating a call with the same arguments has no additional
+// effect (default false). Read-only tools are treated as idempotent.
+func (a *ToolAnnotations) Idempotent() bool {
+	if a.ReadOnly() {
+		return true
+	}
+	return a != nil && a.IdempotentHint != nil && *a.IdempotentHint
+}
+
+// OpenWorld reports whether the tool interacts with external entities (default true).
+func (a *ToolAnnotations) OpenWorld() bool {
+	if a == nil || a.OpenWorldHint == nil {
+		return true
+	}
+	return *a.OpenWorldHint
+}
+
+// Hint returns a pointer to v for populating ToolAnnotations literals.
+func Hint(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,214 @@
+package mcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.mcpwrapper/internal/config"
+	"go.mcpwrapper/internal/discovery"
+)
+
+// AuthTextKey is the TXT key a server uses to advertise which credential scheme it expects,
+// e.g. auth=corp-bearer. The value is matched against the scheme names in an Auth.
+const AuthTextKey = "auth"
+
+// Credentials authenticate outbound calls to one MCP server. Bearer, Username, Password and
+// header values accept a literal, "env:NAME" to read an environment variable, or
+// "file:/path" to read a file (trailing whitespace is trimmed).
+type Credentials struct {
+	// Bearer is sent as Authorization: Bearer <token>.
+	Bearer string `json:"bearer,omitempty"`
+	// Username and Password are sent as HTTP basic auth.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Headers are set on every request, e.g. an API key header.
+	Headers map[string]string `json:"headers,omitempty"`
+	// CertFile and KeyFile are a PEM client certificate and key for mutual TLS.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// CAFile is a PEM bundle trusted in addition to the system roots when the server is
+	// reached over https (TXT scheme=https or an https url).
+	CAFile string `json:"ca_file,omitempty"`
+	// ServerName overrides the name verified against the server certificate.
+	ServerName string `json:"server_name,omitempty"`
+}
+
+// Auth selects credentials for each server: by instance name first, then by the scheme
+// the server advertises under the auth TXT key. Servers matching neither get no
+// credentials. An Auth is immutable once built.
+type Auth struct {
+	servers map[string]*credentials
+	schemes map[string]*credentials
+}
+
+// credentials are Credentials with secrets resolved and the TLS client built.
+type credentials struct {
+	bearer   string
+	username string
+	password string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewAuth resolves secrets and loads certificates for the given credentials, keyed by
+// instance name and by advertised scheme.
+func NewAuth(servers, schemes map[string]Credentials) (*Auth, error) {
+	a := &Auth{
+		servers: make(map[string]*credentials, len(servers)),
+		schemes: make(map[string]*credentials, len(schemes)),
+	}
+	for name, creds := range servers {
+		resolved, err := creds.resolve()
+		if err != nil {
+			return nil, fmt.Errorf("server %s: %w", name, err)
+		}
+		a.servers[strings.TrimSpace(name)] = resolved
+	}
+	for name, creds := range schemes {
+		resolved, err := creds.resolve()
+		if err != nil {
+			return nil, fmt.Errorf("scheme %s: %w", name, err)
+		}
+		a.schemes[strings.ToLower(strings.TrimSpace(name))] = resolved
+	}
+	return a, nil
+}
+
+// LoadAuth reads credentials from a JSON file of the form
+//
+//	{"servers": {"<instance>": {...}}, "schemes": {"<auth TXT value>": {...}}}
+func LoadAuth(path string) (*Auth, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read auth file: %w", err)
+	}
+	var doc struct {
+		Servers map[string]Credentials `json:"servers"`
+		Schemes map[string]Credentials `json:"schemes"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse auth file: %w", err)
+	}
+	return NewAuth(doc.Servers, doc.Schemes)
+}
+
+// lookup returns the credentials for server, reached over https when secure. Any host on
+// the network can advertise a scheme, so scheme credentials are only handed to a server
+// whose certificate is verified on the https connection or whose announcement signature
+// checked out; over plain http an unsigned server gets none.
+func (a *Auth) lookup(server *discovery.ServerInfo, secure bool) *credentials {
+	if a == nil || server == nil {
+		return nil
+	}
+	if creds, ok := a.servers[server.Instance]; ok {
+		return creds
+	}
+	if !secure && server.Signature != discovery.SignatureValid {
+		return nil
+	}
+	if scheme := strings.ToLower(strings.TrimSpace(server.Text[AuthTextKey])); scheme != "" {
+		return a.schemes[scheme]
+	}
+	return nil
+}
+
+func (c Credentials) resolve() (*credentials, error) {
+	if c.Bearer != "" && (c.Username != "" || c.Password != "") {
+		return nil, errors.New("bearer and basic auth are mutually exclusive")
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("cert_file and key_file must be set together")
+	}
+	var (
+		out credentials
+		err error
+	)
+	if out.bearer, err = config.ResolveSecret(c.Bearer); err != nil {
+		return nil, fmt.Errorf("bearer: %w", err)
+	}
+	if out.username, err = config.ResolveSecret(c.Username); err != nil {
+		return nil, fmt.Errorf("username: %w", err)
+	}
+	if out.password, err = config.ResolveSecret(c.Password); err != nil {
+		return nil, fmt.Errorf("password: %w", err)
+	}
+	if len(c.Headers) > 0 {
+		out.headers = make(map[string]string, len(c.Headers))
+		for name, value := range c.Headers {
+			if out.headers[name], err = config.ResolveSecret(value); err != nil {
+				return nil, fmt.Errorf("header %s: %w", name, err)
+			}
+		}
+	}
+	if c.CertFile != "" || c.CAFile != "" || c.ServerName != "" {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport := newTransport()
+		transport.TLSClientConfig = tlsConfig
+		out.client = &http.Client{Transport: transport}
+	}
+	return &out, nil
+}
+
+func (c Credentials) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s contains no PEM certificates", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+func (c *credentials) apply(req *http.Request) {
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+	switch {
+	case c.bearer != "":
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	case c.username != "" || c.password != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+// do sends req to server with the server's credentials, if any, falling back to the
+// server's other addresses when its primary one is unreachable.
+func (c *Client) do(server *discovery.ServerInfo, req *http.Request) (*http.Response, error) {
+	req = req.WithContext(withDialTarget(req.Context(), &c.addresses, server))
+	client := c.httpClient
+	if creds := c.auth.lookup(server, req.URL.Scheme == "https"); creds != nil {
+		creds.apply(req)
+		if creds.client != nil {
+			client = creds.client
+		}
+	}
+	return client.Do(req)
+}
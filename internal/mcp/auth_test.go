@@ -0,0 +1,50 @@
+package mcp
+
+import (
+	"testing"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+func TestAuthLookup(t *testing.T) {
+	auth, err := NewAuth(
+		map[string]Credentials{"billing": {Bearer: "server-token"}},
+		map[string]Credentials{"corp-bearer": {Bearer: "scheme-token"}},
+	)
+	if err != nil {
+		t.Fatalf("NewAuth: %v", err)
+	}
+	tests := []struct {
+		name      string
+		instance  string
+		scheme    string
+		signature discovery.SignatureStatus
+		secure    bool
+		want      string
+	}{
+		{name: "instance match over http", instance: "billing", want: "server-token"},
+		{name: "instance beats scheme", instance: "billing", scheme: "corp-bearer", want: "server-token"},
+		{name: "scheme over https", instance: "tools", scheme: "corp-bearer", secure: true, want: "scheme-token"},
+		{name: "scheme with a valid signature", instance: "tools", scheme: "corp-bearer", signature: discovery.SignatureValid, want: "scheme-token"},
+		{name: "scheme withheld over plain http", instance: "tools", scheme: "corp-bearer"},
+		{name: "scheme withheld with an invalid signature", instance: "tools", scheme: "corp-bearer", signature: discovery.SignatureInvalid},
+		{name: "scheme withheld when unsigned", instance: "tools", scheme: "corp-bearer", signature: discovery.SignatureUnsigned},
+		{name: "unknown scheme", instance: "tools", scheme: "other", secure: true},
+		{name: "no scheme", instance: "tools", secure: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &discovery.ServerInfo{Instance: tt.instance, Signature: tt.signature, Text: map[string]string{}}
+			if tt.scheme != "" {
+				server.Text[AuthTextKey] = tt.scheme
+			}
+			got := ""
+			if creds := auth.lookup(server, tt.secure); creds != nil {
+				got = creds.bearer
+			}
+			if got != tt.want {
+				t.Errorf("bearer = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
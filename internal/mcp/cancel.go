@@ -0,0 +1,135 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// ErrCancelledByClient is the cancellation cause recorded when a client sends
+// notifications/cancelled for an in-flight call.
+var ErrCancelledByClient = errors.New("call cancelled by client")
+
+const cancelTimeout = 5 * time.Second
+
+// notifyCancelled tells the server to abandon request id: a JSON-RPC id or a legacy call
+// id. It runs in the background with its own deadline because the call's context is
+// already done.
+func (c *Client) notifyCancelled(server *discovery.ServerInfo, sessionID string, id any, reason error) {
+	params := map[string]any{"requestId": id}
+	if reason != nil {
+		params["reason"] = reason.Error()
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+		defer cancel()
+		if Dialect(server) == DialectJSONRPC {
+			_, _, _ = c.post(ctx, server, sessionID, rpcRequest{
+				JSONRPC: jsonRPCVersion,
+				Method:  "notifications/cancelled",
+				Params:  params,
+			})
+			return
+		}
+		_ = c.invokeLegacy(ctx, server, "notifications/cancelled", params, nil)
+	}()
+}
+
+// Inflight tracks cancellable calls on the server side, keyed by request id, so that
+// notifications/cancelled can abort the work. Ids are only unique per caller, so calls
+// sharing one are all kept, and a cancellation aborts each of them.
+type Inflight struct {
+	mu    sync.Mutex
+	calls map[string][]*trackedCall
+}
+
+type trackedCall struct {
+	cancel context.CancelCauseFunc
+}
+
+// NewInflight returns an empty registry.
+func NewInflight() *Inflight {
+	return &Inflight{calls: make(map[string][]*trackedCall)}
+}
+
+// Track derives a cancellable context for request id. The returned release func must be
+// called when the call finishes; it forgets this call only, never another one tracked
+// under the same id. Calls without an id are not tracked.
+func (f *Inflight) Track(ctx context.Context, id json.RawMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	key := normalizeID(id)
+	if key == "" {
+		return ctx, func() { cancel(nil) }
+	}
+	call := &trackedCall{cancel: cancel}
+	f.mu.Lock()
+	f.calls[key] = append(f.calls[key], call)
+	f.mu.Unlock()
+	return ctx, func() {
+		f.mu.Lock()
+		calls := slices.DeleteFunc(f.calls[key], func(c *trackedCall) bool { return c == call })
+		if len(calls) == 0 {
+			delete(f.calls, key)
+		} else {
+			f.calls[key] = calls
+		}
+		f.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// Cancel aborts the calls with the given id and reports whether any was in flight.
+func (f *Inflight) Cancel(id json.RawMessage, reason string) bool {
+	key := normalizeID(id)
+	f.mu.Lock()
+	calls := f.calls[key]
+	delete(f.calls, key)
+	f.mu.Unlock()
+	cause := ErrCancelledByClient
+	if reason != "" {
+		cause = errors.Join(ErrCancelledByClient, errors.New(reason))
+	}
+	for _, call := range calls {
+		call.cancel(cause)
+	}
+	return len(calls) > 0
+}
+
+// Len reports the number of calls currently in flight.
+func (f *Inflight) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, calls := range f.calls {
+		n += len(calls)
+	}
+	return n
+}
+
+// CancelledParams is the payload of notifications/cancelled.
+type CancelledParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
+// HandleCancelled serves the legacy-dialect POST /notifications/cancelled endpoint.
+func (f *Inflight) HandleCancelled(w http.ResponseWriter, r *http.Request) {
+	var params CancelledParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, `{"error":{"message":"invalid cancellation payload"}}`, http.StatusBadRequest)
+		return
+	}
+	f.Cancel(params.RequestID, params.Reason)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func normalizeID(id json.RawMessage) string {
+	return strings.Trim(strings.TrimSpace(string(id)), `"`)
+}
@@ -1,15 +1,17 @@
 package mcp
 
 import (
-	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"go.mcpwrapper/internal/discovery"
@@ -17,11 +19,37 @@ import (
 
 // ToolDefinition mirrors the MCP tool metadata returned by servers.
 type ToolDefinition struct {
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	Parameters  map[string]any `json:"parameters"`
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description"`
+	Parameters  map[string]any   `json:"parameters"`
+	Annotations *ToolAnnotations `json:"annotations,omitempty"`
 }
 
+// UnmarshalJSON accepts both the legacy `parameters` field and the MCP `inputSchema` field.
+func (t *ToolDefinition) UnmarshalJSON(data []byte) error {
+	type plain ToolDefinition
+	var raw struct {
+		plain
+		InputSchema map[string]any `json:"inputSchema"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*t = ToolDefinition(raw.plain)
+	if len(t.Parameters) == 0 && len(raw.InputSchema) > 0 {
+		t.Parameters = raw.InputSchema
+	}
+	if t.Title == "" && t.Annotations != nil {
+		t.Title = t.Annotations.Title
+	}
+	return nil
+}
+
+// ErrToolError marks a call that reached the tool but that the tool itself reported as
+// failed (MCP isError). Retrying such calls is pointless.
+var ErrToolError = errors.New("tool reported an error")
+
 // CallResult is the generic return payload from /tools/call responses.
 type CallResult struct {
 	Tool   string         `json:"tool"`
@@ -30,12 +58,32 @@ type CallResult struct {
 
 // Client provides a minimal MCP HTTP client.
 type Client struct {
-	httpClient *http.Client
+	httpClient  *http.Client
+	idleTimeout time.Duration
+	sampling    SamplingHandler
+	auth        *Auth
+	requestID   int64
+	// callPrefix makes legacy call ids unique across clients, since a legacy server
+	// tracks the calls of all its callers together.
+	callPrefix string
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*session
+
+	// addresses remembers which address of a multi-address server last connected.
+	addresses addressBook
 }
 
 // Options control client behaviour.
 type Options struct {
+	// Timeout is an idle timeout: a call fails when the server sends nothing (response,
+	// stream event, or progress notification) for this long. Defaults to 30s.
 	Timeout time.Duration
+	// Sampling, when set, lets tool servers request completions from the client's model
+	// during tools/call. Leave nil to decline sampling requests.
+	Sampling SamplingHandler
+	// Auth supplies per-server credentials. Leave nil to call every server anonymously.
+	Auth *Auth
 }
 
 // NewClient constructs a client with sane defaults.
@@ -45,45 +93,24 @@ func NewClient(opts Options) *Client {
 		timeout = 30 * time.Second
 	}
 	return &Client{
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
+		httpClient:  &http.Client{Transport: newTransport()},
+		idleTimeout: timeout,
+		sampling:    opts.Sampling,
+		auth:        opts.Auth,
+		sessions:    make(map[string]*session),
+		callPrefix:  newCallPrefix(),
 	}
 }
 
-// ListTools queries the MCP server for available tools.
-func (c *Client) ListTools(ctx context.Context, server *discovery.ServerInfo) ([]ToolDefinition, error) {
-	if server == nil {
-		return nil, fmt.Errorf("nil server")
-	}
-	endpoint, err := buildURL(server, "/tools/list")
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		return nil, fmt.Errorf("build request: %w", err)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("list tools: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, fmt.Errorf("list tools failed: %s (%s)", resp.Status, strings.TrimSpace(string(body)))
-	}
+func newCallPrefix() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
 
-	var payload struct {
-		Tools []ToolDefinition `json:"tools"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, fmt.Errorf("decode tools: %w", err)
-	}
-	return payload.Tools, nil
+// ListTools queries the MCP server for available tools, following cursor pagination.
+func (c *Client) ListTools(ctx context.Context, server *discovery.ServerInfo) ([]ToolDefinition, error) {
+	return listAll[ToolDefinition](ctx, c, server, "tools/list", "tools")
 }
 
 // CallTool invokes a specific tool with arguments.
@@ -95,41 +122,78 @@ func (c *Client) CallTool(ctx context.Context, server *discovery.ServerInfo, too
 	if strings.TrimSpace(tool) == "" {
 		return result, fmt.Errorf("tool name is required")
 	}
-	endpoint, err := buildURL(server, "/tools/call")
-	if err != nil {
-		return result, err
-	}
 
-	reqPayload := map[string]any{
+	params := map[string]any{
 		"name":      tool,
 		"arguments": arguments,
 	}
-	buf, err := json.Marshal(reqPayload)
-	if err != nil {
-		return result, fmt.Errorf("encode request: %w", err)
+	if fn := progressFromContext(ctx); fn != nil {
+		params["_meta"] = map[string]any{
+			"progressToken": fmt.Sprintf("%s-%d", slug(server.Instance), c.nextID()),
+		}
+		ctx = WithProgress(ctx, func(p Progress) {
+			p.Server = server.Instance
+			p.Tool = tool
+			fn(p)
+		})
+	}
+	var payload callToolResponse
+	if err := c.invoke(ctx, server, "tools/call", params, &payload); err != nil {
+		return result, err
 	}
+	return payload.normalize(tool)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(buf))
-	if err != nil {
-		return result, fmt.Errorf("build request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
+// callToolResponse accepts both the legacy {tool, result} body and the MCP CallToolResult shape.
+type callToolResponse struct {
+	Tool              string           `json:"tool"`
+	Result            map[string]any   `json:"result"`
+	Content           []map[string]any `json:"content"`
+	StructuredContent map[string]any   `json:"structuredContent"`
+	IsError           bool             `json:"isError"`
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return result, fmt.Errorf("call tool: %w", err)
+func (r callToolResponse) normalize(tool string) (CallResult, error) {
+	result := CallResult{Tool: r.Tool, Result: r.Result}
+	if result.Tool == "" {
+		result.Tool = tool
+	}
+	if result.Result == nil {
+		switch {
+		case r.StructuredContent != nil:
+			result.Result = r.StructuredContent
+		case r.Content != nil:
+			result.Result = map[string]any{"content": r.Content}
+		}
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		return result, fmt.Errorf("call tool failed: %s (%s)", resp.Status, strings.TrimSpace(string(body)))
+	if r.IsError {
+		return result, fmt.Errorf("%w: %s: %s", ErrToolError, tool, contentText(r.Content))
 	}
+	return result, nil
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return result, fmt.Errorf("decode response: %w", err)
+func contentText(content []map[string]any) string {
+	parts := make([]string, 0, len(content))
+	for _, item := range content {
+		if text, ok := item["text"].(string); ok && strings.TrimSpace(text) != "" {
+			parts = append(parts, strings.TrimSpace(text))
+		}
 	}
-	return result, nil
+	if len(parts) == 0 {
+		return "no details"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func slug(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
 }
 
 func buildURL(server *discovery.ServerInfo, path string) (string, error) {
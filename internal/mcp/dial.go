@@ -0,0 +1,189 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// connectionAttemptDelay is how long a connection attempt may run before the next
+// address is tried alongside it (RFC 8305).
+const connectionAttemptDelay = 250 * time.Millisecond
+
+var defaultDialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+// dialContext makes each connection attempt of dialParallel.
+var dialContext = defaultDialer.DialContext
+
+// addressBook remembers, per server instance, the last address a connection succeeded on.
+type addressBook struct {
+	mu   sync.Mutex
+	last map[string]string
+}
+
+func (b *addressBook) get(instance string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last[instance]
+}
+
+func (b *addressBook) set(instance, address string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last == nil {
+		b.last = make(map[string]string)
+	}
+	b.last[instance] = address
+}
+
+type dialTargetKey struct{}
+
+// dialTarget rides on a request context so that dialServer can fall back to the other
+// addresses of the server the request is for.
+type dialTarget struct {
+	instance  string
+	addresses []string
+	book      *addressBook
+}
+
+// withDialTarget attaches server's addresses to ctx when it advertises more than one.
+func withDialTarget(ctx context.Context, book *addressBook, server *discovery.ServerInfo) context.Context {
+	addresses := server.Addresses
+	if server.Address != "" && !slices.Contains(addresses, server.Address) {
+		addresses = append([]string{server.Address}, addresses...)
+	}
+	if len(addresses) < 2 {
+		return ctx
+	}
+	return context.WithValue(ctx, dialTargetKey{}, &dialTarget{
+		instance:  server.Instance,
+		addresses: addresses,
+		book:      book,
+	})
+}
+
+// newTransport returns a copy of the default transport that dials through dialServer.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialServer
+	return transport
+}
+
+// dialServer dials addr, or, when addr is one of the addresses of the request's server,
+// races them all Happy Eyeballs style: the remembered address first, then alternating
+// address families, each attempt starting when the previous one fails or stalls for
+// connectionAttemptDelay. The winning address is remembered for the next dial.
+func dialServer(ctx context.Context, network, addr string) (net.Conn, error) {
+	target, _ := ctx.Value(dialTargetKey{}).(*dialTarget)
+	if target == nil || !slices.Contains(target.addresses, addr) {
+		return defaultDialer.DialContext(ctx, network, addr)
+	}
+	conn, winner, err := dialParallel(ctx, network, dialOrder(target.addresses, target.book.get(target.instance)))
+	if err != nil {
+		return nil, err
+	}
+	target.book.set(target.instance, winner)
+	return conn, nil
+}
+
+// dialOrder puts preferred first, then interleaves the remaining addresses by family,
+// starting with the family of the first.
+func dialOrder(addresses []string, preferred string) []string {
+	rest := make([]string, 0, len(addresses))
+	var ordered []string
+	for _, addr := range addresses {
+		if addr == preferred {
+			ordered = append(ordered, addr)
+		} else {
+			rest = append(rest, addr)
+		}
+	}
+	var first, second []string
+	for _, addr := range rest {
+		if len(first) == 0 || isIPv6(addr) == isIPv6(first[0]) {
+			first = append(first, addr)
+		} else {
+			second = append(second, addr)
+		}
+	}
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			ordered = append(ordered, first[i])
+		}
+		if i < len(second) {
+			ordered = append(ordered, second[i])
+		}
+	}
+	return ordered
+}
+
+func isIPv6(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() == nil
+}
+
+// dialParallel connects to the first reachable of addresses, returning it with the
+// connection. Connections that succeed after the winner are closed.
+func dialParallel(ctx context.Context, network string, addresses []string) (net.Conn, string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		addr string
+		err  error
+	}
+	results := make(chan result, len(addresses))
+	next, pending := 0, 0
+	start := func() {
+		addr := addresses[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dialContext(ctx, network, addr)
+			results <- result{conn: conn, addr: addr, err: err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(connectionAttemptDelay)
+	defer timer.Stop()
+	var errs []error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if next < len(addresses) {
+				start()
+				timer.Reset(connectionAttemptDelay)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, r.addr, nil
+			}
+			errs = append(errs, r.err)
+			if next < len(addresses) {
+				start()
+				timer.Reset(connectionAttemptDelay)
+			}
+		}
+	}
+	return nil, "", errors.Join(errs...)
+}
@@ -0,0 +1,198 @@
+package mcp
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+func TestDialOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses []string
+		preferred string
+		want      []string
+	}{
+		{
+			name:      "single address",
+			addresses: []string{"10.0.0.1:80"},
+			want:      []string{"10.0.0.1:80"},
+		},
+		{
+			name:      "interleaves families starting with the first",
+			addresses: []string{"10.0.0.1:80", "10.0.0.2:80", "[fd00::1]:80", "[fd00::2]:80"},
+			want:      []string{"10.0.0.1:80", "[fd00::1]:80", "10.0.0.2:80", "[fd00::2]:80"},
+		},
+		{
+			name:      "IPv6 first",
+			addresses: []string{"[fd00::1]:80", "10.0.0.1:80", "10.0.0.2:80"},
+			want:      []string{"[fd00::1]:80", "10.0.0.1:80", "10.0.0.2:80"},
+		},
+		{
+			name:      "one family keeps its order",
+			addresses: []string{"10.0.0.3:80", "10.0.0.1:80", "10.0.0.2:80"},
+			want:      []string{"10.0.0.3:80", "10.0.0.1:80", "10.0.0.2:80"},
+		},
+		{
+			name:      "remembered address goes first",
+			addresses: []string{"10.0.0.1:80", "10.0.0.2:80", "[fd00::1]:80"},
+			preferred: "[fd00::1]:80",
+			want:      []string{"[fd00::1]:80", "10.0.0.1:80", "10.0.0.2:80"},
+		},
+		{
+			name:      "remaining addresses interleave after the remembered one",
+			addresses: []string{"10.0.0.1:80", "10.0.0.2:80", "[fd00::1]:80", "[fd00::2]:80"},
+			preferred: "10.0.0.2:80",
+			want:      []string{"10.0.0.2:80", "10.0.0.1:80", "[fd00::1]:80", "[fd00::2]:80"},
+		},
+		{
+			name:      "unknown remembered address is ignored",
+			addresses: []string{"10.0.0.1:80", "[fd00::1]:80"},
+			preferred: "10.9.9.9:80",
+			want:      []string{"10.0.0.1:80", "[fd00::1]:80"},
+		},
+		{
+			name:      "host names count as IPv4",
+			addresses: []string{"tools.local:80", "[fd00::1]:80", "10.0.0.1:80"},
+			want:      []string{"tools.local:80", "[fd00::1]:80", "10.0.0.1:80"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dialOrder(tt.addresses, tt.preferred)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("dialOrder(%v, %q) = %v, want %v", tt.addresses, tt.preferred, got, tt.want)
+			}
+		})
+	}
+}
+
+// listen returns a local listener that accepts and discards connections.
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln
+}
+
+// closedAddress returns a local address nothing listens on.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// unreachable stands for an address whose connection attempts hang until cancelled, like
+// a host that drops SYNs.
+const unreachable = "192.0.2.1:9"
+
+// stallUnreachable makes attempts on unreachable hang until their context ends and
+// reports, on the returned channel, each one that was abandoned.
+func stallUnreachable(t *testing.T) <-chan struct{} {
+	t.Helper()
+	abandoned := make(chan struct{}, 8)
+	orig := dialContext
+	dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr != unreachable {
+			return orig(ctx, network, addr)
+		}
+		<-ctx.Done()
+		abandoned <- struct{}{}
+		return nil, ctx.Err()
+	}
+	t.Cleanup(func() { dialContext = orig })
+	return abandoned
+}
+
+func TestDialParallelFallback(t *testing.T) {
+	good := listen(t).Addr().String()
+	tests := []struct {
+		name      string
+		addresses []string
+		// stalls is how many attempts hang, each holding up the next for
+		// connectionAttemptDelay.
+		stalls int
+	}{
+		{name: "first refuses", addresses: []string{closedAddress(t), good}},
+		{name: "first unreachable", addresses: []string{unreachable, good}, stalls: 1},
+		{name: "several fail first", addresses: []string{closedAddress(t), unreachable, closedAddress(t), good}, stalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			abandoned := stallUnreachable(t)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			start := time.Now()
+			conn, winner, err := dialParallel(ctx, "tcp", tt.addresses)
+			if err != nil {
+				t.Fatalf("dialParallel: %v", err)
+			}
+			conn.Close()
+			elapsed := time.Since(start)
+			if winner != good {
+				t.Errorf("winner = %s, want %s", winner, good)
+			}
+			if floor := time.Duration(tt.stalls) * connectionAttemptDelay; elapsed < floor {
+				t.Errorf("took %v, want at least %v", elapsed, floor)
+			}
+			if ceiling := time.Duration(tt.stalls+1) * 2 * connectionAttemptDelay; elapsed > ceiling {
+				t.Errorf("took %v, want under %v", elapsed, ceiling)
+			}
+			for i := 0; i < tt.stalls; i++ {
+				select {
+				case <-abandoned:
+				case <-time.After(time.Second):
+					t.Fatal("stalled attempt not cancelled after the winner connected")
+				}
+			}
+		})
+	}
+}
+
+func TestDialParallelAllFail(t *testing.T) {
+	_, _, err := dialParallel(context.Background(), "tcp", []string{closedAddress(t), closedAddress(t)})
+	if err == nil {
+		t.Fatal("dialParallel succeeded with no listener")
+	}
+}
+
+func TestDialServerRemembersWinner(t *testing.T) {
+	good := listen(t).Addr().String()
+	bad := closedAddress(t)
+	book := &addressBook{}
+	server := &discovery.ServerInfo{Instance: "tools", Address: bad, Addresses: []string{bad, good}}
+	ctx := withDialTarget(context.Background(), book, server)
+
+	conn, err := dialServer(ctx, "tcp", bad)
+	if err != nil {
+		t.Fatalf("dialServer: %v", err)
+	}
+	conn.Close()
+	if got := book.get("tools"); got != good {
+		t.Fatalf("remembered %q, want %q", got, good)
+	}
+	if order := dialOrder(server.Addresses, book.get("tools")); order[0] != good {
+		t.Fatalf("next dial starts with %s, want %s", order[0], good)
+	}
+}
@@ -0,0 +1,203 @@
+package mcptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/openai/openai-go"
+	oaioption "github.com/openai/openai-go/option"
+)
+
+// Turn is one scripted assistant reply: either tool calls or final content.
+type Turn struct {
+	Content   string
+	ToolCalls []ToolCall
+}
+
+// ToolCall asks for a function call. Function may be the exact function name offered to
+// the model or a bare tool name, which matches the first offered `<instance>__<tool>`.
+type ToolCall struct {
+	Function  string
+	Arguments map[string]any
+}
+
+// Reply is a Turn that ends the conversation with text.
+func Reply(text string) Turn {
+	return Turn{Content: text}
+}
+
+// CallTools is a Turn that requests the given tool calls.
+func CallTools(calls ...ToolCall) Turn {
+	return Turn{ToolCalls: calls}
+}
+
+// ChatRequest is the part of a chat completion request the fake model records.
+type ChatRequest struct {
+	Model    string           `json:"model"`
+	Messages []map[string]any `json:"messages"`
+	Tools    []struct {
+		Function struct {
+			Name        string         `json:"name"`
+			Description string         `json:"description"`
+			Parameters  map[string]any `json:"parameters"`
+		} `json:"function"`
+	} `json:"tools"`
+	Stream bool `json:"stream"`
+}
+
+// ToolNames lists the functions offered in the request.
+func (r ChatRequest) ToolNames() []string {
+	names := make([]string, 0, len(r.Tools))
+	for _, tool := range r.Tools {
+		names = append(names, tool.Function.Name)
+	}
+	return names
+}
+
+// Model is a scripted OpenAI-compatible chat completions endpoint. Each request consumes
+// the next Turn; requests beyond the script fail with 500.
+type Model struct {
+	http *httptest.Server
+
+	mu       sync.Mutex
+	script   []Turn
+	requests []ChatRequest
+}
+
+// NewModel starts a fake model that answers with the given turns in order.
+func NewModel(turns ...Turn) *Model {
+	m := &Model{script: turns}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", m.handle)
+	m.http = httptest.NewServer(mux)
+	return m
+}
+
+// Client returns an OpenAI client pointed at the fake model.
+func (m *Model) Client() *openai.Client {
+	client := openai.NewClient(
+		oaioption.WithBaseURL(m.http.URL+"/v1/"),
+		oaioption.WithAPIKey("test"),
+		oaioption.WithMaxRetries(0),
+	)
+	return &client
+}
+
+// Append adds turns to the end of the script.
+func (m *Model) Append(turns ...Turn) {
+	m.mu.Lock()
+	m.script = append(m.script, turns...)
+	m.mu.Unlock()
+}
+
+// Requests returns the chat requests received so far.
+func (m *Model) Requests() []ChatRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ChatRequest(nil), m.requests...)
+}
+
+// Close shuts the fake model down.
+func (m *Model) Close() {
+	m.http.Close()
+}
+
+func (m *Model) handle(w http.ResponseWriter, r *http.Request) {
+	var req ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	m.requests = append(m.requests, req)
+	n := len(m.requests)
+	var (
+		turn Turn
+		ok   bool
+	)
+	if len(m.script) > 0 {
+		turn, m.script, ok = m.script[0], m.script[1:], true
+	}
+	m.mu.Unlock()
+
+	if req.Stream {
+		writeModelError(w, http.StatusBadRequest, "the fake model does not script streaming responses")
+		return
+	}
+	if !ok {
+		writeModelError(w, http.StatusInternalServerError, fmt.Sprintf("model script exhausted at request %d", n))
+		return
+	}
+
+	message := map[string]any{"role": "assistant", "content": turn.Content}
+	finish := "stop"
+	if len(turn.ToolCalls) > 0 {
+		calls := make([]map[string]any, 0, len(turn.ToolCalls))
+		for i, call := range turn.ToolCalls {
+			args, _ := json.Marshal(call.Arguments)
+			if call.Arguments == nil {
+				args = []byte("{}")
+			}
+			calls = append(calls, map[string]any{
+				"id":   fmt.Sprintf("call_%d_%d", n, i),
+				"type": "function",
+				"function": map[string]any{
+					"name":      resolveFunction(req, call.Function),
+					"arguments": string(args),
+				},
+			})
+		}
+		message["tool_calls"] = calls
+		finish = "tool_calls"
+	}
+
+	writeJSON(w, map[string]any{
+		"id":      fmt.Sprintf("chatcmpl-fake-%d", n),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   req.Model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"finish_reason": finish,
+			"message":       message,
+		}},
+		"usage": map[string]any{
+			"prompt_tokens":     10,
+			"completion_tokens": 5,
+			"total_tokens":      15,
+		},
+	})
+}
+
+func resolveFunction(req ChatRequest, name string) string {
+	for _, offered := range req.ToolNames() {
+		if offered == name {
+			return name
+		}
+	}
+	for _, offered := range req.ToolNames() {
+		if strings.HasSuffix(offered, "__"+name) {
+			return offered
+		}
+	}
+	return name
+}
+
+func writeJSON(w http.ResponseWriter, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeModelError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": message, "type": "fake_model_error"},
+	})
+}
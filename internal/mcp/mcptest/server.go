@@ -0,0 +1,256 @@
+// Package mcptest provides in-process fakes for exercising MCP clients and the mediator
+// offline: a scriptable MCP tool server on httptest, a static server set that stands in
+// for mDNS discovery, and a scripted OpenAI-compatible model.
+package mcptest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/charmbracelet/log"
+
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mcp"
+	"go.mcpwrapper/internal/mcp/server"
+)
+
+// ErrScripted is the default failure returned by tools configured to fail.
+var ErrScripted = errors.New("scripted tool failure")
+
+// Tool scripts the behaviour of one fake tool.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any
+	Annotations *mcp.ToolAnnotations
+
+	// Result is returned on success. When nil the call's arguments are echoed back.
+	Result any
+	// Latency delays every call. The delay ends early if the call is cancelled.
+	Latency time.Duration
+	// FailFirst makes the first N calls fail, after which the tool succeeds.
+	FailFirst int
+	// Err makes calls fail with this error: every call, or only the first FailFirst
+	// calls when that is set. Defaults to ErrScripted when FailFirst is set.
+	Err error
+	// Status is the HTTP status legacy-dialect callers see on failure (default 500).
+	Status int
+	// Handler, when set, replaces the scripted behaviour entirely.
+	Handler server.Handler
+}
+
+// Call records one invocation received by a fake tool.
+type Call struct {
+	Tool      string
+	Arguments map[string]any
+	Err       error
+	Cancelled bool
+}
+
+// Options configure a fake server.
+type Options struct {
+	// Instance is the discovery instance name (default "fake").
+	Instance string
+	// Dialect selects the protocol advertised in Info (default mcp.DialectLegacy).
+	// The server answers both dialects regardless.
+	Dialect string
+	// Role is the TXT role advertised in Info (default "tool").
+	Role string
+	// Text adds extra TXT keys to Info.
+	Text map[string]string
+	// PageSize splits tools/list into pages of this many tools (default: one page).
+	PageSize int
+}
+
+// Server is a fake MCP tool server listening on a local httptest server.
+type Server struct {
+	opts Options
+	srv  *server.Server
+	http *httptest.Server
+
+	down atomic.Bool
+
+	mu    sync.Mutex
+	calls []Call
+	count map[string]int
+}
+
+// NewServer starts a fake server hosting the given tools. Call Close when done.
+func NewServer(opts Options, tools ...Tool) *Server {
+	if opts.Instance == "" {
+		opts.Instance = "fake"
+	}
+	if opts.Dialect == "" {
+		opts.Dialect = mcp.DialectLegacy
+	}
+	if opts.Role == "" {
+		opts.Role = discovery.ServerKindTool
+	}
+	s := &Server{
+		opts:  opts,
+		count: make(map[string]int),
+		srv: server.New(server.Options{
+			Name:     opts.Instance,
+			Logger:   log.New(io.Discard),
+			PageSize: opts.PageSize,
+		}),
+	}
+	for _, tool := range tools {
+		s.AddTool(tool)
+	}
+	s.http = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.down.Load() {
+			http.Error(w, "server down", http.StatusServiceUnavailable)
+			return
+		}
+		s.srv.Handler().ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// AddTool registers (or replaces) a scripted tool. Clients holding a notification stream
+// are told the tool list changed.
+func (s *Server) AddTool(tool Tool) {
+	def := server.Tool{
+		Name:        tool.Name,
+		Description: tool.Description,
+		Parameters:  tool.Parameters,
+		Annotations: tool.Annotations,
+	}
+	if def.Description == "" {
+		def.Description = fmt.Sprintf("Fake tool %s.", tool.Name)
+	}
+	s.srv.Register(def, func(ctx context.Context, call *server.Call) (any, error) {
+		var args map[string]any
+		_ = json.Unmarshal(call.Arguments, &args)
+		result, err := s.run(ctx, tool, call, args)
+		s.record(Call{
+			Tool:      tool.Name,
+			Arguments: args,
+			Err:       err,
+			Cancelled: err != nil && ctx.Err() != nil,
+		})
+		return result, err
+	})
+}
+
+// RemoveTool unregisters a tool and notifies clients holding a notification stream.
+func (s *Server) RemoveTool(name string) {
+	s.srv.RemoveTool(name)
+}
+
+// ToolsHash is the digest a real server would advertise under the tools_hash TXT key.
+// Put it in Options.Text, or in a copy of Info, to exercise hash-based caching.
+func (s *Server) ToolsHash() string {
+	return s.srv.ToolsHash()
+}
+
+func (s *Server) run(ctx context.Context, tool Tool, call *server.Call, args map[string]any) (any, error) {
+	s.mu.Lock()
+	s.count[tool.Name]++
+	n := s.count[tool.Name]
+	s.mu.Unlock()
+
+	if tool.Latency > 0 {
+		timer := time.NewTimer(tool.Latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-timer.C:
+		}
+	}
+	if tool.Handler != nil {
+		return tool.Handler(ctx, call)
+	}
+
+	fail := tool.Err != nil && tool.FailFirst == 0
+	if tool.FailFirst > 0 && n <= tool.FailFirst {
+		fail = true
+	}
+	if fail {
+		err := tool.Err
+		if err == nil {
+			err = ErrScripted
+		}
+		if tool.Status != 0 {
+			return nil, &server.Error{Status: tool.Status, Err: err}
+		}
+		return nil, err
+	}
+	if tool.Result != nil {
+		return tool.Result, nil
+	}
+	return map[string]any{"tool": tool.Name, "arguments": args}, nil
+}
+
+func (s *Server) record(call Call) {
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	s.mu.Unlock()
+}
+
+// Calls returns the invocations received so far, optionally filtered by tool name.
+func (s *Server) Calls(tool ...string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Call, 0, len(s.calls))
+	for _, call := range s.calls {
+		if len(tool) == 0 || call.Tool == tool[0] {
+			out = append(out, call)
+		}
+	}
+	return out
+}
+
+// SetDown makes every request fail with 503 until called again with false, simulating
+// a server that is advertised but unreachable.
+func (s *Server) SetDown(down bool) {
+	s.down.Store(down)
+}
+
+// URL returns the base URL of the fake server.
+func (s *Server) URL() string {
+	return s.http.URL
+}
+
+// Info describes the fake server the way discovery would.
+func (s *Server) Info() *discovery.ServerInfo {
+	host, portText, _ := net.SplitHostPort(s.http.Listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	text := map[string]string{
+		"role":     s.opts.Role,
+		"protocol": s.opts.Dialect,
+	}
+	if s.opts.Dialect == mcp.DialectJSONRPC {
+		text["path"] = mcp.DefaultRPCPath
+	}
+	for k, v := range s.opts.Text {
+		text[k] = v
+	}
+	return &discovery.ServerInfo{
+		Instance: s.opts.Instance,
+		Host:     host,
+		Port:     port,
+		Address:  net.JoinHostPort(host, portText),
+		Kind:     s.opts.Role,
+		LastSeen: time.Now(),
+		Text:     text,
+	}
+}
+
+// Close shuts the fake server down, dropping any open notification streams.
+func (s *Server) Close() {
+	s.http.CloseClientConnections()
+	s.http.Close()
+}
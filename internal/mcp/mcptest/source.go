@@ -0,0 +1,52 @@
+package mcptest
+
+import (
+	"sync"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// StaticSource is a fixed, mutable set of servers that satisfies mediator.ServerSource,
+// standing in for mDNS discovery.
+type StaticSource struct {
+	mu      sync.RWMutex
+	servers map[string]*discovery.ServerInfo
+}
+
+// NewStaticSource returns a source holding the given servers.
+func NewStaticSource(servers ...*discovery.ServerInfo) *StaticSource {
+	src := &StaticSource{servers: make(map[string]*discovery.ServerInfo, len(servers))}
+	for _, srv := range servers {
+		src.Add(srv)
+	}
+	return src
+}
+
+// Add inserts or replaces a server, keyed by instance name.
+func (s *StaticSource) Add(srv *discovery.ServerInfo) {
+	if srv == nil {
+		return
+	}
+	s.mu.Lock()
+	s.servers[srv.Instance] = srv
+	s.mu.Unlock()
+}
+
+// Remove drops the server with the given instance name.
+func (s *StaticSource) Remove(instance string) {
+	s.mu.Lock()
+	delete(s.servers, instance)
+	s.mu.Unlock()
+}
+
+// ServersSnapshot returns a copy of the current set.
+func (s *StaticSource) ServersSnapshot() map[string]*discovery.ServerInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]*discovery.ServerInfo, len(s.servers))
+	for k, v := range s.servers {
+		info := *v
+		out[k] = &info
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// Notification methods a server sends when one of its lists changes.
+const (
+	NotifyToolsListChanged     = "notifications/tools/list_changed"
+	NotifyResourcesListChanged = "notifications/resources/list_changed"
+	NotifyPromptsListChanged   = "notifications/prompts/list_changed"
+)
+
+// ToolsHashKey is the TXT key under which servers advertise a digest of their tool list,
+// letting clients that hold no notification stream tell when a cached list is stale.
+const ToolsHashKey = "tools_hash"
+
+// legacyNotificationsPath is the legacy-dialect endpoint streaming server notifications.
+const legacyNotificationsPath = "/notifications"
+
+// Notification is a message a server pushed outside of any call.
+type Notification struct {
+	Method string
+	Params json.RawMessage
+}
+
+// Listen opens the server's notification stream and calls fn for every notification until
+// ctx ends or the server closes the stream. JSON-RPC servers are listened to with GET on
+// their MCP endpoint within the session; legacy servers with GET /notifications. Servers
+// that offer no stream return ErrUnsupported. The idle timeout does not apply.
+func (c *Client) Listen(ctx context.Context, server *discovery.ServerInfo, fn func(Notification)) error {
+	if server == nil {
+		return fmt.Errorf("nil server")
+	}
+	path := legacyNotificationsPath
+	var sess *session
+	sessionID := ""
+	if Dialect(server) == DialectJSONRPC {
+		var err error
+		if sess, err = c.session(ctx, server); err != nil {
+			return err
+		}
+		path = rpcPath(server)
+		sessionID = sess.id
+	}
+	endpoint, err := buildURL(server, path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if sessionID != "" {
+		req.Header.Set(ProtocolHeader, ProtocolVersion)
+		req.Header.Set(SessionHeader, sessionID)
+	}
+
+	resp, err := c.do(server, req)
+	if err != nil {
+		return fmt.Errorf("notification stream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !isEventStream(resp) {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLen))
+		text := strings.TrimSpace(string(data))
+		if resp.StatusCode == http.StatusNotFound && sessionID != "" {
+			// The session expired; the next attempt re-initializes.
+			c.dropSession(server, sess)
+			return fmt.Errorf("notification stream: session expired (%s)", text)
+		}
+		if isMissingRoute(resp.StatusCode, text) || resp.StatusCode == http.StatusOK {
+			return fmt.Errorf("notification stream: %w", ErrUnsupported)
+		}
+		return fmt.Errorf("notification stream failed: %s (%s)", resp.Status, text)
+	}
+
+	err = readEvents(resp.Body, func(_ string, data string) error {
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return fmt.Errorf("decode notification: %w", err)
+		}
+		switch {
+		case msg.Method != "" && msg.hasID():
+			if err := c.reply(ctx, server, sessionID, c.handleServerRequest(ctx, server, msg)); err != nil {
+				return fmt.Errorf("reply to %s: %w", msg.Method, err)
+			}
+		case msg.Method != "":
+			fn(Notification{Method: msg.Method, Params: msg.Params})
+		}
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("notification stream closed by server")
+}
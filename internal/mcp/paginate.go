@@ -0,0 +1,52 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// maxListPages bounds cursor pagination so a misbehaving server cannot loop forever.
+const maxListPages = 100
+
+// listAll follows MCP cursor pagination for a list method, concatenating the items found
+// under key on each page until the server stops returning nextCursor.
+func listAll[T any](ctx context.Context, c *Client, server *discovery.ServerInfo, method, key string) ([]T, error) {
+	var (
+		all    []T
+		cursor string
+	)
+	seen := make(map[string]struct{})
+	for range maxListPages {
+		var params map[string]any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		var page map[string]json.RawMessage
+		if err := c.invoke(ctx, server, method, params, &page); err != nil {
+			return nil, err
+		}
+		if data, ok := page[key]; ok && string(data) != "null" {
+			var items []T
+			if err := json.Unmarshal(data, &items); err != nil {
+				return nil, fmt.Errorf("decode %s: %w", method, err)
+			}
+			all = append(all, items...)
+		}
+		var next string
+		if data, ok := page["nextCursor"]; ok {
+			_ = json.Unmarshal(data, &next)
+		}
+		if next == "" {
+			return all, nil
+		}
+		if _, repeated := seen[next]; repeated {
+			return nil, fmt.Errorf("%s: server repeated cursor %q", method, next)
+		}
+		seen[next] = struct{}{}
+		cursor = next
+	}
+	return nil, fmt.Errorf("%s: more than %d pages", method, maxListPages)
+}
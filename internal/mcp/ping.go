@@ -0,0 +1,39 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// Ping checks that a server is answering. JSON-RPC servers get an MCP ping; legacy servers,
+// which have no ping method, get GET /healthz and must answer 2xx.
+func (c *Client) Ping(ctx context.Context, server *discovery.ServerInfo) error {
+	if server == nil {
+		return fmt.Errorf("nil server")
+	}
+	if Dialect(server) == DialectJSONRPC {
+		return c.invoke(ctx, server, "ping", nil, nil)
+	}
+	endpoint, err := buildURL(server, "/healthz")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	resp, err := c.do(server, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("healthz returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrIdleTimeout is the cancellation cause when a server stops responding for longer than
+// the client's idle timeout.
+var ErrIdleTimeout = errors.New("mcp server idle timeout")
+
+// Progress is a notifications/progress update relayed from a server during a call.
+// Partial carries incremental tool output when the server streams it.
+type Progress struct {
+	Server   string  `json:"server,omitempty"`
+	Tool     string  `json:"tool,omitempty"`
+	Token    string  `json:"progress_token,omitempty"`
+	Progress float64 `json:"progress"`
+	Total    float64 `json:"total,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	Partial  string  `json:"partial,omitempty"`
+}
+
+// ProgressFunc receives progress updates. It is called from the goroutine reading the
+// server's stream and should not block.
+type ProgressFunc func(Progress)
+
+type progressKey struct{}
+
+// WithProgress returns a context whose tool calls request progress updates and deliver
+// them to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func progressFromContext(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
+
+type progressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      float64         `json:"progress"`
+	Total         float64         `json:"total,omitempty"`
+	Message       string          `json:"message,omitempty"`
+	Partial       string          `json:"partial,omitempty"`
+}
+
+// watchdog cancels a call when no response bytes or stream events arrive within the
+// idle timeout. Every event resets it, so long calls survive as long as they report progress.
+type watchdog struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+type watchdogKey struct{}
+
+func (c *Client) withWatchdog(ctx context.Context) (context.Context, func()) {
+	if c.idleTimeout <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	w := &watchdog{timeout: c.idleTimeout}
+	w.timer = time.AfterFunc(c.idleTimeout, func() {
+		cancel(fmt.Errorf("%w after %s", ErrIdleTimeout, c.idleTimeout))
+	})
+	ctx = context.WithValue(ctx, watchdogKey{}, w)
+	return ctx, func() {
+		w.timer.Stop()
+		cancel(nil)
+	}
+}
+
+// touch resets the idle timer for the call carried by ctx, if any.
+func touch(ctx context.Context) {
+	if w, ok := ctx.Value(watchdogKey{}).(*watchdog); ok {
+		w.mu.Lock()
+		w.timer.Reset(w.timeout)
+		w.mu.Unlock()
+	}
+}
+
+// keepAlive holds the idle timer open while the client itself is busy (e.g. running a
+// sampling request for the server), since the server cannot make progress meanwhile.
+func keepAlive(ctx context.Context) func() {
+	w, ok := ctx.Value(watchdogKey{}).(*watchdog)
+	if !ok {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(w.timeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				touch(ctx)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		touch(ctx)
+	}
+}
+
+// causeOf prefers the cancellation cause (e.g. ErrIdleTimeout) over a bare context error.
+func causeOf(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if cause := context.Cause(ctx); cause != nil && !errors.Is(err, cause) && ctx.Err() != nil {
+		return fmt.Errorf("%w (%v)", cause, err)
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// Prompt describes a reusable prompt template published by an MCP server.
+type Prompt struct {
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptArgument documents a single argument accepted by a prompt template.
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptMessage is one message of an expanded prompt.
+type PromptMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// Content is an MCP content block (prompt messages, sampling messages). Text content populates Text;
+// embedded resources populate Resource; images and audio carry base64 Data.
+type Content struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+}
+
+// PromptResult is the expansion returned by prompts/get.
+type PromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// ListPrompts queries the MCP server for the prompt templates it publishes.
+func (c *Client) ListPrompts(ctx context.Context, server *discovery.ServerInfo) ([]Prompt, error) {
+	return listAll[Prompt](ctx, c, server, "prompts/list", "prompts")
+}
+
+// GetPrompt expands a prompt template with the provided arguments.
+func (c *Client) GetPrompt(ctx context.Context, server *discovery.ServerInfo, name string, arguments map[string]string) (PromptResult, error) {
+	var result PromptResult
+	if strings.TrimSpace(name) == "" {
+		return result, fmt.Errorf("prompt name is required")
+	}
+	params := map[string]any{"name": name}
+	if len(arguments) > 0 {
+		params["arguments"] = arguments
+	}
+	if err := c.invoke(ctx, server, "prompts/get", params, &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
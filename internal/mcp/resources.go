@@ -0,0 +1,61 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// Resource describes a document, file, or record published by an MCP server.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// ResourceTemplate describes a parameterised family of resources (RFC 6570 URI template).
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents is a single item returned by resources/read. Exactly one of Text or
+// Blob (base64) is populated.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// ListResources queries the MCP server for the resources it publishes.
+func (c *Client) ListResources(ctx context.Context, server *discovery.ServerInfo) ([]Resource, error) {
+	return listAll[Resource](ctx, c, server, "resources/list", "resources")
+}
+
+// ListResourceTemplates queries the MCP server for its resource templates.
+func (c *Client) ListResourceTemplates(ctx context.Context, server *discovery.ServerInfo) ([]ResourceTemplate, error) {
+	return listAll[ResourceTemplate](ctx, c, server, "resources/templates/list", "resourceTemplates")
+}
+
+// ReadResource fetches the contents of a resource by URI.
+func (c *Client) ReadResource(ctx context.Context, server *discovery.ServerInfo, uri string) ([]ResourceContents, error) {
+	if strings.TrimSpace(uri) == "" {
+		return nil, fmt.Errorf("resource uri is required")
+	}
+	var payload struct {
+		Contents []ResourceContents `json:"contents"`
+	}
+	if err := c.invoke(ctx, server, "resources/read", map[string]any{"uri": uri}, &payload); err != nil {
+		return nil, err
+	}
+	return payload.Contents, nil
+}
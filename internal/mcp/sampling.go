@@ -0,0 +1,52 @@
+package mcp
+
+import (
+	"context"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// SamplingHandler runs sampling/createMessage requests that tool servers send back to the
+// client while one of their tools is executing.
+type SamplingHandler interface {
+	CreateMessage(ctx context.Context, server *discovery.ServerInfo, req SamplingRequest) (SamplingResult, error)
+}
+
+// SamplingRequest mirrors the MCP sampling/createMessage parameters.
+type SamplingRequest struct {
+	Messages         []SamplingMessage `json:"messages"`
+	SystemPrompt     string            `json:"systemPrompt,omitempty"`
+	MaxTokens        int               `json:"maxTokens"`
+	Temperature      *float64          `json:"temperature,omitempty"`
+	StopSequences    []string          `json:"stopSequences,omitempty"`
+	ModelPreferences *ModelPreferences `json:"modelPreferences,omitempty"`
+	IncludeContext   string            `json:"includeContext,omitempty"`
+	Metadata         map[string]any    `json:"metadata,omitempty"`
+}
+
+// SamplingMessage is one conversation turn submitted for sampling.
+type SamplingMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// ModelPreferences carries the server's hints about which model should serve a request.
+type ModelPreferences struct {
+	Hints                []ModelHint `json:"hints,omitempty"`
+	CostPriority         *float64    `json:"costPriority,omitempty"`
+	SpeedPriority        *float64    `json:"speedPriority,omitempty"`
+	IntelligencePriority *float64    `json:"intelligencePriority,omitempty"`
+}
+
+// ModelHint names a preferred model (or model family) for sampling.
+type ModelHint struct {
+	Name string `json:"name"`
+}
+
+// SamplingResult is returned to the server as the sampling/createMessage result.
+type SamplingResult struct {
+	Role       string  `json:"role"`
+	Content    Content `json:"content"`
+	Model      string  `json:"model"`
+	StopReason string  `json:"stopReason,omitempty"`
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mcpwrapper/internal/mcp"
+)
+
+const jsonRPCVersion = "2.0"
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+func (r rpcRequest) isNotification() bool {
+	return len(r.ID) == 0 || string(r.ID) == "null"
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *mcp.RPCError   `json:"error,omitempty"`
+}
+
+// rpcSession is a JSON-RPC session opened by initialize.
+type rpcSession struct {
+	inflight *mcp.Inflight
+	lastUsed time.Time
+	// streams counts the open GET notification streams.
+	streams int
+}
+
+type callParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	Meta      *mcp.CallMeta   `json:"_meta,omitempty"`
+}
+
+// handleRPC serves the JSON-RPC dialect. Each POST carries one message; tools/call answers
+// as an event stream when the client sent a progress token and accepts one.
+func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeRPCError(w, nil, mcp.CodeParseError, err.Error())
+		return
+	}
+	if req.JSONRPC != jsonRPCVersion || req.Method == "" {
+		// Responses to server-initiated requests are not used by this server.
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if req.Method == "initialize" {
+		s.handleInitialize(w, req)
+		return
+	}
+
+	sessionID := r.Header.Get(mcp.SessionHeader)
+	inflight, ok := s.session(sessionID)
+	if !ok {
+		http.Error(w, "unknown or expired session", http.StatusNotFound)
+		return
+	}
+	// A long call counts as activity until it ends.
+	defer s.session(sessionID)
+	w.Header().Set(mcp.SessionHeader, sessionID)
+
+	switch req.Method {
+	case "notifications/initialized":
+		w.WriteHeader(http.StatusAccepted)
+	case "notifications/cancelled":
+		var params mcp.CancelledParams
+		if err := json.Unmarshal(req.Params, &params); err == nil {
+			inflight.Cancel(params.RequestID, params.Reason)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case "ping":
+		writeRPCResult(w, req.ID, map[string]any{})
+	case "tools/list":
+		s.handleRPCList(w, req)
+	case "tools/call":
+		s.handleRPCCall(w, r, req, sessionID, inflight)
+	default:
+		if req.isNotification() {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		writeRPCError(w, req.ID, mcp.CodeMethodNotFound, fmt.Sprintf("method %q not found", req.Method))
+	}
+}
+
+func (s *Server) handleInitialize(w http.ResponseWriter, req rpcRequest) {
+	sessionID, err := newSessionID()
+	if err != nil {
+		writeRPCError(w, req.ID, mcp.CodeInternalError, err.Error())
+		return
+	}
+	now := time.Now()
+	s.sessionsMu.Lock()
+	s.expireSessions(now)
+	s.sessions[sessionID] = &rpcSession{inflight: mcp.NewInflight(), lastUsed: now}
+	s.sessionsMu.Unlock()
+
+	result := map[string]any{
+		"protocolVersion": mcp.ProtocolVersion,
+		"capabilities": map[string]any{
+			"tools": map[string]any{"listChanged": true},
+		},
+		"serverInfo": map[string]any{
+			"name":    s.opts.Name,
+			"version": s.opts.Version,
+		},
+	}
+	if s.opts.Instructions != "" {
+		result["instructions"] = s.opts.Instructions
+	}
+	w.Header().Set(mcp.SessionHeader, sessionID)
+	writeRPCResult(w, req.ID, result)
+}
+
+func (s *Server) handleEndSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get(mcp.SessionHeader)
+	s.sessionsMu.Lock()
+	_, ok := s.sessions[sessionID]
+	delete(s.sessions, sessionID)
+	s.sessionsMu.Unlock()
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRPCCall(w http.ResponseWriter, r *http.Request, req rpcRequest, sessionID string, inflight *mcp.Inflight) {
+	var params callParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		writeRPCError(w, req.ID, mcp.CodeInvalidParams, err.Error())
+		return
+	}
+	t, ok := s.lookup(params.Name)
+	if !ok {
+		writeRPCError(w, req.ID, mcp.CodeInvalidParams, fmt.Sprintf("unknown tool %q", params.Name))
+		return
+	}
+
+	call := &Call{Tool: params.Name, Arguments: params.Arguments, Session: sessionID}
+	if params.Meta != nil && len(params.Meta.ProgressToken) > 0 && mcp.AcceptsEventStream(r) {
+		call.stream, _ = mcp.NewStreamWriter(w, req.ID, params.Meta)
+	}
+
+	result, err := s.run(r.Context(), t, call, inflight, req.ID)
+	if errors.Is(err, ErrInvalidArguments) {
+		// Malformed arguments are a protocol error; anything else is reported to the
+		// model as a failed tool result.
+		if call.stream != nil {
+			_ = call.stream.Error(mcp.CodeInvalidParams, err.Error())
+			return
+		}
+		writeRPCError(w, req.ID, mcp.CodeInvalidParams, err.Error())
+		return
+	}
+	payload := callToolResult(result, err)
+	if call.stream != nil {
+		_ = call.stream.Result(payload)
+		return
+	}
+	writeRPCResult(w, req.ID, payload)
+}
+
+func (s *Server) handleRPCList(w http.ResponseWriter, req rpcRequest) {
+	var params struct {
+		Cursor string `json:"cursor"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			writeRPCError(w, req.ID, mcp.CodeInvalidParams, err.Error())
+			return
+		}
+	}
+	defs, next, err := s.page(s.definitions(), params.Cursor)
+	if err != nil {
+		writeRPCError(w, req.ID, mcp.CodeInvalidParams, err.Error())
+		return
+	}
+	result := map[string]any{"tools": rpcDefinitions(defs)}
+	if next != "" {
+		result["nextCursor"] = next
+	}
+	writeRPCResult(w, req.ID, result)
+}
+
+// rpcDefinitions renders tools in the MCP shape, with the schema under inputSchema.
+func rpcDefinitions(defs []mcp.ToolDefinition) []map[string]any {
+	out := make([]map[string]any, 0, len(defs))
+	for _, def := range defs {
+		entry := map[string]any{
+			"name":        def.Name,
+			"description": def.Description,
+			"inputSchema": def.Parameters,
+		}
+		if def.Title != "" {
+			entry["title"] = def.Title
+		}
+		if def.Annotations != nil {
+			entry["annotations"] = def.Annotations
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// session returns the calls in flight in session id, noting the session as used.
+func (s *Server) session(id string) (*mcp.Inflight, bool) {
+	if id == "" {
+		return nil, false
+	}
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	sess.lastUsed = time.Now()
+	return sess.inflight, true
+}
+
+// openStream notes a notification stream opened in session id. It reports false when
+// there is no such session. The returned func closes the stream.
+func (s *Server) openStream(id string) (func(), bool) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sess, ok := s.sessions[id]
+	if id == "" || !ok {
+		return nil, false
+	}
+	sess.streams++
+	return func() {
+		s.sessionsMu.Lock()
+		defer s.sessionsMu.Unlock()
+		sess.streams--
+		sess.lastUsed = time.Now()
+	}, true
+}
+
+// expireSessions ends the sessions idle for longer than SessionIdleTimeout. It is called
+// with sessionsMu held whenever a session is opened, which bounds their number.
+func (s *Server) expireSessions(now time.Time) {
+	for id, sess := range s.sessions {
+		if sess.streams == 0 && sess.inflight.Len() == 0 && now.Sub(sess.lastUsed) > s.opts.SessionIdleTimeout {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate session id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func writeRPCResult(w http.ResponseWriter, id json.RawMessage, result any) {
+	writeJSON(w, rpcResponse{JSONRPC: jsonRPCVersion, ID: id, Result: result}, http.StatusOK)
+}
+
+func writeRPCError(w http.ResponseWriter, id json.RawMessage, code int, message string) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	writeJSON(w, rpcResponse{JSONRPC: jsonRPCVersion, ID: id, Error: &mcp.RPCError{Code: code, Message: message}}, http.StatusOK)
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mcpwrapper/internal/mcp"
+)
+
+// keepAliveInterval spaces the comments sent on idle notification streams so proxies and
+// the client's idle watchdog do not cut them.
+const keepAliveInterval = 30 * time.Second
+
+// NotifyToolsChanged tells every connected client that the tool list changed and refreshes
+// the announced tools hash. Register and RemoveTool call it; handlers that change what an
+// existing tool does may call it directly.
+func (s *Server) NotifyToolsChanged() {
+	s.broadcast(map[string]any{"jsonrpc": jsonRPCVersion, "method": mcp.NotifyToolsListChanged})
+
+	s.announceMu.Lock()
+	defer s.announceMu.Unlock()
+	if s.announcer != nil {
+		s.announcer.SetText(s.announceText(s.announceBase))
+	}
+}
+
+// ToolsHash is a short digest of the published tool definitions. It changes whenever a
+// tool is added, removed or redefined.
+func (s *Server) ToolsHash() string {
+	data, _ := json.Marshal(s.definitions())
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// broadcast queues msg on every open notification stream. Slow subscribers miss messages
+// rather than blocking the sender; a missed list_changed is repaired by the next one or by
+// the client's cache expiry.
+func (s *Server) broadcast(msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+	for ch := range s.streams {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+// handleNotifications serves GET /notifications for legacy clients.
+func (s *Server) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	s.serveStream(w, r)
+}
+
+// handleRPCStream serves GET on the JSON-RPC endpoint, the spec's standalone stream for
+// server-initiated messages. It requires a live session.
+func (s *Server) handleRPCStream(w http.ResponseWriter, r *http.Request) {
+	if !mcp.AcceptsEventStream(r) {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	sessionID := r.Header.Get(mcp.SessionHeader)
+	closeStream, ok := s.openStream(sessionID)
+	if !ok {
+		http.Error(w, "unknown or expired session", http.StatusNotFound)
+		return
+	}
+	defer closeStream()
+	w.Header().Set(mcp.SessionHeader, sessionID)
+	s.serveStream(w, r)
+}
+
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan []byte, 16)
+	s.streamsMu.Lock()
+	if s.streamsClosed {
+		s.streamsMu.Unlock()
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	s.streams[ch] = struct{}{}
+	s.streamsMu.Unlock()
+	defer func() {
+		s.streamsMu.Lock()
+		if _, ok := s.streams[ch]; ok {
+			delete(s.streams, ch)
+			close(ch)
+		}
+		s.streamsMu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// closeStreams ends every notification stream so a graceful shutdown need not wait for
+// clients to hang up.
+func (s *Server) closeStreams() {
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+	s.streamsClosed = true
+	for ch := range s.streams {
+		delete(s.streams, ch)
+		close(ch)
+	}
+}
+
+// page cuts defs to the page selected by cursor when Options.PageSize is set, returning
+// the cursor of the next page or "" on the last one. Cursors are opaque to clients.
+func (s *Server) page(defs []mcp.ToolDefinition, cursor string) ([]mcp.ToolDefinition, string, error) {
+	offset := 0
+	if cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor")
+		}
+		offset, err = strconv.Atoi(string(raw))
+		if err != nil || offset < 0 || offset > len(defs) {
+			return nil, "", fmt.Errorf("invalid cursor")
+		}
+	}
+	if s.opts.PageSize <= 0 {
+		return defs[offset:], "", nil
+	}
+	end := min(offset+s.opts.PageSize, len(defs))
+	next := ""
+	if end < len(defs) {
+		next = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	return defs[offset:end], next, nil
+}
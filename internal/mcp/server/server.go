@@ -0,0 +1,292 @@
+// Package server implements the serving side of MCP over HTTP. A Server hosts registered
+// tools on both wire dialects the client understands: the legacy REST endpoints
+// (GET /tools/list, POST /tools/call) and JSON-RPC on /mcp. It also takes care of request
+// logging, progress streaming, cancellation, list_changed notifications, mDNS announcement
+// and graceful shutdown.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/charmbracelet/log"
+
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mcp"
+)
+
+// Options configure a Server.
+type Options struct {
+	// Name identifies the server in the initialize handshake and in logs.
+	Name    string
+	Version string
+	// Instructions are returned to JSON-RPC clients during initialize.
+	Instructions string
+	// Port to listen on. Zero picks a free port.
+	Port   int
+	Logger *log.Logger
+	// Announce, when set, advertises the server over mDNS once it is listening. Port and
+	// the protocol TXT keys are filled in by the server.
+	Announce *discovery.AnnounceOptions
+	// ShutdownTimeout bounds how long Run waits for in-flight calls after its context
+	// ends. Defaults to 5s.
+	ShutdownTimeout time.Duration
+	// PageSize, when positive, splits tools/list into pages of this many tools linked by
+	// nextCursor. Zero returns every tool at once.
+	PageSize int
+	// SessionIdleTimeout ends a JSON-RPC session after this long without a request, once
+	// it has no call in flight and no notification stream open. Clients seldom end their
+	// sessions themselves. Defaults to 30m.
+	SessionIdleTimeout time.Duration
+}
+
+// Server hosts MCP tools over HTTP.
+type Server struct {
+	opts   Options
+	logger *log.Logger
+	mux    *http.ServeMux
+
+	mu    sync.RWMutex
+	tools map[string]*tool
+
+	legacy *mcp.Inflight
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*rpcSession
+
+	streamsMu     sync.Mutex
+	streams       map[chan []byte]struct{}
+	streamsClosed bool
+
+	announceMu     sync.Mutex
+	announcer      *discovery.Announcer
+	announceBase   map[string]string
+	announceStatus map[string]string
+}
+
+// New returns a server with the standard MCP routes registered and no tools.
+func New(opts Options) *Server {
+	if opts.Name == "" {
+		opts.Name = "mcp-server"
+	}
+	if opts.Version == "" {
+		opts.Version = "dev"
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 5 * time.Second
+	}
+	if opts.SessionIdleTimeout <= 0 {
+		opts.SessionIdleTimeout = 30 * time.Minute
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	s := &Server{
+		opts:     opts,
+		logger:   logger,
+		mux:      http.NewServeMux(),
+		tools:    make(map[string]*tool),
+		legacy:   mcp.NewInflight(),
+		sessions: make(map[string]*rpcSession),
+		streams:  make(map[chan []byte]struct{}),
+	}
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /tools/list", s.handleListTools)
+	s.mux.HandleFunc("POST /tools/call", s.handleCallTool)
+	s.mux.HandleFunc("POST /notifications/cancelled", s.legacy.HandleCancelled)
+	s.mux.HandleFunc("GET /notifications", s.handleNotifications)
+	s.mux.HandleFunc("POST "+mcp.DefaultRPCPath, s.handleRPC)
+	s.mux.HandleFunc("GET "+mcp.DefaultRPCPath, s.handleRPCStream)
+	s.mux.HandleFunc("DELETE "+mcp.DefaultRPCPath, s.handleEndSession)
+	return s
+}
+
+// HandleFunc registers an additional route alongside the MCP endpoints.
+func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Handler returns the server's routes wrapped in request logging, for embedding in another
+// http.Server or an httptest.Server.
+func (s *Server) Handler() http.Handler {
+	return loggingMiddleware(s.logger, s.mux)
+}
+
+// ToolNames lists the registered tools in name order.
+func (s *Server) ToolNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.tools))
+	for name := range s.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run listens on the configured port, announces the server when requested, and serves
+// until ctx ends. It then withdraws the announcement before draining in-flight calls.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.opts.Port))
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve is like Run but uses an existing listener.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	httpServer := &http.Server{Handler: s.Handler()}
+	httpServer.RegisterOnShutdown(s.closeStreams)
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	var announcer *discovery.Announcer
+	if s.opts.Announce != nil {
+		opts := *s.opts.Announce
+		opts.Port = port
+		s.announceMu.Lock()
+		opts.Text = s.announceText(opts.Text)
+		var err error
+		announcer, err = discovery.NewAnnouncer(opts)
+		if err != nil {
+			s.announceMu.Unlock()
+			listener.Close()
+			return fmt.Errorf("announce: %w", err)
+		}
+		s.announcer = announcer
+		s.announceBase = s.opts.Announce.Text
+		s.announceMu.Unlock()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		s.withdraw()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			s.logger.Warn("mcp server shutdown error", "error", err)
+			_ = httpServer.Close()
+		}
+	}()
+
+	s.logger.Info("mcp server listening",
+		"addr", listener.Addr().String(),
+		"tools", s.ToolNames(),
+		"advertise", announcer != nil,
+	)
+	err := httpServer.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-done
+		return nil
+	}
+	s.withdraw()
+	return err
+}
+
+// withdraw stops the mDNS announcement, if any.
+func (s *Server) withdraw() {
+	s.announceMu.Lock()
+	defer s.announceMu.Unlock()
+	if s.announcer != nil {
+		s.announcer.Stop()
+		s.announcer = nil
+	}
+}
+
+// UpdateAnnouncement merges text into the announced TXT record and re-announces it when a
+// value changed, without dropping the service. Keys set this way are kept when the tool
+// list changes, which suits status such as load or readiness. Before Run they are merged
+// into the initial announcement.
+func (s *Server) UpdateAnnouncement(text map[string]string) {
+	s.announceMu.Lock()
+	defer s.announceMu.Unlock()
+	if s.announceStatus == nil {
+		s.announceStatus = make(map[string]string, len(text))
+	}
+	for k, v := range text {
+		s.announceStatus[k] = v
+	}
+	if s.announcer != nil {
+		s.announcer.Update(text)
+	}
+}
+
+// announceText adds the status set with UpdateAnnouncement, the keys clients use to pick
+// the JSON-RPC dialect and the current tools hash. s.announceMu must be held.
+func (s *Server) announceText(text map[string]string) map[string]string {
+	out := make(map[string]string, len(text)+len(s.announceStatus)+3)
+	for k, v := range text {
+		out[k] = v
+	}
+	for k, v := range s.announceStatus {
+		out[k] = v
+	}
+	if _, ok := out["protocol"]; !ok {
+		out["protocol"] = mcp.DialectJSONRPC
+	}
+	if _, ok := out["path"]; !ok {
+		out["path"] = mcp.DefaultRPCPath
+	}
+	out[mcp.ToolsHashKey] = s.ToolsHash()
+	return out
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+func writeJSON(w http.ResponseWriter, payload any, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, map[string]any{
+		"error": map[string]any{
+			"message": err.Error(),
+			"code":    status,
+		},
+	}, status)
+}
+
+func loggingMiddleware(logger *log.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logger.Debug("request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streamed tool responses pass through the middleware.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
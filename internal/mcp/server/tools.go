@@ -0,0 +1,315 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mcpwrapper/internal/mcp"
+)
+
+// Tool describes a tool as published in tools/list.
+type Tool struct {
+	Name        string
+	Title       string
+	Description string
+	// Parameters is the JSON schema of the tool's arguments. Top-level `required` keys
+	// are checked before the handler runs.
+	Parameters  map[string]any
+	Annotations *mcp.ToolAnnotations
+}
+
+// Handler runs a tool call. The returned value becomes the call's result and must
+// marshal to JSON.
+type Handler func(ctx context.Context, call *Call) (any, error)
+
+// Call is a single tool invocation.
+type Call struct {
+	Tool      string
+	Arguments json.RawMessage
+	// Session is the JSON-RPC session id; empty for legacy-dialect calls.
+	Session string
+
+	stream *mcp.StreamWriter
+}
+
+// Streaming reports whether the caller asked for progress, i.e. whether Progress and
+// Partial reach anyone.
+func (c *Call) Streaming() bool {
+	return c.stream != nil
+}
+
+// Progress reports how far the call has got. It is a no-op unless Streaming.
+func (c *Call) Progress(progress, total float64, message string) {
+	if c.stream != nil {
+		_ = c.stream.Progress(progress, total, message)
+	}
+}
+
+// Partial relays a chunk of incremental output. It is a no-op unless Streaming.
+func (c *Call) Partial(progress float64, text string) {
+	if c.stream != nil {
+		_ = c.stream.Partial(progress, text)
+	}
+}
+
+// Bind decodes the call's arguments into v.
+func (c *Call) Bind(v any) error {
+	if len(c.Arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(c.Arguments, v); err != nil {
+		return InvalidArguments(err)
+	}
+	return nil
+}
+
+// Error lets a handler choose the HTTP status returned to legacy clients.
+type Error struct {
+	Status int
+	Err    error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrInvalidArguments marks argument decoding and validation failures.
+var ErrInvalidArguments = errors.New("invalid arguments")
+
+// InvalidArguments wraps err as a 400 / JSON-RPC invalid-params failure.
+func InvalidArguments(err error) error {
+	return &Error{Status: http.StatusBadRequest, Err: fmt.Errorf("%w: %v", ErrInvalidArguments, err)}
+}
+
+type tool struct {
+	def     Tool
+	handler Handler
+}
+
+// Register adds a tool with an untyped handler, replacing any tool of the same name.
+// Connected clients are notified that the tool list changed.
+func (s *Server) Register(def Tool, handler Handler) {
+	if def.Parameters == nil {
+		def.Parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	s.mu.Lock()
+	s.tools[def.Name] = &tool{def: def, handler: handler}
+	s.mu.Unlock()
+	s.NotifyToolsChanged()
+}
+
+// RemoveTool unregisters a tool and notifies connected clients. It reports whether the
+// tool existed.
+func (s *Server) RemoveTool(name string) bool {
+	s.mu.Lock()
+	_, ok := s.tools[name]
+	delete(s.tools, name)
+	s.mu.Unlock()
+	if ok {
+		s.NotifyToolsChanged()
+	}
+	return ok
+}
+
+// AddTool registers a tool whose arguments are decoded into In before fn runs.
+func AddTool[In any](s *Server, def Tool, fn func(ctx context.Context, call *Call, in In) (any, error)) {
+	s.Register(def, func(ctx context.Context, call *Call) (any, error) {
+		var in In
+		if err := call.Bind(&in); err != nil {
+			return nil, err
+		}
+		return fn(ctx, call, in)
+	})
+}
+
+func (s *Server) lookup(name string) (*tool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tools[name]
+	return t, ok
+}
+
+func (s *Server) definitions() []mcp.ToolDefinition {
+	names := s.ToolNames()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	defs := make([]mcp.ToolDefinition, 0, len(names))
+	for _, name := range names {
+		t := s.tools[name]
+		defs = append(defs, mcp.ToolDefinition{
+			Name:        t.def.Name,
+			Title:       t.def.Title,
+			Description: t.def.Description,
+			Parameters:  t.def.Parameters,
+			Annotations: t.def.Annotations,
+		})
+	}
+	return defs
+}
+
+// run validates arguments and invokes the tool under inflight tracking, logging the outcome.
+func (s *Server) run(ctx context.Context, t *tool, call *Call, inflight *mcp.Inflight, id json.RawMessage) (any, error) {
+	if err := checkRequired(t.def.Parameters, call.Arguments); err != nil {
+		return nil, err
+	}
+	ctx, release := inflight.Track(ctx, id)
+	defer release()
+
+	start := time.Now()
+	result, err := t.handler(ctx, call)
+	fields := []any{
+		"tool", call.Tool,
+		"streamed", call.Streaming(),
+		"duration_ms", time.Since(start).Milliseconds(),
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		s.logger.Info("tool invocation cancelled", append(fields, "reason", context.Cause(ctx))...)
+	case err != nil:
+		s.logger.Warn("tool invocation failed", append(fields, "error", err)...)
+	default:
+		s.logger.Info("tool invocation complete", fields...)
+	}
+	return result, err
+}
+
+// checkRequired enforces the schema's top-level required list.
+func checkRequired(schema map[string]any, raw json.RawMessage) error {
+	var required []string
+	switch v := schema["required"].(type) {
+	case []string:
+		required = v
+	case []any:
+		for _, item := range v {
+			if name, ok := item.(string); ok {
+				required = append(required, name)
+			}
+		}
+	}
+	if len(required) == 0 {
+		return nil
+	}
+	var args map[string]json.RawMessage
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return InvalidArguments(err)
+		}
+	}
+	for _, name := range required {
+		value, ok := args[name]
+		if !ok || string(value) == "null" || string(value) == `""` {
+			return InvalidArguments(fmt.Errorf("missing %s", name))
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleListTools(w http.ResponseWriter, r *http.Request) {
+	defs, next, err := s.page(s.definitions(), r.URL.Query().Get("cursor"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload := map[string]any{"tools": defs}
+	if next != "" {
+		payload["nextCursor"] = next
+	}
+	writeJSON(w, payload, http.StatusOK)
+}
+
+// legacyCallRequest is the body of POST /tools/call.
+type legacyCallRequest struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	Meta      *mcp.CallMeta   `json:"_meta,omitempty"`
+}
+
+func (s *Server) handleCallTool(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	var req legacyCallRequest
+	if err := json.NewDecoder(io.TeeReader(r.Body, &buf)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	t, ok := s.lookup(req.Name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("tool %q not found", req.Name))
+		return
+	}
+
+	call := &Call{Tool: req.Name, Arguments: req.Arguments}
+	if len(call.Arguments) == 0 || string(call.Arguments) == "null" {
+		// Some callers post the arguments at the top level next to the tool name.
+		call.Arguments = json.RawMessage(buf.Bytes())
+	}
+	id := mcp.LegacyRequestID(r)
+	if req.Meta != nil && len(req.Meta.ProgressToken) > 0 && mcp.AcceptsEventStream(r) {
+		call.stream, _ = mcp.NewStreamWriter(w, id, req.Meta)
+	}
+
+	result, err := s.run(r.Context(), t, call, s.legacy, id)
+	if err != nil {
+		if call.stream != nil {
+			_ = call.stream.Error(rpcCode(err), err.Error())
+			return
+		}
+		writeError(w, legacyStatus(err), err)
+		return
+	}
+
+	payload := map[string]any{
+		"tool":   req.Name,
+		"result": result,
+	}
+	if call.stream != nil {
+		_ = call.stream.Result(payload)
+		return
+	}
+	writeJSON(w, payload, http.StatusOK)
+}
+
+func legacyStatus(err error) int {
+	var e *Error
+	if errors.As(err, &e) && e.Status != 0 {
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+func rpcCode(err error) int {
+	if errors.Is(err, ErrInvalidArguments) {
+		return mcp.CodeInvalidParams
+	}
+	return mcp.CodeInternalError
+}
+
+// callToolResult renders a handler's output as an MCP CallToolResult. Object results are
+// also sent as structuredContent, which the client prefers over the text rendering.
+func callToolResult(result any, err error) map[string]any {
+	if err != nil {
+		return map[string]any{
+			"content": []map[string]any{{"type": "text", "text": err.Error()}},
+			"isError": true,
+		}
+	}
+	data, merr := json.Marshal(result)
+	if merr != nil {
+		return callToolResult(nil, fmt.Errorf("encode result: %w", merr))
+	}
+	out := map[string]any{
+		"content": []map[string]any{{"type": "text", "text": string(data)}},
+	}
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		out["structuredContent"] = json.RawMessage(data)
+	} else {
+		out["structuredContent"] = map[string]json.RawMessage{"result": data}
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package mcp_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/charmbracelet/log"
+
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mcp"
+	"go.mcpwrapper/internal/mcp/server"
+)
+
+// restartable serves a JSON-RPC tool server that can be swapped for a fresh one, which
+// knows none of the old one's sessions.
+type restartable struct {
+	http    *httptest.Server
+	current atomic.Pointer[server.Server]
+	calls   atomic.Int32
+	// expired counts the requests answered 404 for an unknown session.
+	expired atomic.Int32
+	idle    time.Duration
+}
+
+func newRestartable(t *testing.T, idle time.Duration) *restartable {
+	t.Helper()
+	r := &restartable{idle: idle}
+	r.restart()
+	r.http = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		r.current.Load().Handler().ServeHTTP(rec, req)
+		if rec.status == http.StatusNotFound {
+			r.expired.Add(1)
+		}
+	}))
+	t.Cleanup(r.http.Close)
+	return r
+}
+
+func (r *restartable) restart() {
+	srv := server.New(server.Options{Name: "tools", Logger: log.New(io.Discard), SessionIdleTimeout: r.idle})
+	srv.Register(server.Tool{Name: "echo"}, func(ctx context.Context, call *server.Call) (any, error) {
+		r.calls.Add(1)
+		return map[string]any{"ok": true}, nil
+	})
+	r.current.Store(srv)
+}
+
+func (r *restartable) info() *discovery.ServerInfo {
+	host, portText, _ := net.SplitHostPort(r.http.Listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	return &discovery.ServerInfo{
+		Instance: "tools",
+		Host:     host,
+		Port:     port,
+		Address:  r.http.Listener.Addr().String(),
+		Text:     map[string]string{"protocol": mcp.DialectJSONRPC, "path": mcp.DefaultRPCPath},
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func TestCallStartsNewSessionAfterExpiry(t *testing.T) {
+	const idle = 50 * time.Millisecond
+	tests := []struct {
+		name string
+		// lose makes the server forget the client's session.
+		lose func(t *testing.T, r *restartable)
+	}{
+		{
+			name: "server restarted",
+			lose: func(t *testing.T, r *restartable) { r.restart() },
+		},
+		{
+			name: "session idled out",
+			lose: func(t *testing.T, r *restartable) {
+				time.Sleep(2 * idle)
+				// Idle sessions are swept when another client initializes.
+				other := mcp.NewClient(mcp.Options{Timeout: time.Second})
+				if _, err := other.CallTool(context.Background(), r.info(), "echo", nil); err != nil {
+					t.Fatalf("other client: %v", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRestartable(t, idle)
+			client := mcp.NewClient(mcp.Options{Timeout: time.Second})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if _, err := client.CallTool(ctx, r.info(), "echo", nil); err != nil {
+				t.Fatalf("first call: %v", err)
+			}
+			tt.lose(t, r)
+			before := r.calls.Load()
+			if _, err := client.CallTool(ctx, r.info(), "echo", nil); err != nil {
+				t.Fatalf("call after the session was lost: %v", err)
+			}
+			if got := r.calls.Load() - before; got != 1 {
+				t.Errorf("tool ran %d times after the session was lost, want 1", got)
+			}
+			if got := r.expired.Load(); got != 1 {
+				t.Errorf("%d requests hit an unknown session, want 1", got)
+			}
+			// The new session is kept for later calls.
+			if _, err := client.CallTool(ctx, r.info(), "echo", nil); err != nil {
+				t.Fatalf("call in the new session: %v", err)
+			}
+			if got := r.expired.Load(); got != 1 {
+				t.Errorf("%d requests hit an unknown session after the retry, want 1", got)
+			}
+		})
+	}
+}
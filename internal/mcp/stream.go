@@ -0,0 +1,139 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CallMeta is the `_meta` object a client attaches to tools/call.
+type CallMeta struct {
+	ProgressToken json.RawMessage `json:"progressToken,omitempty"`
+}
+
+// StreamWriter lets a tool server answer a call as a text/event-stream of JSON-RPC
+// messages: progress notifications and partial output first, then the final response.
+type StreamWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	id      json.RawMessage
+	token   json.RawMessage
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// AcceptsEventStream reports whether the client advertised support for streamed responses.
+func AcceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// LegacyRequestID returns the JSON-RPC id a legacy-dialect client expects on the final
+// streamed message, taken from the Mcp-Request-Id header.
+func LegacyRequestID(r *http.Request) json.RawMessage {
+	value := strings.TrimSpace(r.Header.Get(requestIDHeader))
+	if value == "" {
+		return nil
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return json.RawMessage(value)
+	}
+	data, _ := json.Marshal(value)
+	return data
+}
+
+// NewStreamWriter starts an event-stream response for the request identified by id.
+// It returns false when the ResponseWriter cannot flush, in which case the caller should
+// fall back to a plain JSON response.
+func NewStreamWriter(w http.ResponseWriter, id json.RawMessage, meta *CallMeta) (*StreamWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	s := &StreamWriter{w: w, flusher: flusher, id: id}
+	if meta != nil {
+		s.token = meta.ProgressToken
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return s, true
+}
+
+// HasProgressToken reports whether the client asked for progress notifications.
+func (s *StreamWriter) HasProgressToken() bool {
+	return len(s.token) > 0
+}
+
+// Progress emits notifications/progress. It is a no-op when the client supplied no token.
+func (s *StreamWriter) Progress(progress, total float64, message string) error {
+	return s.progress(progress, total, message, "")
+}
+
+// Partial emits a chunk of incremental tool output as a progress notification.
+func (s *StreamWriter) Partial(progress float64, text string) error {
+	return s.progress(progress, 0, "", text)
+}
+
+func (s *StreamWriter) progress(progress, total float64, message, partial string) error {
+	if !s.HasProgressToken() {
+		return nil
+	}
+	return s.Send(map[string]any{
+		"jsonrpc": jsonRPCVersion,
+		"method":  "notifications/progress",
+		"params": progressParams{
+			ProgressToken: s.token,
+			Progress:      progress,
+			Total:         total,
+			Message:       message,
+			Partial:       partial,
+		},
+	})
+}
+
+// Result writes the final successful response and closes the stream.
+func (s *StreamWriter) Result(result any) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return s.Error(CodeInternalError, err.Error())
+	}
+	err = s.Send(rpcResponse{JSONRPC: jsonRPCVersion, ID: s.id, Result: data})
+	s.close()
+	return err
+}
+
+// Error writes a final JSON-RPC error and closes the stream.
+func (s *StreamWriter) Error(code int, message string) error {
+	err := s.Send(rpcResponse{JSONRPC: jsonRPCVersion, ID: s.id, Error: &RPCError{Code: code, Message: message}})
+	s.close()
+	return err
+}
+
+// Send writes an arbitrary JSON-RPC message as one event.
+func (s *StreamWriter) Send(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode stream message: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("stream closed")
+	}
+	if _, err := fmt.Fprintf(s.w, "event: message\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *StreamWriter) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
@@ -0,0 +1,605 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.mcpwrapper/internal/discovery"
+)
+
+// Dialects understood by the client. Servers advertise theirs with the `protocol` TXT key;
+// anything other than JSON-RPC falls back to the legacy REST-style endpoints.
+const (
+	DialectLegacy  = "legacy"
+	DialectJSONRPC = "jsonrpc"
+)
+
+// ProtocolVersion is the MCP revision negotiated during the JSON-RPC initialize handshake.
+const ProtocolVersion = "2025-06-18"
+
+// Wire constants shared by the client and the server package.
+const (
+	DefaultRPCPath = "/mcp"
+	SessionHeader  = "Mcp-Session-Id"
+	ProtocolHeader = "Mcp-Protocol-Version"
+)
+
+const (
+	legacyMessagesPath = "/messages"
+	requestIDHeader    = "Mcp-Request-Id"
+	jsonRPCVersion     = "2.0"
+	maxErrorBodyLen    = 2048
+)
+
+// JSON-RPC error codes used by MCP servers.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeSamplingRejected is returned when the client declines a sampling request.
+	CodeSamplingRejected = -1
+)
+
+// errSessionExpired is returned for a request whose session the server does not know.
+var errSessionExpired = errors.New("session expired")
+
+// ErrUnsupported indicates that the server does not implement the requested MCP method.
+var ErrUnsupported = errors.New("method not supported by server")
+
+// RPCError is the error object carried by JSON-RPC responses.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// Is lets errors.Is(err, ErrUnsupported) match method-not-found responses.
+func (e *RPCError) Is(target error) bool {
+	return target == ErrUnsupported && e.Code == CodeMethodNotFound
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      any    `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// rpcMessage is any JSON-RPC message seen on a stream: request, notification, or response.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+func (m rpcMessage) hasID() bool {
+	return len(m.ID) > 0 && string(m.ID) != "null"
+}
+
+type session struct {
+	once         sync.Once
+	err          error
+	id           string
+	capabilities map[string]any
+}
+
+// Dialect reports which wire dialect the client will use for the server.
+func Dialect(server *discovery.ServerInfo) string {
+	if server == nil {
+		return DialectLegacy
+	}
+	switch strings.ToLower(strings.TrimSpace(server.Text["protocol"])) {
+	case DialectJSONRPC, "mcp", "json-rpc":
+		return DialectJSONRPC
+	default:
+		return DialectLegacy
+	}
+}
+
+// invoke performs an MCP method call against the server using its advertised dialect and
+// decodes the result into out (which may be nil).
+func (c *Client) invoke(ctx context.Context, server *discovery.ServerInfo, method string, params map[string]any, out any) error {
+	if server == nil {
+		return fmt.Errorf("nil server")
+	}
+	ctx, stop := c.withWatchdog(ctx)
+	defer stop()
+
+	var err error
+	if Dialect(server) == DialectJSONRPC {
+		err = c.invokeJSONRPC(ctx, server, method, params, out)
+	} else {
+		err = c.invokeLegacy(ctx, server, method, params, out)
+	}
+	return causeOf(ctx, err)
+}
+
+// invokeLegacy maps an MCP method onto the REST-style endpoints: list methods become
+// GET /<method>, everything else POSTs the params as the JSON body.
+func (c *Client) invokeLegacy(ctx context.Context, server *discovery.ServerInfo, method string, params map[string]any, out any) error {
+	endpoint, err := buildURL(server, "/"+method)
+	if err != nil {
+		return err
+	}
+
+	httpMethod := http.MethodPost
+	var body io.Reader
+	if strings.HasSuffix(method, "/list") {
+		httpMethod = http.MethodGet
+	} else {
+		if params == nil {
+			params = map[string]any{}
+		}
+		buf, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, httpMethod, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	requestID := c.legacyCallID()
+	cancellable := body != nil && !strings.HasPrefix(method, "notifications/")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+	}
+	if cancellable {
+		req.Header.Set(requestIDHeader, requestID)
+		defer func() {
+			if ctx.Err() != nil {
+				c.notifyCancelled(server, "", requestID, context.Cause(ctx))
+			}
+		}()
+	}
+	if httpMethod == http.MethodGet && len(params) > 0 {
+		query := req.URL.Query()
+		for k, v := range params {
+			query.Set(k, fmt.Sprint(v))
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+
+	resp, err := c.do(server, req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLen))
+		text := strings.TrimSpace(string(data))
+		if isMissingRoute(resp.StatusCode, text) {
+			return fmt.Errorf("%s: %w", method, ErrUnsupported)
+		}
+		return fmt.Errorf("%s failed: %s (%s)", method, resp.Status, text)
+	}
+
+	if isEventStream(resp) {
+		final, err := c.readStream(ctx, server, "", resp.Body, requestID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		if final.Error != nil {
+			return fmt.Errorf("%s: %w", method, final.Error)
+		}
+		if out == nil || len(final.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(final.Result, out); err != nil {
+			return fmt.Errorf("decode %s: %w", method, err)
+		}
+		return nil
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", method, err)
+	}
+	return nil
+}
+
+// invokeJSONRPC sends a JSON-RPC request to the server's MCP endpoint, performing the
+// initialize handshake on first use.
+func (c *Client) invokeJSONRPC(ctx context.Context, server *discovery.ServerInfo, method string, params map[string]any, out any) error {
+	sess, err := c.session(ctx, server)
+	if err != nil {
+		return err
+	}
+	result, err := c.roundTrip(ctx, server, sess, method, params)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(result, out); err != nil {
+		return fmt.Errorf("decode %s: %w", method, err)
+	}
+	return nil
+}
+
+func (c *Client) session(ctx context.Context, server *discovery.ServerInfo) (*session, error) {
+	key := sessionKey(server)
+	c.sessionsMu.Lock()
+	sess, ok := c.sessions[key]
+	if !ok {
+		sess = &session{}
+		c.sessions[key] = sess
+	}
+	c.sessionsMu.Unlock()
+
+	sess.once.Do(func() {
+		sess.err = c.initialize(ctx, server, sess)
+	})
+	if sess.err != nil {
+		c.sessionsMu.Lock()
+		if c.sessions[key] == sess {
+			delete(c.sessions, key)
+		}
+		c.sessionsMu.Unlock()
+		return nil, sess.err
+	}
+	return sess, nil
+}
+
+func (c *Client) initialize(ctx context.Context, server *discovery.ServerInfo, sess *session) error {
+	params := map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    c.clientCapabilities(),
+		"clientInfo": map[string]any{
+			"name":    "go.mcpwrapper",
+			"version": "1.0.0",
+		},
+	}
+	resp, sessionID, err := c.post(ctx, server, "", rpcRequest{
+		JSONRPC: jsonRPCVersion,
+		ID:      c.nextID(),
+		Method:  "initialize",
+		Params:  params,
+	})
+	if err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("initialize: %w", resp.Error)
+	}
+	var result struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	if len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, &result); err != nil {
+			return fmt.Errorf("decode initialize: %w", err)
+		}
+	}
+	sess.id = sessionID
+	sess.capabilities = result.Capabilities
+
+	_, _, err = c.post(ctx, server, sess.id, rpcRequest{
+		JSONRPC: jsonRPCVersion,
+		Method:  "notifications/initialized",
+	})
+	if err != nil {
+		return fmt.Errorf("initialized notification: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) clientCapabilities() map[string]any {
+	capabilities := map[string]any{}
+	if c.sampling != nil {
+		capabilities["sampling"] = map[string]any{}
+	}
+	return capabilities
+}
+
+// roundTrip sends one request in sess. When the server no longer knows the session,
+// because it restarted or let the session idle out, a new session is started and the
+// request is sent once more, as the Streamable HTTP transport prescribes.
+func (c *Client) roundTrip(ctx context.Context, server *discovery.ServerInfo, sess *session, method string, params map[string]any) (json.RawMessage, error) {
+	id := c.nextID()
+	req := rpcRequest{
+		JSONRPC: jsonRPCVersion,
+		ID:      id,
+		Method:  method,
+	}
+	if params != nil {
+		req.Params = params
+	}
+	resp, _, err := c.post(ctx, server, sess.id, req)
+	if errors.Is(err, errSessionExpired) {
+		c.dropSession(server, sess)
+		if sess, err = c.session(ctx, server); err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+		resp, _, err = c.post(ctx, server, sess.id, req)
+		if errors.Is(err, errSessionExpired) {
+			c.dropSession(server, sess)
+		}
+	}
+	if ctx.Err() != nil && method != "initialize" {
+		// The spec forbids cancelling initialize; anything else is abandoned server-side too.
+		c.notifyCancelled(server, sess.id, id, context.Cause(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("%s: %w", method, resp.Error)
+	}
+	return resp.Result, nil
+}
+
+// post delivers a single JSON-RPC message and returns the response (empty for notifications)
+// along with the session identifier assigned by the server.
+func (c *Client) post(ctx context.Context, server *discovery.ServerInfo, sessionID string, msg rpcRequest) (rpcResponse, string, error) {
+	var resp rpcResponse
+	endpoint, err := buildURL(server, rpcPath(server))
+	if err != nil {
+		return resp, "", err
+	}
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return resp, "", fmt.Errorf("encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(buf))
+	if err != nil {
+		return resp, "", fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set(ProtocolHeader, ProtocolVersion)
+	if sessionID != "" {
+		req.Header.Set(SessionHeader, sessionID)
+	}
+
+	httpResp, err := c.do(server, req)
+	if err != nil {
+		return resp, "", err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode == http.StatusAccepted || httpResp.StatusCode == http.StatusNoContent {
+		return resp, httpResp.Header.Get(SessionHeader), nil
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(httpResp.Body, maxErrorBodyLen))
+		err := fmt.Errorf("%s (%s)", httpResp.Status, strings.TrimSpace(string(data)))
+		if httpResp.StatusCode == http.StatusNotFound && sessionID != "" {
+			err = fmt.Errorf("%w: %w", errSessionExpired, err)
+		}
+		return resp, "", err
+	}
+	if id := httpResp.Header.Get(SessionHeader); id != "" {
+		sessionID = id
+	}
+	if isEventStream(httpResp) {
+		requestID, _ := msg.ID.(int64)
+		resp, err = c.readStream(ctx, server, sessionID, httpResp.Body, strconv.FormatInt(requestID, 10))
+		return resp, sessionID, err
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return resp, "", fmt.Errorf("decode response: %w", err)
+	}
+	return resp, sessionID, nil
+}
+
+// readStream consumes an SSE body of JSON-RPC messages until the response to requestID
+// arrives, answering server-initiated requests (sampling, ping) along the way.
+func (c *Client) readStream(ctx context.Context, server *discovery.ServerInfo, sessionID string, body io.Reader, requestID string) (rpcResponse, error) {
+	var final rpcResponse
+	found := false
+	want := requestID
+
+	err := readEvents(body, func(_ string, data string) error {
+		touch(ctx)
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return fmt.Errorf("decode stream message: %w", err)
+		}
+		switch {
+		case msg.Method != "" && msg.hasID():
+			release := keepAlive(ctx)
+			reply := c.handleServerRequest(ctx, server, msg)
+			release()
+			if err := c.reply(ctx, server, sessionID, reply); err != nil {
+				return fmt.Errorf("reply to %s: %w", msg.Method, err)
+			}
+		case msg.Method != "":
+			c.handleNotification(ctx, msg)
+		case strings.Trim(string(msg.ID), `"`) == want:
+			final = rpcResponse{JSONRPC: msg.JSONRPC, ID: msg.ID, Result: msg.Result, Error: msg.Error}
+			found = true
+			return errStreamDone
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStreamDone) {
+		return final, err
+	}
+	if !found {
+		return final, errors.New("stream ended without a response")
+	}
+	return final, nil
+}
+
+// handleServerRequest answers a request the server sent back to the client mid-call.
+func (c *Client) handleServerRequest(ctx context.Context, server *discovery.ServerInfo, msg rpcMessage) rpcResponse {
+	resp := rpcResponse{JSONRPC: jsonRPCVersion, ID: msg.ID}
+	switch msg.Method {
+	case "ping":
+		resp.Result = json.RawMessage(`{}`)
+	case "sampling/createMessage":
+		if c.sampling == nil {
+			resp.Error = &RPCError{Code: CodeMethodNotFound, Message: "sampling is not enabled on this client"}
+			break
+		}
+		var req SamplingRequest
+		if err := json.Unmarshal(msg.Params, &req); err != nil {
+			resp.Error = &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+			break
+		}
+		result, err := c.sampling.CreateMessage(ctx, server, req)
+		if err != nil {
+			resp.Error = &RPCError{Code: CodeSamplingRejected, Message: err.Error()}
+			break
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &RPCError{Code: CodeInternalError, Message: err.Error()}
+			break
+		}
+		resp.Result = data
+	default:
+		resp.Error = &RPCError{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q not supported by client", msg.Method)}
+	}
+	return resp
+}
+
+// handleNotification processes server notifications seen mid-call. Unknown notifications
+// are informational and ignored.
+func (c *Client) handleNotification(ctx context.Context, msg rpcMessage) {
+	switch msg.Method {
+	case "notifications/progress":
+		fn := progressFromContext(ctx)
+		if fn == nil {
+			return
+		}
+		var params progressParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return
+		}
+		fn(Progress{
+			Token:    strings.Trim(string(params.ProgressToken), `"`),
+			Progress: params.Progress,
+			Total:    params.Total,
+			Message:  params.Message,
+			Partial:  params.Partial,
+		})
+	}
+}
+
+// reply posts a response to a server-initiated request. JSON-RPC servers receive it on
+// their MCP endpoint; legacy servers on POST /messages.
+func (c *Client) reply(ctx context.Context, server *discovery.ServerInfo, sessionID string, resp rpcResponse) error {
+	path := legacyMessagesPath
+	if Dialect(server) == DialectJSONRPC {
+		path = rpcPath(server)
+	}
+	endpoint, err := buildURL(server, path)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("encode reply: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ProtocolHeader, ProtocolVersion)
+	if sessionID != "" {
+		req.Header.Set(SessionHeader, sessionID)
+	}
+	httpResp, err := c.do(server, req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode >= http.StatusMultipleChoices {
+		data, _ := io.ReadAll(io.LimitReader(httpResp.Body, maxErrorBodyLen))
+		return fmt.Errorf("%s (%s)", httpResp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// dropSession forgets sess so that the next call starts a new session. A session another
+// call has already started in its place is kept.
+func (c *Client) dropSession(server *discovery.ServerInfo, sess *session) {
+	key := sessionKey(server)
+	c.sessionsMu.Lock()
+	if c.sessions[key] == sess {
+		delete(c.sessions, key)
+	}
+	c.sessionsMu.Unlock()
+}
+
+// ServerCapabilities returns the capabilities announced by a JSON-RPC server during
+// initialize. Legacy servers report nil.
+func (c *Client) ServerCapabilities(ctx context.Context, server *discovery.ServerInfo) (map[string]any, error) {
+	if Dialect(server) != DialectJSONRPC {
+		return nil, nil
+	}
+	sess, err := c.session(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	return sess.capabilities, nil
+}
+
+func (c *Client) nextID() int64 {
+	return atomic.AddInt64(&c.requestID, 1)
+}
+
+// legacyCallID returns a Mcp-Request-Id for a legacy call. Unlike JSON-RPC ids, which are
+// scoped to a session, it must not collide with the ids of other clients of the server.
+func (c *Client) legacyCallID() string {
+	return fmt.Sprintf("%s-%d", c.callPrefix, c.nextID())
+}
+
+// isMissingRoute distinguishes a server that lacks an endpoint entirely (plain-text mux 404)
+// from a handler that rejected the request with a structured JSON error.
+func isMissingRoute(status int, body string) bool {
+	switch status {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return !strings.HasPrefix(body, "{")
+	default:
+		return false
+	}
+}
+
+func rpcPath(server *discovery.ServerInfo) string {
+	if path := strings.TrimSpace(server.Text["path"]); path != "" {
+		return path
+	}
+	return DefaultRPCPath
+}
+
+func sessionKey(server *discovery.ServerInfo) string {
+	return server.Instance + "|" + server.Address
+}
@@ -0,0 +1,107 @@
+package mediator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mcpwrapper/internal/mcp"
+)
+
+// ErrUnknownServer is returned for an instance that is not in the current server set.
+var ErrUnknownServer = errors.New("unknown server")
+
+// ServerState is the mediator's view of one server, as reported by the admin API.
+type ServerState struct {
+	// ToolsStatus is "ok" or "error" after the last tools/list, or "unknown" before any.
+	ToolsStatus string    `json:"tools_status"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastChecked time.Time `json:"last_checked,omitzero"`
+	// Watched reports an open list_changed notification stream.
+	Watched   bool `json:"watched"`
+	ToolCount int  `json:"tool_count"`
+
+	Quarantined      bool      `json:"quarantined"`
+	QuarantineReason string    `json:"quarantine_reason,omitempty"`
+	QuarantinedAt    time.Time `json:"quarantined_at,omitzero"`
+}
+
+type quarantine struct {
+	reason string
+	since  time.Time
+}
+
+// quarantines holds instances the mediator must ignore, independently of discovery.
+type quarantines struct {
+	mu      sync.RWMutex
+	entries map[string]quarantine
+}
+
+func (q *quarantines) get(instance string) (quarantine, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	entry, ok := q.entries[instance]
+	return entry, ok
+}
+
+// ServerState reports health and quarantine state for instance.
+func (m *Mediator) ServerState(instance string) ServerState {
+	state := ServerState{ToolsStatus: "unknown"}
+	if entry, ok := m.toolCache.status(instance); ok {
+		state.Watched = entry.watched
+		state.LastChecked = entry.checked
+		state.ToolCount = len(entry.tools)
+		switch {
+		case entry.err != nil:
+			state.ToolsStatus = "error"
+			state.LastError = entry.err.Error()
+		case !entry.checked.IsZero():
+			state.ToolsStatus = "ok"
+		}
+	}
+	if q, ok := m.quarantined.get(instance); ok {
+		state.Quarantined = true
+		state.QuarantineReason = q.reason
+		state.QuarantinedAt = q.since
+	}
+	return state
+}
+
+// ServerTools lists the tools of one server, including quarantined ones. With refresh the
+// cached list is dropped first, forcing a tools/list.
+func (m *Mediator) ServerTools(ctx context.Context, instance string, refresh bool) ([]mcp.ToolDefinition, error) {
+	srv, ok := m.servers.ServersSnapshot()[instance]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownServer, instance)
+	}
+	if m.toolClient == nil {
+		return nil, fmt.Errorf("tool client not configured")
+	}
+	if refresh {
+		m.toolCache.invalidate(instance)
+	}
+	return m.listTools(ctx, srv)
+}
+
+// Quarantine makes the mediator ignore instance (no tools, resources or prompts) until
+// Unquarantine. The instance need not currently be discovered.
+func (m *Mediator) Quarantine(instance, reason string) {
+	m.quarantined.mu.Lock()
+	m.quarantined.entries[instance] = quarantine{reason: reason, since: time.Now()}
+	m.quarantined.mu.Unlock()
+	m.logger.Warn("server quarantined", "instance", instance, "reason", reason)
+}
+
+// Unquarantine lifts a quarantine, reporting whether there was one.
+func (m *Mediator) Unquarantine(instance string) bool {
+	m.quarantined.mu.Lock()
+	_, ok := m.quarantined.entries[instance]
+	delete(m.quarantined.entries, instance)
+	m.quarantined.mu.Unlock()
+	if ok {
+		m.logger.Info("server quarantine lifted", "instance", instance)
+	}
+	return ok
+}
@@ -5,16 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 	"time"
 
+	log "github.com/charmbracelet/log"
 	openai "github.com/openai/openai-go"
 	"github.com/openai/openai-go/shared"
 	"github.com/openai/openai-go/shared/constant"
 
+	"go.mcpwrapper/internal/apikey"
 	"go.mcpwrapper/internal/discovery"
 	"go.mcpwrapper/internal/mcp"
+	"go.mcpwrapper/internal/ratelimit"
 	"go.mcpwrapper/internal/types"
 )
 
@@ -28,18 +32,37 @@ var ErrStreamingUnsupported = errors.New("streaming is not supported")
 type Options struct {
 	ModelName     string
 	ProviderModel string
-	AllowedKinds  []string
-	ToolClient    *mcp.Client
-	OpenAIClient  *openai.Client
+	// Selector limits the servers whose tools are offered, e.g.
+	// "kind in (tool,agent-wrapper), env=prod". The zero Selector allows every server.
+	Selector discovery.Selector
+	// AllowedKinds is shorthand for a selector requirement "kind in (...)"; both apply.
+	AllowedKinds []string
+	ToolClient   *mcp.Client
+	OpenAIClient *openai.Client
+	// Destructive selects how tools annotated as destructive are handled (default allow).
+	Destructive DestructivePolicy
+	// ToolRetries is the number of extra attempts made for idempotent tools after a
+	// transient failure.
+	ToolRetries int
+	// ReadOnlyTools restricts the roster to tools annotated as read-only.
+	ReadOnlyTools bool
+	// Limits caps concurrent tool calls per tool server (its ToolServers entries); calls
+	// beyond the cap wait for a slot.
+	Limits ratelimit.Policy
+	// Logger receives tool cache and notification stream events. Defaults to discarding.
+	Logger *log.Logger
 }
 
 // ToolDescriptor exposes a discovered tool in an OpenAI-style format for diagnostics.
 type ToolDescriptor struct {
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	Parameters  map[string]any `json:"parameters,omitempty"`
-	Server      ToolServerRef  `json:"server"`
-	Original    string         `json:"original_tool"`
+	Name             string               `json:"name"`
+	Title            string               `json:"title,omitempty"`
+	Description      string               `json:"description"`
+	Parameters       map[string]any       `json:"parameters,omitempty"`
+	Annotations      *mcp.ToolAnnotations `json:"annotations,omitempty"`
+	RequiresApproval bool                 `json:"requires_approval,omitempty"`
+	Server           ToolServerRef        `json:"server"`
+	Original         string               `json:"original_tool"`
 }
 
 // ToolServerRef provides contextual information about the MCP server hosting a tool.
@@ -55,20 +78,36 @@ type toolMeta struct {
 	ToolName     string
 	Description  string
 	OriginalName string
+	Annotations  *mcp.ToolAnnotations
+}
+
+// ServerSource supplies the MCP servers the mediator may route to. *discovery.Discovery
+// satisfies it; tests can substitute a fixed set (see mcptest.StaticSource).
+type ServerSource interface {
+	ServersSnapshot() map[string]*discovery.ServerInfo
 }
 
 // Mediator routes chat requests, consults discovery, and orchestrates MCP tool usage.
 type Mediator struct {
-	discovery     *discovery.Discovery
+	servers       ServerSource
 	openaiClient  *openai.Client
 	providerModel string
 	modelName     string
+	selector      discovery.Selector
 	allowedKinds  map[string]struct{}
 	toolClient    *mcp.Client
+	destructive   DestructivePolicy
+	toolRetries   int
+	readOnlyTools bool
+	toolCache     *toolCache
+	limits        ratelimit.Policy
+	toolSlots     *ratelimit.Semaphores
+	quarantined   *quarantines
+	logger        *log.Logger
 }
 
 // New returns a configured mediator instance.
-func New(discovery *discovery.Discovery, opts Options) *Mediator {
+func New(servers ServerSource, opts Options) *Mediator {
 	if opts.ModelName == "" {
 		opts.ModelName = "go-agent-1"
 	}
@@ -86,13 +125,30 @@ func New(discovery *discovery.Discovery, opts Options) *Mediator {
 	if client == nil {
 		client = mcp.NewClient(mcp.Options{})
 	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard)
+	}
+	destructive := opts.Destructive
+	if destructive == "" {
+		destructive = DestructiveAllow
+	}
 	return &Mediator{
-		discovery:     discovery,
+		servers:       servers,
 		openaiClient:  opts.OpenAIClient,
 		providerModel: opts.ProviderModel,
 		modelName:     opts.ModelName,
+		selector:      opts.Selector,
 		allowedKinds:  kindSet,
 		toolClient:    client,
+		destructive:   destructive,
+		toolRetries:   opts.ToolRetries,
+		readOnlyTools: opts.ReadOnlyTools,
+		toolCache:     newToolCache(),
+		limits:        opts.Limits,
+		toolSlots:     ratelimit.NewSemaphores(),
+		quarantined:   &quarantines{entries: make(map[string]quarantine)},
+		logger:        logger,
 	}
 }
 
@@ -101,14 +157,29 @@ func (m *Mediator) SupportedModels() []string {
 	return []string{m.modelName}
 }
 
+// DefaultModel is the model that serves requests which do not name one.
+func (m *Mediator) DefaultModel() string {
+	return m.modelName
+}
+
 // HandleChat is the main entry point used by the API layer.
 func (m *Mediator) HandleChat(ctx context.Context, req types.ChatCompletionRequest) (types.ChatCompletionResponse, error) {
-	if err := req.Validate(); err != nil {
-		return types.ChatCompletionResponse{}, err
-	}
 	if req.Stream {
 		return types.ChatCompletionResponse{}, ErrStreamingUnsupported
 	}
+	return m.handleChat(ctx, req, nil)
+}
+
+// HandleChatStream runs a chat request like HandleChat while relaying tool progress
+// (including partial tool output) to onProgress as it arrives.
+func (m *Mediator) HandleChatStream(ctx context.Context, req types.ChatCompletionRequest, onProgress func(types.ToolProgress)) (types.ChatCompletionResponse, error) {
+	return m.handleChat(ctx, req, onProgress)
+}
+
+func (m *Mediator) handleChat(ctx context.Context, req types.ChatCompletionRequest, onProgress func(types.ToolProgress)) (types.ChatCompletionResponse, error) {
+	if err := req.Validate(); err != nil {
+		return types.ChatCompletionResponse{}, err
+	}
 	if req.Model != "" && !m.supportsModel(req.Model) {
 		return types.ChatCompletionResponse{}, fmt.Errorf("%w: %s", ErrModelUnsupported, req.Model)
 	}
@@ -117,13 +188,30 @@ func (m *Mediator) HandleChat(ctx context.Context, req types.ChatCompletionReque
 	}
 
 	messages := convertMessages(req.Messages)
-	toolParams, meta, _, err := m.collectTools(ctx)
+	if req.Prompt != nil {
+		expanded, err := m.expandPrompt(ctx, req.Prompt)
+		if err != nil {
+			return types.ChatCompletionResponse{}, err
+		}
+		messages = append(expanded, messages...)
+	}
+	toolParams, meta, _, err := m.collectTools(ctx, m.toolFilter(req))
 	if err != nil {
 		// proceed with whatever we have; log via returned error context appended.
 		messages = append(messages, openai.SystemMessage(fmt.Sprintf("Warning: tool discovery error: %v", err)))
 	}
+	resources, err := m.collectResources(ctx)
+	if err != nil {
+		messages = append(messages, openai.SystemMessage(fmt.Sprintf("Warning: resource discovery error: %v", err)))
+	}
+	// collectResources has already applied the key's per-server scope.
+	offerResources := !resources.empty() && apikey.FromContext(ctx).AllowsFunction(readResourceFunction)
+	if offerResources {
+		toolParams = append(toolParams, resources.toolParam())
+	}
 
 	conversation := append([]openai.ChatCompletionMessageParamUnion{}, messages...)
+	cache := make(resultCache)
 
 	for {
 		params := openai.ChatCompletionNewParams{
@@ -150,20 +238,80 @@ func (m *Mediator) HandleChat(ctx context.Context, req types.ChatCompletionReque
 		}
 
 		for _, call := range choice.Message.ToolCalls {
-			metaEntry, ok := meta[call.Function.Name]
-			if !ok {
-				return types.ChatCompletionResponse{}, fmt.Errorf("unknown tool '%s'", call.Function.Name)
-			}
 			var args map[string]any
 			if call.Function.Arguments != "" {
 				if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
 					return types.ChatCompletionResponse{}, fmt.Errorf("invalid tool arguments for %s: %w", call.Function.Name, err)
 				}
 			}
-			result, err := m.toolClient.CallTool(ctx, metaEntry.Server, metaEntry.ToolName, args)
+			if call.Function.Name == readResourceFunction && offerResources {
+				payload, err := m.readResource(ctx, resources, args)
+				if err != nil {
+					payload = map[string]any{"tool": readResourceFunction, "error": err.Error()}
+				}
+				data, _ := json.Marshal(payload)
+				conversation = append(conversation, openai.ToolMessage(string(data), call.ID))
+				continue
+			}
+			metaEntry, ok := meta[call.Function.Name]
+			if !ok {
+				return types.ChatCompletionResponse{}, fmt.Errorf("unknown tool '%s'", call.Function.Name)
+			}
+			if m.requiresApproval(metaEntry.Annotations) && !approved(req, call.Function.Name, metaEntry) {
+				payload := map[string]any{
+					"tool":              metaEntry.ToolName,
+					"server":            metaEntry.Server.Instance,
+					"approval_required": true,
+					"error": fmt.Sprintf("%s is marked destructive and was not run. Ask the user to confirm; "+
+						"the client must resend the request with %q in approved_tools.", call.Function.Name, call.Function.Name),
+				}
+				data, _ := json.Marshal(payload)
+				conversation = append(conversation, openai.ToolMessage(string(data), call.ID))
+				continue
+			}
+			key := cacheKey(call.Function.Name, args)
+			if cached, ok := cache[key]; ok {
+				payload := map[string]any{
+					"tool":        metaEntry.ToolName,
+					"server":      metaEntry.Server.Instance,
+					"description": metaEntry.Description,
+					"result":      cached.Result,
+					"cached":      true,
+				}
+				data, _ := json.Marshal(payload)
+				conversation = append(conversation, openai.ToolMessage(string(data), call.ID))
+				continue
+			}
+			callCtx := ctx
+			if onProgress != nil {
+				function := call.Function.Name
+				callCtx = mcp.WithProgress(ctx, func(p mcp.Progress) {
+					onProgress(types.ToolProgress{
+						Function: function,
+						Server:   p.Server,
+						Tool:     p.Tool,
+						Progress: p.Progress,
+						Total:    p.Total,
+						Message:  p.Message,
+						Partial:  p.Partial,
+					})
+				})
+			}
+			start := time.Now()
+			result, err := m.callTool(callCtx, metaEntry, args)
+			fields := append(keyFields(ctx),
+				"function", call.Function.Name,
+				"server", metaEntry.Server.Instance,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
 			if err != nil {
+				m.logger.Warn("tool call failed", append(fields, "error", err)...)
 				return types.ChatCompletionResponse{}, fmt.Errorf("tool %s failed: %w", call.Function.Name, err)
 			}
+			m.logger.Info("tool call complete", fields...)
+			if metaEntry.Annotations.ReadOnly() {
+				cache[key] = result
+			}
 			payload := map[string]any{
 				"tool":        metaEntry.ToolName,
 				"server":      metaEntry.Server.Instance,
@@ -178,12 +326,12 @@ func (m *Mediator) HandleChat(ctx context.Context, req types.ChatCompletionReque
 
 // ListTools aggregates all tools exposed by discovered MCP servers and returns an OpenAI-style roster.
 func (m *Mediator) ListTools(ctx context.Context) ([]ToolDescriptor, error) {
-	_, _, descriptors, err := m.collectTools(ctx)
+	_, _, descriptors, err := m.collectTools(ctx, m.toolFilter(types.ChatCompletionRequest{}))
 	return descriptors, err
 }
 
-func (m *Mediator) collectTools(ctx context.Context) ([]openai.ChatCompletionToolParam, map[string]toolMeta, []ToolDescriptor, error) {
-	servers := m.discovery.ServersSnapshot()
+func (m *Mediator) collectTools(ctx context.Context, include func(*mcp.ToolAnnotations) bool) ([]openai.ChatCompletionToolParam, map[string]toolMeta, []ToolDescriptor, error) {
+	servers := m.eligibleServers()
 	if len(servers) == 0 {
 		return nil, map[string]toolMeta{}, nil, nil
 	}
@@ -196,26 +344,23 @@ func (m *Mediator) collectTools(ctx context.Context) ([]openai.ChatCompletionToo
 		descriptors []ToolDescriptor
 	)
 	meta := make(map[string]toolMeta)
+	key := apikey.FromContext(ctx)
 	var lastErr error
 
 	for _, srv := range servers {
-		if len(m.allowedKinds) > 0 {
-			if _, ok := m.allowedKinds[strings.ToLower(strings.TrimSpace(srv.Kind))]; !ok {
-				continue
-			}
-		}
-		if !isToolHost(srv) {
-			continue
-		}
-		ctxList, cancel := context.WithTimeout(ctx, 10*time.Second)
-		tools, err := m.toolClient.ListTools(ctxList, srv)
-		cancel()
+		tools, err := m.listTools(ctx, srv)
 		if err != nil {
 			lastErr = err
 			continue
 		}
 		for _, tool := range tools {
+			if include != nil && !include(tool.Annotations) {
+				continue
+			}
 			functionName := buildFunctionName(srv.Instance, tool.Name, meta)
+			if !keyAllows(key, srv, tool.Name, functionName) {
+				continue
+			}
 			description := buildToolDescription(tool.Description, srv)
 			fn := shared.FunctionDefinitionParam{
 				Name:        functionName,
@@ -231,18 +376,17 @@ func (m *Mediator) collectTools(ctx context.Context) ([]openai.ChatCompletionToo
 				ToolName:     tool.Name,
 				Description:  description,
 				OriginalName: tool.Name,
+				Annotations:  tool.Annotations,
 			}
 			descriptors = append(descriptors, ToolDescriptor{
-				Name:        functionName,
-				Original:    tool.Name,
-				Description: description,
-				Parameters:  tool.Parameters,
-				Server: ToolServerRef{
-					Instance: srv.Instance,
-					Address:  srv.Address,
-					Kind:     srv.Kind,
-					Metadata: cloneMetadata(srv.Text),
-				},
+				Name:             functionName,
+				Title:            tool.Title,
+				Original:         tool.Name,
+				Description:      description,
+				Parameters:       tool.Parameters,
+				Annotations:      tool.Annotations,
+				RequiresApproval: m.requiresApproval(tool.Annotations),
+				Server:           serverRef(srv),
 			})
 		}
 	}
@@ -260,6 +404,43 @@ func (m *Mediator) collectTools(ctx context.Context) ([]openai.ChatCompletionToo
 	return toolParams, meta, descriptors, lastErr
 }
 
+// eligibleServers returns the discovered servers the mediator may use, ordered by instance.
+// Servers outside the selector, quarantined or unhealthy servers and servers that failed
+// signature verification are left out.
+func (m *Mediator) eligibleServers() []*discovery.ServerInfo {
+	snapshot := m.servers.ServersSnapshot()
+	servers := make([]*discovery.ServerInfo, 0, len(snapshot))
+	for _, srv := range snapshot {
+		if !m.selector.Matches(srv) {
+			continue
+		}
+		if len(m.allowedKinds) > 0 {
+			if _, ok := m.allowedKinds[strings.ToLower(strings.TrimSpace(srv.Kind))]; !ok {
+				continue
+			}
+		}
+		if !isToolHost(srv) {
+			continue
+		}
+		if _, ok := m.quarantined.get(srv.Instance); ok {
+			continue
+		}
+		if srv.Health == discovery.HealthDown {
+			continue
+		}
+		// Discovery keeps servers that failed signature checks only under the
+		// quarantine policy, for inspection; they are never used.
+		if srv.Signature != "" && srv.Signature != discovery.SignatureValid {
+			continue
+		}
+		servers = append(servers, srv)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Instance < servers[j].Instance
+	})
+	return servers
+}
+
 func (m *Mediator) supportsModel(model string) bool {
 	return model == m.modelName
 }
@@ -338,6 +519,15 @@ func isToolHost(info *discovery.ServerInfo) bool {
 	return kind == strings.ToLower(discovery.ServerKindTool) || kind == strings.ToLower(discovery.ServerKindAgentWrapper)
 }
 
+func serverRef(srv *discovery.ServerInfo) ToolServerRef {
+	return ToolServerRef{
+		Instance: srv.Instance,
+		Address:  srv.Address,
+		Kind:     srv.Kind,
+		Metadata: cloneMetadata(srv.Text),
+	}
+}
+
 func cloneMetadata(meta map[string]string) map[string]string {
 	if meta == nil {
 		return nil
@@ -0,0 +1,279 @@
+package mediator_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mcpwrapper/internal/mcp"
+	"go.mcpwrapper/internal/mcp/mcptest"
+	"go.mcpwrapper/internal/mediator"
+	"go.mcpwrapper/internal/types"
+)
+
+// fakeServer describes one mcptest server in a test case.
+type fakeServer struct {
+	opts  mcptest.Options
+	tools []mcptest.Tool
+	down  bool
+}
+
+var readOnly = &mcp.ToolAnnotations{ReadOnlyHint: mcp.Hint(true)}
+
+func TestToolLoop(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []fakeServer
+		turns   []mcptest.Turn
+		// retries and timeout set Options.ToolRetries and the tool client's idle timeout.
+		retries int
+		timeout time.Duration
+
+		wantContent string
+		wantErr     string
+		// wantCalls counts the calls each tool received, keyed "instance/tool".
+		wantCalls map[string]int
+		// wantRoster is the function list offered in the first model request.
+		wantRoster []string
+		// wantToolResult appears in the last tool message sent to the model.
+		wantToolResult string
+		minElapsed     time.Duration
+		maxElapsed     time.Duration
+	}{
+		{
+			name: "one call then reply",
+			servers: []fakeServer{{
+				opts:  mcptest.Options{Instance: "weather"},
+				tools: []mcptest.Tool{{Name: "forecast", Result: map[string]any{"temp": 21}}},
+			}},
+			turns: []mcptest.Turn{
+				mcptest.CallTools(mcptest.ToolCall{Function: "forecast", Arguments: map[string]any{"city": "Oslo"}}),
+				mcptest.Reply("21 degrees in Oslo"),
+			},
+			wantContent:    "21 degrees in Oslo",
+			wantCalls:      map[string]int{"weather/forecast": 1},
+			wantRoster:     []string{"weather__forecast"},
+			wantToolResult: `"temp":21`,
+		},
+		{
+			name: "turns across servers and dialects",
+			servers: []fakeServer{
+				{
+					opts:  mcptest.Options{Instance: "weather"},
+					tools: []mcptest.Tool{{Name: "forecast", Result: map[string]any{"temp": 21}}},
+				},
+				{
+					opts:  mcptest.Options{Instance: "calendar", Dialect: mcp.DialectJSONRPC},
+					tools: []mcptest.Tool{{Name: "events"}, {Name: "book"}},
+				},
+			},
+			turns: []mcptest.Turn{
+				mcptest.CallTools(mcptest.ToolCall{Function: "events", Arguments: map[string]any{"day": "monday"}}),
+				mcptest.CallTools(
+					mcptest.ToolCall{Function: "forecast", Arguments: map[string]any{"city": "Oslo"}},
+					mcptest.ToolCall{Function: "calendar__book", Arguments: map[string]any{"slot": "10:00"}},
+				),
+				mcptest.Reply("Booked 10:00, it will be 21 degrees"),
+			},
+			wantContent:    "Booked 10:00, it will be 21 degrees",
+			wantCalls:      map[string]int{"weather/forecast": 1, "calendar/events": 1, "calendar/book": 1},
+			wantRoster:     []string{"calendar__book", "calendar__events", "weather__forecast"},
+			wantToolResult: `"slot":"10:00"`,
+		},
+		{
+			name: "idempotent tool retried after a transient failure",
+			servers: []fakeServer{{
+				opts: mcptest.Options{Instance: "weather"},
+				tools: []mcptest.Tool{{Name: "forecast", Result: map[string]any{"temp": 21},
+					FailFirst: 1, Status: 503, Annotations: readOnly}},
+			}},
+			turns: []mcptest.Turn{
+				mcptest.CallTools(mcptest.ToolCall{Function: "forecast"}),
+				mcptest.Reply("21 degrees"),
+			},
+			retries:        1,
+			wantContent:    "21 degrees",
+			wantCalls:      map[string]int{"weather/forecast": 2},
+			wantToolResult: `"temp":21`,
+		},
+		{
+			name: "failure without retries ends the request",
+			servers: []fakeServer{{
+				opts:  mcptest.Options{Instance: "weather"},
+				tools: []mcptest.Tool{{Name: "forecast", FailFirst: 1, Status: 503, Annotations: readOnly}},
+			}},
+			turns:     []mcptest.Turn{mcptest.CallTools(mcptest.ToolCall{Function: "forecast"})},
+			wantErr:   "tool weather__forecast failed",
+			wantCalls: map[string]int{"weather/forecast": 1},
+		},
+		{
+			name: "tool that may have side effects is not retried",
+			servers: []fakeServer{{
+				opts:  mcptest.Options{Instance: "calendar"},
+				tools: []mcptest.Tool{{Name: "book", FailFirst: 1, Status: 503}},
+			}},
+			turns:     []mcptest.Turn{mcptest.CallTools(mcptest.ToolCall{Function: "book"})},
+			retries:   3,
+			wantErr:   "tool calendar__book failed",
+			wantCalls: map[string]int{"calendar/book": 1},
+		},
+		{
+			name: "slow tool within the timeout",
+			servers: []fakeServer{{
+				opts:  mcptest.Options{Instance: "weather"},
+				tools: []mcptest.Tool{{Name: "forecast", Latency: 200 * time.Millisecond}},
+			}},
+			turns: []mcptest.Turn{
+				mcptest.CallTools(mcptest.ToolCall{Function: "forecast"}),
+				mcptest.Reply("done"),
+			},
+			timeout:     2 * time.Second,
+			wantContent: "done",
+			wantCalls:   map[string]int{"weather/forecast": 1},
+			minElapsed:  200 * time.Millisecond,
+		},
+		{
+			name: "slow tool past the idle timeout",
+			servers: []fakeServer{{
+				opts:  mcptest.Options{Instance: "weather"},
+				tools: []mcptest.Tool{{Name: "forecast", Latency: 5 * time.Second}},
+			}},
+			turns:      []mcptest.Turn{mcptest.CallTools(mcptest.ToolCall{Function: "forecast"})},
+			timeout:    200 * time.Millisecond,
+			wantErr:    "tool weather__forecast failed",
+			minElapsed: 200 * time.Millisecond,
+			maxElapsed: 3 * time.Second,
+		},
+		{
+			name: "repeated read-only lookup served from the request cache",
+			servers: []fakeServer{{
+				opts:  mcptest.Options{Instance: "weather"},
+				tools: []mcptest.Tool{{Name: "forecast", Result: map[string]any{"temp": 21}, Annotations: readOnly}},
+			}},
+			turns: []mcptest.Turn{
+				mcptest.CallTools(mcptest.ToolCall{Function: "forecast", Arguments: map[string]any{"city": "Oslo"}}),
+				mcptest.CallTools(mcptest.ToolCall{Function: "forecast", Arguments: map[string]any{"city": "Oslo"}}),
+				mcptest.Reply("still 21 degrees"),
+			},
+			wantContent:    "still 21 degrees",
+			wantCalls:      map[string]int{"weather/forecast": 1},
+			wantToolResult: `"cached":true`,
+		},
+		{
+			name: "unreachable server offers no tools",
+			servers: []fakeServer{
+				{
+					opts:  mcptest.Options{Instance: "weather"},
+					tools: []mcptest.Tool{{Name: "forecast"}},
+				},
+				{
+					opts:  mcptest.Options{Instance: "calendar"},
+					tools: []mcptest.Tool{{Name: "events"}},
+					down:  true,
+				},
+			},
+			turns: []mcptest.Turn{
+				mcptest.CallTools(mcptest.ToolCall{Function: "forecast"}),
+				mcptest.Reply("done"),
+			},
+			wantContent: "done",
+			wantCalls:   map[string]int{"weather/forecast": 1, "calendar/events": 0},
+			wantRoster:  []string{"weather__forecast"},
+		},
+		{
+			name: "unknown function ends the request",
+			servers: []fakeServer{{
+				opts:  mcptest.Options{Instance: "weather"},
+				tools: []mcptest.Tool{{Name: "forecast"}},
+			}},
+			turns:   []mcptest.Turn{mcptest.CallTools(mcptest.ToolCall{Function: "weather__radar"})},
+			wantErr: "unknown tool 'weather__radar'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := mcptest.NewStaticSource()
+			servers := make(map[string]*mcptest.Server, len(tt.servers))
+			for _, spec := range tt.servers {
+				srv := mcptest.NewServer(spec.opts, spec.tools...)
+				t.Cleanup(srv.Close)
+				srv.SetDown(spec.down)
+				servers[spec.opts.Instance] = srv
+				source.Add(srv.Info())
+			}
+			model := mcptest.NewModel(tt.turns...)
+			t.Cleanup(model.Close)
+
+			med := mediator.New(source, mediator.Options{
+				OpenAIClient: model.Client(),
+				ToolClient:   mcp.NewClient(mcp.Options{Timeout: tt.timeout}),
+				ToolRetries:  tt.retries,
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			start := time.Now()
+			resp, err := med.HandleChat(ctx, types.ChatCompletionRequest{
+				Model:    "go-agent-1",
+				Messages: []types.ChatMessage{{Role: "user", Content: "What is planned?"}},
+			})
+			elapsed := time.Since(start)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("HandleChat error = %v, want %q", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("HandleChat: %v", err)
+				}
+				if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != tt.wantContent {
+					t.Errorf("reply = %+v, want %q", resp.Choices, tt.wantContent)
+				}
+			}
+
+			for key, want := range tt.wantCalls {
+				instance, tool, _ := strings.Cut(key, "/")
+				if got := len(servers[instance].Calls(tool)); got != want {
+					t.Errorf("%s received %d calls, want %d", key, got, want)
+				}
+			}
+
+			requests := model.Requests()
+			if len(requests) == 0 {
+				t.Fatal("model received no requests")
+			}
+			if tt.wantRoster != nil {
+				if got := requests[0].ToolNames(); strings.Join(got, ",") != strings.Join(tt.wantRoster, ",") {
+					t.Errorf("roster = %v, want %v", got, tt.wantRoster)
+				}
+			}
+			if tt.wantToolResult != "" {
+				last := lastToolMessage(requests[len(requests)-1])
+				if !strings.Contains(last, tt.wantToolResult) {
+					t.Errorf("last tool message = %s, want it to contain %s", last, tt.wantToolResult)
+				}
+			}
+			if wantTurns := len(tt.turns); tt.wantErr == "" && len(requests) != wantTurns {
+				t.Errorf("model received %d requests, want %d", len(requests), wantTurns)
+			}
+
+			if elapsed < tt.minElapsed {
+				t.Errorf("took %v, want at least %v", elapsed, tt.minElapsed)
+			}
+			if tt.maxElapsed > 0 && elapsed > tt.maxElapsed {
+				t.Errorf("took %v, want under %v", elapsed, tt.maxElapsed)
+			}
+		})
+	}
+}
+
+func lastToolMessage(req mcptest.ChatRequest) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i]["role"] == "tool" {
+			content, _ := req.Messages[i]["content"].(string)
+			return content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package mediator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mcpwrapper/internal/apikey"
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mcp"
+	"go.mcpwrapper/internal/types"
+)
+
+// DestructivePolicy controls how the mediator treats tools whose annotations mark them as
+// destructive (or that carry no annotations, which the MCP spec treats as destructive).
+type DestructivePolicy string
+
+const (
+	// DestructiveAllow calls destructive tools like any other.
+	DestructiveAllow DestructivePolicy = "allow"
+	// DestructiveApprove offers destructive tools to the model but only runs them when the
+	// request lists them in approved_tools.
+	DestructiveApprove DestructivePolicy = "approve"
+	// DestructiveDeny hides destructive tools from the model entirely.
+	DestructiveDeny DestructivePolicy = "deny"
+)
+
+// ParseDestructivePolicy validates a policy name; empty selects DestructiveAllow.
+func ParseDestructivePolicy(value string) (DestructivePolicy, error) {
+	switch policy := DestructivePolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return DestructiveAllow, nil
+	case DestructiveAllow, DestructiveApprove, DestructiveDeny:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown destructive tool policy %q (want allow, approve or deny)", value)
+	}
+}
+
+const toolRetryBackoff = 250 * time.Millisecond
+
+// toolFilter reports whether a tool should be offered to the model for this request.
+func (m *Mediator) toolFilter(req types.ChatCompletionRequest) func(*mcp.ToolAnnotations) bool {
+	readOnly := m.readOnlyTools || req.ReadOnlyTools
+	return func(a *mcp.ToolAnnotations) bool {
+		if readOnly && !a.ReadOnly() {
+			return false
+		}
+		if m.destructive == DestructiveDeny && a.Destructive() {
+			return false
+		}
+		return true
+	}
+}
+
+// keyAllows applies the caller's API key scope to a tool. The collision-free base name is
+// checked as well, so a suffixed duplicate cannot slip past a deny pattern.
+func keyAllows(key *apikey.Key, srv *discovery.ServerInfo, toolName, functionName string) bool {
+	base := fmt.Sprintf("%s__%s", slugify(srv.Instance), slugify(toolName))
+	return key.AllowsFunction(functionName) && key.AllowsFunction(base)
+}
+
+// keyFields tags log lines with the caller's API key name, when there is one.
+func keyFields(ctx context.Context) []any {
+	if key := apikey.FromContext(ctx); key != nil {
+		return []any{"key", key.Name}
+	}
+	return nil
+}
+
+func (m *Mediator) requiresApproval(a *mcp.ToolAnnotations) bool {
+	return m.destructive == DestructiveApprove && a.Destructive()
+}
+
+func approved(req types.ChatCompletionRequest, functionName string, entry toolMeta) bool {
+	for _, name := range req.ApprovedTools {
+		name = strings.TrimSpace(name)
+		if name == functionName || name == entry.OriginalName {
+			return true
+		}
+	}
+	return false
+}
+
+// callTool invokes a tool, retrying transient failures when its annotations say repeating
+// the call is safe.
+func (m *Mediator) callTool(ctx context.Context, entry toolMeta, args map[string]any) (mcp.CallResult, error) {
+	attempts := 1
+	if entry.Annotations.Idempotent() && m.toolRetries > 0 {
+		attempts += m.toolRetries
+	}
+	var (
+		result mcp.CallResult
+		err    error
+	)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		result, err = m.callToolOnce(ctx, entry, args)
+		if err == nil || !retryable(ctx, err) || attempt == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(time.Duration(attempt) * toolRetryBackoff):
+		}
+	}
+	return result, err
+}
+
+// callToolOnce makes one attempt, waiting for a slot when the server has a concurrency cap.
+func (m *Mediator) callToolOnce(ctx context.Context, entry toolMeta, args map[string]any) (mcp.CallResult, error) {
+	instance := entry.Server.Instance
+	max := m.limits.ToolServer(instance)
+	release, err := m.toolSlots.Acquire(ctx, instance, max)
+	if err != nil {
+		return mcp.CallResult{}, fmt.Errorf("waiting for a free slot on %s (max %d in flight): %w", instance, max, err)
+	}
+	defer release()
+	return m.toolClient.CallTool(ctx, entry.Server, entry.ToolName, args)
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return !errors.Is(err, mcp.ErrToolError) && !errors.Is(err, mcp.ErrUnsupported)
+}
+
+// resultCache memoises read-only tool results for the lifetime of one chat request, so a
+// model that repeats a lookup does not hit the server twice.
+type resultCache map[string]mcp.CallResult
+
+func cacheKey(functionName string, args map[string]any) string {
+	data, _ := json.Marshal(args)
+	return functionName + "\x00" + string(data)
+}
@@ -0,0 +1,171 @@
+package mediator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	openai "github.com/openai/openai-go"
+
+	"go.mcpwrapper/internal/apikey"
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mcp"
+	"go.mcpwrapper/internal/types"
+)
+
+// ErrUnknownPrompt is returned when a chat request references a prompt no server publishes.
+var ErrUnknownPrompt = errors.New("unknown prompt")
+
+// PromptDescriptor exposes a discovered MCP prompt template for browsing.
+type PromptDescriptor struct {
+	Name        string               `json:"name"`
+	Original    string               `json:"original_prompt"`
+	Title       string               `json:"title,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Arguments   []mcp.PromptArgument `json:"arguments,omitempty"`
+	Server      ToolServerRef        `json:"server"`
+}
+
+type promptMeta struct {
+	Server     *discovery.ServerInfo
+	PromptName string
+	Arguments  []mcp.PromptArgument
+}
+
+// ListPrompts aggregates the prompt templates published by discovered MCP servers.
+func (m *Mediator) ListPrompts(ctx context.Context) ([]PromptDescriptor, error) {
+	_, descriptors, err := m.collectPrompts(ctx)
+	return descriptors, err
+}
+
+// collectPrompts lists the prompts the caller's key allows, by their namespaced names.
+func (m *Mediator) collectPrompts(ctx context.Context) (map[string]promptMeta, []PromptDescriptor, error) {
+	meta := make(map[string]promptMeta)
+	if m.toolClient == nil {
+		return meta, nil, errors.New("tool client not configured")
+	}
+
+	var (
+		descriptors []PromptDescriptor
+		lastErr     error
+	)
+	key := apikey.FromContext(ctx)
+	for _, srv := range m.eligibleServers() {
+		ctxList, cancel := context.WithTimeout(ctx, 10*time.Second)
+		prompts, err := m.toolClient.ListPrompts(ctxList, srv)
+		cancel()
+		if err != nil {
+			if !errors.Is(err, mcp.ErrUnsupported) {
+				lastErr = err
+			}
+			continue
+		}
+		for _, prompt := range prompts {
+			name := buildPromptName(srv.Instance, prompt.Name, meta)
+			if !keyAllows(key, srv, prompt.Name, name) {
+				continue
+			}
+			meta[name] = promptMeta{
+				Server:     srv,
+				PromptName: prompt.Name,
+				Arguments:  prompt.Arguments,
+			}
+			descriptors = append(descriptors, PromptDescriptor{
+				Name:        name,
+				Original:    prompt.Name,
+				Title:       prompt.Title,
+				Description: prompt.Description,
+				Arguments:   prompt.Arguments,
+				Server:      serverRef(srv),
+			})
+		}
+	}
+
+	sort.Slice(descriptors, func(i, j int) bool {
+		return descriptors[i].Name < descriptors[j].Name
+	})
+	return meta, descriptors, lastErr
+}
+
+// expandPrompt resolves a prompt reference (namespaced, or bare when unambiguous) and
+// returns the messages it expands to.
+func (m *Mediator) expandPrompt(ctx context.Context, ref *types.PromptReference) ([]openai.ChatCompletionMessageParamUnion, error) {
+	meta, _, err := m.collectPrompts(ctx)
+	entry, ok := meta[ref.Name]
+	if !ok {
+		var matches []promptMeta
+		for _, candidate := range meta {
+			if candidate.PromptName == ref.Name {
+				matches = append(matches, candidate)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s (%v)", ErrUnknownPrompt, ref.Name, err)
+			}
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPrompt, ref.Name)
+		case 1:
+			entry = matches[0]
+		default:
+			return nil, fmt.Errorf("%w: %s is published by %d servers, use the namespaced name", ErrUnknownPrompt, ref.Name, len(matches))
+		}
+	}
+
+	for _, arg := range entry.Arguments {
+		if arg.Required && strings.TrimSpace(ref.Arguments[arg.Name]) == "" {
+			return nil, fmt.Errorf("prompt %s requires argument %q", ref.Name, arg.Name)
+		}
+	}
+
+	result, err := m.toolClient.GetPrompt(ctx, entry.Server, entry.PromptName, ref.Arguments)
+	if err != nil {
+		return nil, fmt.Errorf("expand prompt %s: %w", ref.Name, err)
+	}
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(result.Messages))
+	for _, msg := range result.Messages {
+		text := promptContentText(msg.Content)
+		if text == "" {
+			continue
+		}
+		if strings.EqualFold(msg.Role, "assistant") {
+			messages = append(messages, openai.ChatCompletionMessageParamOfAssistant(text))
+		} else {
+			messages = append(messages, openai.UserMessage(text))
+		}
+	}
+	return messages, nil
+}
+
+func promptContentText(content mcp.Content) string {
+	switch content.Type {
+	case "", "text":
+		return content.Text
+	case "resource":
+		if content.Resource == nil {
+			return ""
+		}
+		if content.Resource.Text != "" {
+			return fmt.Sprintf("Resource %s:\n%s", content.Resource.URI, content.Resource.Text)
+		}
+		return fmt.Sprintf("Resource %s (binary content omitted)", content.Resource.URI)
+	default:
+		return fmt.Sprintf("[%s content omitted]", content.Type)
+	}
+}
+
+func buildPromptName(instance, promptName string, existing map[string]promptMeta) string {
+	base := fmt.Sprintf("%s__%s", slugify(instance), slugify(promptName))
+	name := base
+	i := 2
+	for {
+		if _, exists := existing[name]; !exists {
+			return name
+		}
+		name = fmt.Sprintf("%s__%d", base, i)
+		i++
+	}
+}
@@ -0,0 +1,323 @@
+package mediator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	openai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+	"github.com/openai/openai-go/shared/constant"
+
+	"go.mcpwrapper/internal/apikey"
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mcp"
+)
+
+// readResourceFunction is the built-in function offered to the model whenever at least one
+// discovered server publishes resources.
+const readResourceFunction = "read_resource"
+
+const (
+	maxCataloguedInDescription = 25
+	maxResourceTextBytes       = 64 << 10
+)
+
+// ResourceDescriptor exposes a discovered MCP resource for browsing.
+type ResourceDescriptor struct {
+	URI         string        `json:"uri"`
+	Name        string        `json:"name"`
+	Title       string        `json:"title,omitempty"`
+	Description string        `json:"description,omitempty"`
+	MimeType    string        `json:"mime_type,omitempty"`
+	Size        int64         `json:"size,omitempty"`
+	Server      ToolServerRef `json:"server"`
+}
+
+// ResourceTemplateDescriptor exposes a discovered MCP resource template for browsing.
+type ResourceTemplateDescriptor struct {
+	URITemplate string        `json:"uri_template"`
+	Name        string        `json:"name"`
+	Title       string        `json:"title,omitempty"`
+	Description string        `json:"description,omitempty"`
+	MimeType    string        `json:"mime_type,omitempty"`
+	Server      ToolServerRef `json:"server"`
+}
+
+type templateRoute struct {
+	pattern *regexp.Regexp
+	server  *discovery.ServerInfo
+}
+
+// resourceCatalogue aggregates resources across servers and remembers which server owns
+// each URI so read_resource calls can be routed.
+type resourceCatalogue struct {
+	resources []ResourceDescriptor
+	templates []ResourceTemplateDescriptor
+	owners    map[string][]*discovery.ServerInfo
+	routes    []templateRoute
+	servers   map[string]*discovery.ServerInfo
+}
+
+func (c *resourceCatalogue) empty() bool {
+	return c == nil || (len(c.resources) == 0 && len(c.templates) == 0)
+}
+
+// ListResources aggregates resources and resource templates published by discovered MCP servers.
+func (m *Mediator) ListResources(ctx context.Context) ([]ResourceDescriptor, []ResourceTemplateDescriptor, error) {
+	catalogue, err := m.collectResources(ctx)
+	if catalogue == nil {
+		return nil, nil, err
+	}
+	return catalogue.resources, catalogue.templates, err
+}
+
+// collectResources lists the resources of the servers whose resources the caller's key may
+// read: it must allow read_resource and the server's `<instance>__read_resource`.
+func (m *Mediator) collectResources(ctx context.Context) (*resourceCatalogue, error) {
+	catalogue := &resourceCatalogue{
+		owners:  make(map[string][]*discovery.ServerInfo),
+		servers: make(map[string]*discovery.ServerInfo),
+	}
+	if m.toolClient == nil {
+		return catalogue, errors.New("tool client not configured")
+	}
+
+	key := apikey.FromContext(ctx)
+	var lastErr error
+	for _, srv := range m.eligibleServers() {
+		if !keyAllows(key, srv, readResourceFunction, readResourceFunction) {
+			continue
+		}
+		resources, templates, err := m.listResources(ctx, srv)
+		if err != nil {
+			lastErr = err
+		}
+		if len(resources) == 0 && len(templates) == 0 {
+			continue
+		}
+
+		ref := serverRef(srv)
+		catalogue.servers[srv.Instance] = srv
+		for _, res := range resources {
+			catalogue.resources = append(catalogue.resources, ResourceDescriptor{
+				URI:         res.URI,
+				Name:        res.Name,
+				Title:       res.Title,
+				Description: res.Description,
+				MimeType:    res.MimeType,
+				Size:        res.Size,
+				Server:      ref,
+			})
+			catalogue.owners[res.URI] = append(catalogue.owners[res.URI], srv)
+		}
+		for _, tmpl := range templates {
+			catalogue.templates = append(catalogue.templates, ResourceTemplateDescriptor{
+				URITemplate: tmpl.URITemplate,
+				Name:        tmpl.Name,
+				Title:       tmpl.Title,
+				Description: tmpl.Description,
+				MimeType:    tmpl.MimeType,
+				Server:      ref,
+			})
+			if pattern, err := compileURITemplate(tmpl.URITemplate); err == nil {
+				catalogue.routes = append(catalogue.routes, templateRoute{pattern: pattern, server: srv})
+			}
+		}
+	}
+
+	sort.Slice(catalogue.resources, func(i, j int) bool {
+		return catalogue.resources[i].URI < catalogue.resources[j].URI
+	})
+	sort.Slice(catalogue.templates, func(i, j int) bool {
+		return catalogue.templates[i].URITemplate < catalogue.templates[j].URITemplate
+	})
+	return catalogue, lastErr
+}
+
+// listResources returns the server's resources and templates, from the cache when it can
+// be trusted. A server without the resource methods is cached as publishing none.
+func (m *Mediator) listResources(ctx context.Context, srv *discovery.ServerInfo) ([]mcp.Resource, []mcp.ResourceTemplate, error) {
+	if resources, templates, ok := m.toolCache.getResources(srv); ok {
+		return resources, templates, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var lastErr error
+	resources, err := m.toolClient.ListResources(ctx, srv)
+	if err != nil && !errors.Is(err, mcp.ErrUnsupported) {
+		lastErr = err
+	}
+	templates, err := m.toolClient.ListResourceTemplates(ctx, srv)
+	if err != nil && !errors.Is(err, mcp.ErrUnsupported) {
+		lastErr = err
+	}
+	if lastErr != nil {
+		return resources, templates, lastErr
+	}
+	m.toolCache.putResources(srv, resources, templates)
+	return resources, templates, nil
+}
+
+// toolParam builds the read_resource function definition, listing part of the catalogue in
+// its description so the model knows what it can ask for.
+func (c *resourceCatalogue) toolParam() openai.ChatCompletionToolParam {
+	var b strings.Builder
+	b.WriteString("Reads a resource (document, file, record) published by a discovered MCP server and returns its contents.")
+	if len(c.resources) > 0 {
+		b.WriteString(" Available resources:")
+		for i, res := range c.resources {
+			if i == maxCataloguedInDescription {
+				fmt.Fprintf(&b, " ... and %d more", len(c.resources)-i)
+				break
+			}
+			fmt.Fprintf(&b, " %s", res.URI)
+			if label := firstNonEmpty(res.Title, res.Name); label != "" {
+				fmt.Fprintf(&b, " (%s)", label)
+			}
+			b.WriteString(";")
+		}
+	}
+	if len(c.templates) > 0 {
+		b.WriteString(" URI templates:")
+		for i, tmpl := range c.templates {
+			if i == maxCataloguedInDescription {
+				fmt.Fprintf(&b, " ... and %d more", len(c.templates)-i)
+				break
+			}
+			fmt.Fprintf(&b, " %s", tmpl.URITemplate)
+			if tmpl.Description != "" {
+				fmt.Fprintf(&b, " (%s)", tmpl.Description)
+			}
+			b.WriteString(";")
+		}
+	}
+
+	return openai.ChatCompletionToolParam{
+		Type: constant.Function("function"),
+		Function: shared.FunctionDefinitionParam{
+			Name:        readResourceFunction,
+			Description: openai.String(b.String()),
+			Parameters: shared.FunctionParameters{
+				"type": "object",
+				"properties": map[string]any{
+					"uri": map[string]any{
+						"type":        "string",
+						"description": "URI of the resource to read, either listed or expanded from a URI template.",
+					},
+					"server": map[string]any{
+						"type":        "string",
+						"description": "Optional instance name of the server to read from when several publish the same URI.",
+					},
+				},
+				"required": []string{"uri"},
+			},
+		},
+	}
+}
+
+// resolve picks the server that should serve the URI.
+func (c *resourceCatalogue) resolve(uri, instance string) (*discovery.ServerInfo, error) {
+	if instance != "" {
+		if srv, ok := c.servers[instance]; ok {
+			return srv, nil
+		}
+		return nil, fmt.Errorf("unknown resource server %q", instance)
+	}
+	if owners := c.owners[uri]; len(owners) > 0 {
+		return owners[0], nil
+	}
+	for _, route := range c.routes {
+		if route.pattern.MatchString(uri) {
+			return route.server, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown resource %q", uri)
+}
+
+func (m *Mediator) readResource(ctx context.Context, catalogue *resourceCatalogue, args map[string]any) (map[string]any, error) {
+	if catalogue.empty() {
+		return nil, errors.New("no resources available")
+	}
+	uri, _ := args["uri"].(string)
+	uri = strings.TrimSpace(uri)
+	if uri == "" {
+		return nil, errors.New("uri is required")
+	}
+	instance, _ := args["server"].(string)
+	srv, err := catalogue.resolve(uri, strings.TrimSpace(instance))
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := m.toolClient.ReadResource(ctx, srv, uri)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]any, 0, len(contents))
+	for _, item := range contents {
+		entry := map[string]any{"uri": item.URI}
+		if item.MimeType != "" {
+			entry["mime_type"] = item.MimeType
+		}
+		switch {
+		case item.Text != "":
+			text := item.Text
+			if len(text) > maxResourceTextBytes {
+				cut := maxResourceTextBytes
+				for cut > 0 && !utf8.RuneStart(text[cut]) {
+					cut--
+				}
+				text = text[:cut]
+				entry["truncated"] = true
+			}
+			entry["text"] = text
+		case item.Blob != "":
+			entry["blob"] = fmt.Sprintf("<binary content omitted, %d base64 bytes>", len(item.Blob))
+		}
+		items = append(items, entry)
+	}
+	return map[string]any{
+		"tool":     readResourceFunction,
+		"server":   srv.Instance,
+		"uri":      uri,
+		"contents": items,
+	}, nil
+}
+
+var templateVariable = regexp.MustCompile(`\{[^}]*\}`)
+
+// compileURITemplate turns an RFC 6570 template into a matcher. Simple `{var}` expansions
+// match a single path segment; reserved `{+var}` and other operators match anything.
+func compileURITemplate(template string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, loc := range templateVariable.FindAllStringIndex(template, -1) {
+		b.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		expr := template[loc[0]+1 : loc[1]-1]
+		if expr != "" && strings.ContainsAny(expr[:1], "+#./;?&") {
+			b.WriteString(".*")
+		} else {
+			b.WriteString("[^/?#]+")
+		}
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(template[last:]))
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
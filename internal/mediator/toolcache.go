@@ -0,0 +1,364 @@
+package mediator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mcp"
+)
+
+const (
+	// toolCacheTTL bounds how long a cached tool list is trusted even when the server's
+	// hash is unchanged or its notification stream is up.
+	toolCacheTTL = 10 * time.Minute
+	// watchInterval is how often Watch reconciles notification streams with discovery.
+	watchInterval = 15 * time.Second
+	// resourceCacheTTL bounds how long a server's resource lists are reused when no
+	// notification stream would report a change to them.
+	resourceCacheTTL = 30 * time.Second
+)
+
+// toolCache remembers each server's tool list between requests. An entry is only reused
+// when something vouches for it: the server advertises a tools hash that still matches,
+// or a notification stream is open that would have reported a change. Servers offering
+// neither are listed on every request. A list restored from the discovery snapshot is
+// reused while its server is itself only restored (see discovery.ServerInfo.Unverified).
+type toolCache struct {
+	mu      sync.Mutex
+	entries map[string]*toolCacheEntry
+}
+
+type toolCacheEntry struct {
+	address string
+	hash    string
+	tools   []mcp.ToolDefinition
+	fetched time.Time
+	watched bool
+	// restored marks a list read from the discovery snapshot and not fetched since.
+	restored bool
+
+	// checked and err record the outcome of the latest tools/list, for the admin API.
+	checked time.Time
+	err     error
+
+	// resources and templates are the server's resource lists, cached since
+	// resourcesFetched; a zero time means none are cached.
+	resources        []mcp.Resource
+	templates        []mcp.ResourceTemplate
+	resourcesFetched time.Time
+}
+
+func newToolCache() *toolCache {
+	return &toolCache{entries: make(map[string]*toolCacheEntry)}
+}
+
+func (c *toolCache) get(srv *discovery.ServerInfo) ([]mcp.ToolDefinition, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[srv.Instance]
+	if !ok || entry.tools == nil || entry.address != srv.Address {
+		return nil, false
+	}
+	if entry.restored && srv.Unverified() {
+		// Both come from the snapshot, and the server lasts only until a provider
+		// confirms it or Options.SnapshotTTL passes; then the usual rules apply.
+		return entry.tools, true
+	}
+	if time.Since(entry.fetched) > toolCacheTTL {
+		return nil, false
+	}
+	if hash := srv.Text[mcp.ToolsHashKey]; hash != "" {
+		return entry.tools, hash == entry.hash
+	}
+	return entry.tools, entry.watched
+}
+
+func (c *toolCache) put(srv *discovery.ServerInfo, tools []mcp.ToolDefinition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[srv.Instance]
+	if !ok || entry.address != srv.Address {
+		entry = &toolCacheEntry{address: srv.Address}
+		c.entries[srv.Instance] = entry
+	}
+	entry.hash = srv.Text[mcp.ToolsHashKey]
+	entry.tools = tools
+	entry.restored = false
+	entry.fetched = time.Now()
+	entry.checked = entry.fetched
+	entry.err = nil
+}
+
+// fail records a failed listing without discarding the watch state.
+func (c *toolCache) fail(srv *discovery.ServerInfo, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[srv.Instance]
+	if !ok || entry.address != srv.Address {
+		entry = &toolCacheEntry{address: srv.Address}
+		c.entries[srv.Instance] = entry
+	}
+	entry.tools = nil
+	entry.restored = false
+	entry.checked = time.Now()
+	entry.err = err
+}
+
+// getResources returns the cached resource lists for srv. They are trusted for
+// toolCacheTTL while a notification stream is open to report changes, and for
+// resourceCacheTTL otherwise.
+func (c *toolCache) getResources(srv *discovery.ServerInfo) ([]mcp.Resource, []mcp.ResourceTemplate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[srv.Instance]
+	if !ok || entry.resourcesFetched.IsZero() || entry.address != srv.Address {
+		return nil, nil, false
+	}
+	ttl := resourceCacheTTL
+	if entry.watched {
+		ttl = toolCacheTTL
+	}
+	if time.Since(entry.resourcesFetched) > ttl {
+		return nil, nil, false
+	}
+	return entry.resources, entry.templates, true
+}
+
+func (c *toolCache) putResources(srv *discovery.ServerInfo, resources []mcp.Resource, templates []mcp.ResourceTemplate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[srv.Instance]
+	if !ok || entry.address != srv.Address {
+		entry = &toolCacheEntry{address: srv.Address}
+		c.entries[srv.Instance] = entry
+	}
+	entry.resources = resources
+	entry.templates = templates
+	entry.resourcesFetched = time.Now()
+}
+
+// invalidateResources drops the cached resource lists for instance.
+func (c *toolCache) invalidateResources(instance string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[instance]; ok {
+		entry.resources, entry.templates, entry.resourcesFetched = nil, nil, time.Time{}
+	}
+}
+
+// status returns a copy of the entry for instance.
+func (c *toolCache) status(instance string) (toolCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[instance]
+	if !ok {
+		return toolCacheEntry{}, false
+	}
+	return *entry, true
+}
+
+// invalidate drops the cached list for instance, keeping its watch state.
+func (c *toolCache) invalidate(instance string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[instance]; ok {
+		entry.tools = nil
+	}
+}
+
+func (c *toolCache) setWatched(srv *discovery.ServerInfo, watched bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[srv.Instance]
+	if !ok || entry.address != srv.Address {
+		entry = &toolCacheEntry{address: srv.Address}
+		c.entries[srv.Instance] = entry
+	}
+	entry.watched = watched
+	if entry.hash == "" {
+		// Changes made while no stream was open went unreported, and without the stream
+		// nothing would report the next one.
+		entry.tools = nil
+	}
+	entry.resources, entry.templates, entry.resourcesFetched = nil, nil, time.Time{}
+}
+
+func (c *toolCache) forget(instance string) {
+	c.mu.Lock()
+	delete(c.entries, instance)
+	c.mu.Unlock()
+}
+
+// savedTools is a cached tool list as persisted with the discovery snapshot.
+type savedTools struct {
+	Address string               `json:"address"`
+	Hash    string               `json:"hash,omitempty"`
+	Tools   []mcp.ToolDefinition `json:"tools"`
+	Fetched time.Time            `json:"fetched"`
+}
+
+// SaveSnapshot implements discovery.SnapshotExtension: it returns the cached tool lists,
+// so that after a restart they are offered before the servers can be listed again.
+func (m *Mediator) SaveSnapshot() (json.RawMessage, error) {
+	m.toolCache.mu.Lock()
+	saved := make(map[string]savedTools, len(m.toolCache.entries))
+	for instance, entry := range m.toolCache.entries {
+		if entry.tools == nil || time.Since(entry.fetched) > toolCacheTTL {
+			continue
+		}
+		saved[instance] = savedTools{Address: entry.address, Hash: entry.hash, Tools: entry.tools, Fetched: entry.fetched}
+	}
+	m.toolCache.mu.Unlock()
+	return json.Marshal(saved)
+}
+
+// RestoreSnapshot implements discovery.SnapshotExtension. A restored list is trusted for
+// as long as its server is the one restored with the snapshot, which discovery keeps
+// until a provider confirms it or the snapshot TTL passes, so that the first requests
+// after a restart need not wait for every server. Once the server is confirmed the list
+// is trusted like any cached one: while the server's tools hash matches and for at most
+// toolCacheTTL since it was fetched. Lists fetched since the restart take precedence.
+func (m *Mediator) RestoreSnapshot(data json.RawMessage) error {
+	var saved map[string]savedTools
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	m.toolCache.mu.Lock()
+	defer m.toolCache.mu.Unlock()
+	for instance, s := range saved {
+		if _, ok := m.toolCache.entries[instance]; ok || s.Tools == nil {
+			continue
+		}
+		m.toolCache.entries[instance] = &toolCacheEntry{
+			address:  s.Address,
+			hash:     s.Hash,
+			tools:    s.Tools,
+			fetched:  s.Fetched,
+			checked:  s.Fetched,
+			restored: true,
+		}
+	}
+	return nil
+}
+
+// listTools returns the server's tools, from the cache when it can be trusted.
+func (m *Mediator) listTools(ctx context.Context, srv *discovery.ServerInfo) ([]mcp.ToolDefinition, error) {
+	if tools, ok := m.toolCache.get(srv); ok {
+		return tools, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	tools, err := m.toolClient.ListTools(ctx, srv)
+	if err != nil {
+		m.toolCache.fail(srv, err)
+		return nil, err
+	}
+	if tools == nil {
+		tools = []mcp.ToolDefinition{}
+	}
+	m.toolCache.put(srv, tools)
+	return tools, nil
+}
+
+type watcher struct {
+	address string
+	cancel  context.CancelFunc
+}
+
+// Watch keeps a notification stream open to every eligible server that offers one, so a
+// tool or resource list reported changed (notifications/tools/list_changed,
+// notifications/resources/list_changed) is refetched on the next request instead of
+// waiting for the cache to expire. It runs until ctx ends.
+func (m *Mediator) Watch(ctx context.Context) {
+	if m.toolClient == nil {
+		return
+	}
+	var mu sync.Mutex
+	watchers := make(map[string]*watcher)
+	defer func() {
+		mu.Lock()
+		for _, w := range watchers {
+			w.cancel()
+		}
+		mu.Unlock()
+	}()
+
+	reconcile := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		current := make(map[string]*discovery.ServerInfo)
+		for _, srv := range m.eligibleServers() {
+			current[srv.Instance] = srv
+		}
+		for instance, w := range watchers {
+			if srv, ok := current[instance]; ok && srv.Address == w.address {
+				continue
+			}
+			w.cancel()
+			delete(watchers, instance)
+			m.toolCache.forget(instance)
+		}
+		for instance, srv := range current {
+			if _, ok := watchers[instance]; ok {
+				continue
+			}
+			wctx, cancel := context.WithCancel(ctx)
+			w := &watcher{address: srv.Address, cancel: cancel}
+			watchers[instance] = w
+			go func() {
+				err := m.watchServer(wctx, srv)
+				mu.Lock()
+				defer mu.Unlock()
+				if watchers[instance] != w {
+					return
+				}
+				if errors.Is(err, mcp.ErrUnsupported) {
+					// Keep the entry so the server is not asked again until its
+					// address changes.
+					return
+				}
+				// Closed or failed: the next reconcile opens a fresh stream.
+				delete(watchers, instance)
+			}()
+		}
+	}
+
+	reconcile()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reconcile()
+		}
+	}
+}
+
+func (m *Mediator) watchServer(ctx context.Context, srv *discovery.ServerInfo) error {
+	m.toolCache.setWatched(srv, true)
+	defer m.toolCache.setWatched(srv, false)
+
+	err := m.toolClient.Listen(ctx, srv, func(n mcp.Notification) {
+		switch n.Method {
+		case mcp.NotifyToolsListChanged:
+			m.toolCache.invalidate(srv.Instance)
+			m.logger.Info("tool list changed", "instance", srv.Instance)
+		case mcp.NotifyResourcesListChanged:
+			m.toolCache.invalidateResources(srv.Instance)
+			m.logger.Info("resource list changed", "instance", srv.Instance)
+		}
+	})
+	switch {
+	case errors.Is(err, mcp.ErrUnsupported):
+		m.logger.Debug("server offers no notification stream", "instance", srv.Instance)
+	case err != nil:
+		m.logger.Debug("notification stream ended", "instance", srv.Instance, "error", err)
+	}
+	return err
+}
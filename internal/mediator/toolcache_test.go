@@ -0,0 +1,79 @@
+package mediator_test
+
+import (
+	"context"
+	"testing"
+
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mcp"
+	"go.mcpwrapper/internal/mcp/mcptest"
+	"go.mcpwrapper/internal/mediator"
+)
+
+func TestRestoredToolLists(t *testing.T) {
+	tests := []struct {
+		name string
+		// hashed advertises the tools hash, which vouches for a cached list.
+		hashed bool
+		// source is the Source of the server when the restored list is consulted.
+		source string
+		// moved puts the server at a new address after the restart.
+		moved     bool
+		wantTools []string
+	}{
+		{name: "server still unverified", source: discovery.SourceSnapshot, wantTools: []string{"weather__forecast"}},
+		{name: "server confirmed without a tools hash", source: discovery.SourceMDNS},
+		{name: "server confirmed with a matching hash", hashed: true, source: discovery.SourceMDNS, wantTools: []string{"weather__forecast"}},
+		{name: "server moved", source: discovery.SourceSnapshot, moved: true, wantTools: []string{"weather__radar"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			opts := mcptest.Options{Instance: "weather"}
+			srv := mcptest.NewServer(opts, mcptest.Tool{Name: "forecast"})
+			t.Cleanup(srv.Close)
+			if tt.hashed {
+				opts.Text = map[string]string{mcp.ToolsHashKey: srv.ToolsHash()}
+				srv.Close()
+				srv = mcptest.NewServer(opts, mcptest.Tool{Name: "forecast"})
+				t.Cleanup(srv.Close)
+			}
+
+			// The previous run lists the tools and saves them.
+			before := mediator.New(mcptest.NewStaticSource(srv.Info()), mediator.Options{})
+			if _, err := before.ListTools(ctx); err != nil {
+				t.Fatalf("ListTools before restart: %v", err)
+			}
+			saved, err := before.SaveSnapshot()
+			if err != nil {
+				t.Fatalf("SaveSnapshot: %v", err)
+			}
+
+			// After the restart the server does not answer, or answers elsewhere.
+			info := srv.Info()
+			srv.SetDown(true)
+			if tt.moved {
+				elsewhere := mcptest.NewServer(opts, mcptest.Tool{Name: "radar"})
+				t.Cleanup(elsewhere.Close)
+				info = elsewhere.Info()
+			}
+			info.Source = tt.source
+			after := mediator.New(mcptest.NewStaticSource(info), mediator.Options{})
+			if err := after.RestoreSnapshot(saved); err != nil {
+				t.Fatalf("RestoreSnapshot: %v", err)
+			}
+
+			tools, err := after.ListTools(ctx)
+			var names []string
+			for _, tool := range tools {
+				names = append(names, tool.Name)
+			}
+			if len(names) != len(tt.wantTools) || (len(names) > 0 && names[0] != tt.wantTools[0]) {
+				t.Errorf("tools = %v (err %v), want %v", names, err, tt.wantTools)
+			}
+			if len(tt.wantTools) == 0 && err == nil {
+				t.Error("listing a down server without a trusted cache succeeded")
+			}
+		})
+	}
+}
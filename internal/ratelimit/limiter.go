@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Limit combines a request rate with a cap on concurrent requests. Zero fields are
+// unlimited.
+type Limit struct {
+	RequestsPerMinute float64 `json:"requests_per_minute,omitempty"`
+	Burst             int     `json:"burst,omitempty"`
+	MaxInFlight       int     `json:"max_in_flight,omitempty"`
+}
+
+// Zero reports whether the limit imposes nothing.
+func (l Limit) Zero() bool {
+	return l.RequestsPerMinute <= 0 && l.MaxInFlight <= 0
+}
+
+// ErrLimited is matched by every *Error.
+var ErrLimited = errors.New("rate limited")
+
+// Error reports a refused request and when it is worth retrying.
+type Error struct {
+	// Scope names what was limited, e.g. "key ops" or "model go-agent-1".
+	Scope      string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Scope, e.Reason)
+}
+
+// Is makes errors.Is(err, ErrLimited) hold.
+func (e *Error) Is(target error) bool {
+	return target == ErrLimited
+}
+
+// inFlightRetry is the Retry-After suggested when a concurrency cap is hit; there is no
+// way to know when a running request will finish.
+const inFlightRetry = time.Second
+
+// maxIdleEntries bounds the per-name state kept for idle callers; beyond it, entries with
+// a full bucket and nothing in flight are dropped.
+const maxIdleEntries = 10000
+
+// Limiter applies limits per name (an API key, a user, a model). It is safe for concurrent
+// use.
+type Limiter struct {
+	scope string
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	bucket   *Bucket
+	inFlight int
+}
+
+// NewLimiter returns a limiter whose errors are scoped by kind, e.g. "user".
+func NewLimiter(kind string) *Limiter {
+	return &Limiter{scope: kind, entries: make(map[string]*entry)}
+}
+
+// Acquire admits one request for name under limit. The bucket for a name is sized on first
+// use. On success the returned release must be called when the request finishes; on
+// refusal the error is an *Error.
+func (l *Limiter) Acquire(name string, limit Limit) (func(), error) {
+	if limit.Zero() {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[name]
+	if !ok {
+		if len(l.entries) >= maxIdleEntries {
+			l.prune()
+		}
+		e = &entry{}
+		if limit.RequestsPerMinute > 0 {
+			e.bucket = NewBucket(limit.RequestsPerMinute, limit.Burst)
+		}
+		l.entries[name] = e
+	}
+	scope := fmt.Sprintf("%s %s", l.scope, name)
+	if limit.MaxInFlight > 0 && e.inFlight >= limit.MaxInFlight {
+		return nil, &Error{Scope: scope, Reason: fmt.Sprintf("%d requests already in flight", e.inFlight), RetryAfter: inFlightRetry}
+	}
+	if e.bucket != nil {
+		if ok, wait := e.bucket.Take(); !ok {
+			return nil, &Error{Scope: scope, Reason: "request rate exceeded", RetryAfter: wait}
+		}
+	}
+	e.inFlight++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			e.inFlight--
+			l.mu.Unlock()
+		})
+	}, nil
+}
+
+func (l *Limiter) prune() {
+	for name, e := range l.entries {
+		if e.inFlight == 0 && (e.bucket == nil || e.bucket.full()) {
+			delete(l.entries, name)
+		}
+	}
+}
+
+// Semaphores caps concurrent work per name, making callers wait for a free slot rather
+// than refusing them.
+type Semaphores struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// NewSemaphores returns an empty set of semaphores.
+func NewSemaphores() *Semaphores {
+	return &Semaphores{slots: make(map[string]chan struct{})}
+}
+
+// Acquire waits until fewer than max holders share name, or ctx ends. A max of zero or
+// less never waits. The semaphore for a name is sized on first use.
+func (s *Semaphores) Acquire(ctx context.Context, name string, max int) (func(), error) {
+	if max <= 0 {
+		return func() {}, nil
+	}
+	s.mu.Lock()
+	slots, ok := s.slots[name]
+	if !ok || cap(slots) != max {
+		slots = make(chan struct{}, max)
+		s.slots[name] = slots
+	}
+	s.mu.Unlock()
+	select {
+	case slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-slots }) }, nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// Policy is the orchestrator's limits file: a limit applied to each distinct `user` of
+// the chat API, limits per API model, and concurrency caps per tool server instance
+// ("*" applies to servers without their own entry).
+type Policy struct {
+	User        Limit            `json:"user"`
+	Models      map[string]Limit `json:"models"`
+	ToolServers map[string]Limit `json:"tool_servers"`
+}
+
+// Model returns the limit for an API model.
+func (p Policy) Model(name string) Limit {
+	return p.Models[name]
+}
+
+// ToolServer returns the concurrency cap for a tool server instance.
+func (p Policy) ToolServer(instance string) int {
+	if limit, ok := p.ToolServers[instance]; ok {
+		return limit.MaxInFlight
+	}
+	return p.ToolServers["*"].MaxInFlight
+}
+
+// LoadPolicy reads a limits file.
+func LoadPolicy(path string) (Policy, error) {
+	var p Policy
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, fmt.Errorf("read limits file: %w", err)
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("parse limits file: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,339 @@
+package sampling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/charmbracelet/log"
+	openai "github.com/openai/openai-go"
+
+	"go.mcpwrapper/internal/discovery"
+	"go.mcpwrapper/internal/mcp"
+)
+
+// ErrDenied is returned when the policy does not allow a server to request sampling.
+var ErrDenied = errors.New("sampling not permitted for this server")
+
+// ErrQuotaExceeded is returned when a server has used up its token quota for the window.
+var ErrQuotaExceeded = errors.New("sampling token quota exceeded")
+
+// Policy governs sampling requests from a single tool server.
+type Policy struct {
+	Enabled     bool
+	MaxTokens   int           // cap applied to each request's maxTokens
+	TokenQuota  int           // tokens per QuotaWindow; 0 means unlimited
+	QuotaWindow time.Duration // defaults to one hour
+	Model       string        // overrides Options.Model when set
+}
+
+// Options configure a sampling handler.
+type Options struct {
+	Client  *openai.Client
+	Model   string
+	Default Policy
+	Servers map[string]Policy
+	Logger  *log.Logger
+}
+
+// Handler implements mcp.SamplingHandler by running requests through the orchestrator's
+// OpenAI-compatible client, subject to per-server policy and quota.
+type Handler struct {
+	client  *openai.Client
+	model   string
+	def     Policy
+	servers map[string]Policy
+	logger  *log.Logger
+
+	mu    sync.Mutex
+	usage map[string]*window
+}
+
+type window struct {
+	start time.Time
+	used  int
+}
+
+// reservation is the part of a quota window set aside for one request in progress.
+type reservation struct {
+	w      *window
+	tokens int
+}
+
+const (
+	defaultMaxTokens   = 1024
+	defaultQuotaWindow = time.Hour
+)
+
+// New returns a sampling handler.
+func New(opts Options) *Handler {
+	servers := make(map[string]Policy, len(opts.Servers))
+	for name, policy := range opts.Servers {
+		servers[strings.TrimSpace(name)] = policy.withDefaults()
+	}
+	return &Handler{
+		client:  opts.Client,
+		model:   opts.Model,
+		def:     opts.Default.withDefaults(),
+		servers: servers,
+		logger:  opts.Logger,
+		usage:   make(map[string]*window),
+	}
+}
+
+// CreateMessage runs a sampling/createMessage request for the given server.
+func (h *Handler) CreateMessage(ctx context.Context, server *discovery.ServerInfo, req mcp.SamplingRequest) (mcp.SamplingResult, error) {
+	var result mcp.SamplingResult
+	if server == nil {
+		return result, errors.New("nil server")
+	}
+	if h.client == nil {
+		return result, errors.New("openai client not configured")
+	}
+	policy := h.policyFor(server.Instance)
+	if !policy.Enabled {
+		return result, fmt.Errorf("%w: %s", ErrDenied, server.Instance)
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 || maxTokens > policy.MaxTokens {
+		maxTokens = policy.MaxTokens
+	}
+	res, maxTokens, err := h.reserve(server.Instance, policy, estimateTokens(req), maxTokens)
+	if err != nil {
+		return result, err
+	}
+	used := 0
+	defer func() { h.settle(server.Instance, policy, res, used) }()
+
+	model := firstNonEmpty(policy.Model, h.model)
+	params := openai.ChatCompletionNewParams{
+		Model:     model,
+		Messages:  buildMessages(req),
+		MaxTokens: openai.Int(int64(maxTokens)),
+	}
+	if req.Temperature != nil {
+		params.Temperature = openai.Float(*req.Temperature)
+	}
+	if len(req.StopSequences) > 0 {
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: req.StopSequences}
+	}
+
+	resp, err := h.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return result, fmt.Errorf("sampling completion: %w", err)
+	}
+	if resp == nil || len(resp.Choices) == 0 {
+		return result, errors.New("empty completion response")
+	}
+	used = int(resp.Usage.TotalTokens)
+
+	choice := resp.Choices[0]
+	if h.logger != nil {
+		h.logger.Info("sampling request served",
+			"instance", server.Instance,
+			"model", model,
+			"max_tokens", maxTokens,
+			"total_tokens", used,
+		)
+	}
+
+	return mcp.SamplingResult{
+		Role:       "assistant",
+		Content:    mcp.Content{Type: "text", Text: choice.Message.Content},
+		Model:      firstNonEmpty(resp.Model, model),
+		StopReason: stopReason(choice.FinishReason),
+	}, nil
+}
+
+// Usage reports the tokens consumed by a server in its current quota window, including
+// those reserved by requests in progress.
+func (h *Handler) Usage(instance string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if w, ok := h.usage[instance]; ok {
+		return w.used
+	}
+	return 0
+}
+
+func (h *Handler) policyFor(instance string) Policy {
+	if policy, ok := h.servers[instance]; ok {
+		return policy
+	}
+	return h.def
+}
+
+// reserve sets aside the most a request may use, its estimated prompt plus maxTokens, so
+// that concurrent requests cannot together overrun the quota. maxTokens is lowered to fit
+// what remains of the window, and the adjusted value is returned. settle must follow.
+func (h *Handler) reserve(instance string, policy Policy, prompt, maxTokens int) (reservation, int, error) {
+	if policy.TokenQuota <= 0 {
+		return reservation{}, maxTokens, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w := h.currentWindow(instance, policy)
+	remaining := policy.TokenQuota - w.used - prompt
+	if remaining <= 0 {
+		return reservation{}, 0, fmt.Errorf("%w: %s has used or reserved %d of %d tokens, resets at %s",
+			ErrQuotaExceeded, instance, w.used, policy.TokenQuota, w.start.Add(policy.QuotaWindow).Format(time.RFC3339))
+	}
+	maxTokens = min(maxTokens, remaining)
+	res := reservation{w: w, tokens: prompt + maxTokens}
+	w.used += res.tokens
+	return res, maxTokens, nil
+}
+
+// settle replaces a reservation with the tokens actually used, zero if the request
+// failed. The reservation stays with its window even if a new one has begun.
+func (h *Handler) settle(instance string, policy Policy, res reservation, used int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if res.w == nil {
+		h.currentWindow(instance, policy).used += used
+		return
+	}
+	res.w.used += used - res.tokens
+}
+
+// currentWindow must be called with h.mu held.
+func (h *Handler) currentWindow(instance string, policy Policy) *window {
+	now := time.Now()
+	w, ok := h.usage[instance]
+	if !ok || now.Sub(w.start) >= policy.QuotaWindow {
+		w = &window{start: now}
+		h.usage[instance] = w
+	}
+	return w
+}
+
+// estimateTokens guesses the prompt size of req at four bytes per token.
+func estimateTokens(req mcp.SamplingRequest) int {
+	n := len(req.SystemPrompt)
+	for _, msg := range req.Messages {
+		n += len(msg.Content.Text)
+	}
+	return (n + 3) / 4
+}
+
+func buildMessages(req mcp.SamplingRequest) []openai.ChatCompletionMessageParamUnion {
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(req.Messages)+1)
+	if strings.TrimSpace(req.SystemPrompt) != "" {
+		messages = append(messages, openai.SystemMessage(req.SystemPrompt))
+	}
+	for _, msg := range req.Messages {
+		text := msg.Content.Text
+		if msg.Content.Type != "" && msg.Content.Type != "text" {
+			text = fmt.Sprintf("[%s content omitted]", msg.Content.Type)
+		}
+		if strings.EqualFold(msg.Role, "assistant") {
+			messages = append(messages, openai.ChatCompletionMessageParamOfAssistant(text))
+		} else {
+			messages = append(messages, openai.UserMessage(text))
+		}
+	}
+	return messages
+}
+
+func stopReason(finish string) string {
+	switch finish {
+	case "stop":
+		return "endTurn"
+	case "length":
+		return "maxTokens"
+	default:
+		return finish
+	}
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxTokens <= 0 {
+		p.MaxTokens = defaultMaxTokens
+	}
+	if p.QuotaWindow <= 0 {
+		p.QuotaWindow = defaultQuotaWindow
+	}
+	return p
+}
+
+// filePolicy is the JSON form of a Policy.
+type filePolicy struct {
+	Enabled     *bool  `json:"enabled"`
+	MaxTokens   int    `json:"max_tokens"`
+	TokenQuota  int    `json:"token_quota"`
+	QuotaWindow string `json:"quota_window"`
+	Model       string `json:"model"`
+}
+
+// LoadPolicies reads sampling policy from a JSON file of the form
+//
+//	{"default": {...}, "servers": {"<instance>": {"enabled": true, "max_tokens": 512,
+//	 "token_quota": 10000, "quota_window": "1h", "model": "..."}}}
+//
+// The file's default overrides base; per-server entries inherit from the resulting default.
+func LoadPolicies(path string, base Policy) (Policy, map[string]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return base, nil, fmt.Errorf("read sampling policy file: %w", err)
+	}
+	var doc struct {
+		Default *filePolicy           `json:"default"`
+		Servers map[string]filePolicy `json:"servers"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return base, nil, fmt.Errorf("parse sampling policy file: %w", err)
+	}
+	def := base
+	if doc.Default != nil {
+		if def, err = doc.Default.apply(base); err != nil {
+			return base, nil, fmt.Errorf("default: %w", err)
+		}
+	}
+	policies := make(map[string]Policy, len(doc.Servers))
+	for name, fp := range doc.Servers {
+		policy, err := fp.apply(def)
+		if err != nil {
+			return base, nil, fmt.Errorf("server %s: %w", name, err)
+		}
+		policies[name] = policy
+	}
+	return def, policies, nil
+}
+
+func (fp filePolicy) apply(policy Policy) (Policy, error) {
+	if fp.Enabled != nil {
+		policy.Enabled = *fp.Enabled
+	}
+	if fp.MaxTokens > 0 {
+		policy.MaxTokens = fp.MaxTokens
+	}
+	if fp.TokenQuota > 0 {
+		policy.TokenQuota = fp.TokenQuota
+	}
+	if fp.QuotaWindow != "" {
+		d, err := time.ParseDuration(fp.QuotaWindow)
+		if err != nil {
+			return policy, fmt.Errorf("invalid quota_window: %w", err)
+		}
+		policy.QuotaWindow = d
+	}
+	if fp.Model != "" {
+		policy.Model = fp.Model
+	}
+	return policy, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // ChatCompletionRequest models the subset of the OpenAI Chat Completions API
@@ -16,6 +17,20 @@ type ChatCompletionRequest struct {
 	MaxTokens   *int          `json:"max_tokens,omitempty"`
 	Tools       []Tool        `json:"tools,omitempty"`
 	User        string        `json:"user,omitempty"`
+	// Prompt optionally references an MCP prompt template whose expansion is placed
+	// ahead of Messages. This is an extension to the OpenAI shape.
+	Prompt *PromptReference `json:"prompt,omitempty"`
+	// ApprovedTools lists destructive tools (namespaced or original names) the user has
+	// confirmed for this request when the orchestrator requires approval.
+	ApprovedTools []string `json:"approved_tools,omitempty"`
+	// ReadOnlyTools limits this request to tools annotated as read-only.
+	ReadOnlyTools bool `json:"read_only_tools,omitempty"`
+}
+
+// PromptReference names a discovered MCP prompt template and the arguments to expand it with.
+type PromptReference struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
 }
 
 // ChatMessage mirrors the OpenAI shape; content is treated as text only for now.
@@ -68,12 +83,51 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// ChatCompletionChunk is one server-sent event of a streamed chat completion. Progress is
+// an extension carrying tool progress; OpenAI clients ignore it.
+type ChatCompletionChunk struct {
+	ID       string        `json:"id"`
+	Object   string        `json:"object"`
+	Created  int64         `json:"created"`
+	Model    string        `json:"model"`
+	Choices  []ChunkChoice `json:"choices"`
+	Usage    *Usage        `json:"usage,omitempty"`
+	Progress *ToolProgress `json:"progress,omitempty"`
+}
+
+// ChunkChoice is the per-choice delta in a streamed chunk.
+type ChunkChoice struct {
+	Index        int        `json:"index"`
+	Delta        ChunkDelta `json:"delta"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+// ChunkDelta carries the incremental assistant message.
+type ChunkDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// ToolProgress reports progress of a tool call made while answering a streamed request.
+type ToolProgress struct {
+	Function string  `json:"function"`
+	Server   string  `json:"server"`
+	Tool     string  `json:"tool"`
+	Progress float64 `json:"progress"`
+	Total    float64 `json:"total,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	Partial  string  `json:"partial,omitempty"`
+}
+
 // Validate performs lightweight sanity checks on incoming requests.
 func (r *ChatCompletionRequest) Validate() error {
 	if r.Model == "" {
 		return errors.New("model is required")
 	}
-	if len(r.Messages) == 0 {
+	if r.Prompt != nil && strings.TrimSpace(r.Prompt.Name) == "" {
+		return errors.New("prompt name is required")
+	}
+	if len(r.Messages) == 0 && r.Prompt == nil {
 		return errors.New("at least one message is required")
 	}
 	for i, msg := range r.Messages {